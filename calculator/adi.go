@@ -0,0 +1,306 @@
+package calculator
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"lz/deque"
+	"lz/model"
+)
+
+// 交替方向隐式（ADI）求解
+//
+// 显式格式的时间步长受稳定性条件限制（见 getDeltaTCase*），ADI 把一个时间步长分为两个半步：
+// 第一个半步 x 方向隐式、y 方向显式，第二个半步 y 方向隐式、x 方向显式，每个半步只需求解若干三对角方程组，
+// 因此不受稳定性条件限制，可以使用更大的时间步长。
+//
+// 空间离散与 calculatePoint* 相同：相邻两点之间的导热系数由 getLambda 给出，参数顺序与 calculatePointIN 相同，
+// 表面点加上热流密度 parameter.GetQ 一项；焓温关系在每个半步开始时线性化，半步结束后再用焓值修正温度，保证能量守恒。
+// 时间步长很小时一个 ADI 步长与一个显式步长的结果相同（见 TestADIMatchesExplicit）。
+
+const (
+	SolverExplicit = "explicit" // 显式格式，时间步长由稳定性条件决定
+	SolverADI      = "adi"      // 交替方向隐式格式，时间步长由配置决定
+
+	defaultADITimeStep = 2.0 // ADI 默认时间步长 s
+)
+
+// 检查求解器名称
+func checkSolver(solver string) error {
+	if solver != SolverExplicit && solver != SolverADI {
+		return fmt.Errorf("不支持的求解器 %s，可选 %s、%s", solver, SolverExplicit, SolverADI)
+	}
+	return nil
+}
+
+// ADI 的时间步长
+func adiTimeStep() float32 {
+	if calCfg.ADITimeStep > 0 {
+		return calCfg.ADITimeStep
+	}
+	return defaultADITimeStep
+}
+
+// 切换求解器，下一个时间步长开始生效。一个时间步长内的时间步长和各切片的计算必须使用同一个求解器，
+// 显式格式使用 ADI 的时间步长时不稳定
+func (c *calculatorWithArrDeque) ChangeSolver(solver string) error {
+	if err := checkSolver(solver); err != nil {
+		return err
+	}
+	c.optionMu.Lock()
+	c.pendingSolver = solver
+	c.optionMu.Unlock()
+	return nil
+}
+
+// 在计算协程中应用等待生效的求解选项，每个时间步长和稳态计算开始时调用
+func (c *calculatorWithArrDeque) applyOptionChange() {
+	c.optionMu.Lock()
+	defer c.optionMu.Unlock()
+	if c.pendingSolver != "" {
+		c.solver = c.pendingSolver
+		c.pendingSolver = ""
+		log.WithField("solver", c.solver).Info("切换求解器")
+	}
+	if c.pendingAxial != nil {
+		c.axialConduction = *c.pendingAxial
+		c.pendingAxial = nil
+		log.WithField("on", c.axialConduction).Info("切换拉坯方向导热")
+	}
+}
+
+// 按当前的求解器计算一个切片经过 deltaT 后的温度，结果写入另一个温度场容器中，返回计算的点数
+func (c *calculatorWithArrDeque) calculateSlice(deltaT float32, z int, item *model.ItemType) int {
+	if c.solver == SolverADI {
+		return c.calculateSliceADI(deltaT, z, item)
+	}
+	// 螺旋遍历时跳过与相邻点温度相同的点，这些点不会写入另一个温度场容器；
+	// 计算拉坯方向的导热时这些点的温度也会变化，因此先把整个切片复制过去
+	if c.axialConduction {
+		*c.targetField().GetSlice(z) = *item
+	}
+	return c.calculateSliceSpirally(deltaT, z, item)
+}
+
+// 本时间步长写入的温度场容器
+func (c *calculatorWithArrDeque) targetField() *deque.ArrDeque {
+	if c.alternating {
+		return c.thermalField1
+	}
+	return c.thermalField
+}
+
+// 当前求解器下一个切片的时间步长
+func (c *calculatorWithArrDeque) timeStepOfSlice(z int, item *model.ItemType) float32 {
+	if c.solver == SolverADI {
+		return adiTimeStep()
+	}
+	parameter := c.getParameter(z)
+	zone := c.castingMachine.WhichZone(z)
+	electromagneticStirringFactor := c.castingMachine.GetElectromagneticStirringFactor(z)
+	return calculateTimeStepOfOneSlice(z, item, parameter, zone, electromagneticStirringFactor)
+}
+
+// 用 ADI 计算一个切片经过 deltaT 后的温度
+func (c *calculatorWithArrDeque) calculateSliceADI(deltaT float32, z int, item *model.ItemType) int {
+	parameter := c.getParameter(z)
+	zone := c.castingMachine.WhichZone(z)
+	electromagneticStirringFactor := c.castingMachine.GetElectromagneticStirringFactor(z)
+	var target model.ItemType
+	adiSlice(deltaT, z, item, &target, parameter, zone, electromagneticStirringFactor)
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			if c.alternating {
+				c.thermalField1.Set(z, y, x, target[y][x], parameter.TemperatureBottom)
+			} else {
+				c.thermalField.Set(z, y, x, target[y][x], parameter.TemperatureBottom)
+			}
+		}
+	}
+	return Width / YStep * Length / XStep
+}
+
+// 一个切片上与 ADI 有关的系数，导热系数和密度在一个时间步长内保持不变
+type adiCoefficient struct {
+	w, e, s, n model.ItemType // 与左、右、下、上相邻点之间的传热系数 λ/(Δ·2Δ)，不存在相邻点时为 0
+	q          model.ItemType // 表面热流密度一项
+	f          model.ItemType // 一个半步的系数 2(Δt/2)/ρ
+}
+
+func newADICoefficient(deltaT float32, z int, slice *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) *adiCoefficient {
+	nx, ny := Length/XStep, Width/YStep
+	a := &adiCoefficient{}
+	index := func(x, y int) int {
+		return int(slice[y][x]) - 1
+	}
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			i := index(x, y)
+			if x > 0 {
+				a.w[y][x] = getLambda(i, index(x-1, y), x-1, y, x, y, parameter, zone, electromagneticStirringFactor) / (stdXStep * (getEx(x) + getEx(x-1)))
+			}
+			if x < nx-1 {
+				a.e[y][x] = getLambda(i, index(x+1, y), x+1, y, x, y, parameter, zone, electromagneticStirringFactor) / (stdXStep * (getEx(x) + getEx(x+1)))
+			}
+			if y > 0 {
+				a.s[y][x] = getLambda(i, index(x, y-1), x, y-1, x, y, parameter, zone, electromagneticStirringFactor) / (stdYStep * (getEy(y) + getEy(y-1)))
+			}
+			if y < ny-1 {
+				a.n[y][x] = getLambda(i, index(x, y+1), x, y+1, x, y, parameter, zone, electromagneticStirringFactor) / (stdYStep * (getEy(y) + getEy(y+1)))
+			}
+			// 与 calculatePointLT、TA、RT、RA、RB 中内弧宽面和窄面的热流密度一项相同
+			if y == ny-1 {
+				if x == nx-1 {
+					a.q[y][x] += parameter.GetQ(x, ny, z) / (2 * stdYStep)
+				} else {
+					a.q[y][x] += parameter.GetQ(x, y, z) / (2 * stdYStep)
+				}
+			}
+			if x == nx-1 {
+				a.q[y][x] += parameter.GetQ(x, y, z) / (2 * stdXStep)
+			}
+			// 半断面时与 calculatePointLB、BA、RB 中外弧宽面的一项相同
+			if y == 0 {
+				a.q[y][x] += outerArcQ(parameter, x, z)
+			}
+			a.f[y][x] = deltaT / parameter.Density[i]
+		}
+	}
+	return a
+}
+
+// x 方向的导热项
+func (a *adiCoefficient) dx(t *model.ItemType, x, y int) float32 {
+	var d float32
+	if x > 0 {
+		d += a.w[y][x] * (t[y][x] - t[y][x-1])
+	}
+	if x < Length/XStep-1 {
+		d += a.e[y][x] * (t[y][x] - t[y][x+1])
+	}
+	return d
+}
+
+// y 方向的导热项
+func (a *adiCoefficient) dy(t *model.ItemType, x, y int) float32 {
+	var d float32
+	if y > 0 {
+		d += a.s[y][x] * (t[y][x] - t[y-1][x])
+	}
+	if y < Width/YStep-1 {
+		d += a.n[y][x] * (t[y][x] - t[y+1][x])
+	}
+	return d
+}
+
+// 温度 temp 处焓对温度的导数，与 Temp2Enthalpy 的线性插值一致；
+// 物性参数表以外焓值保持不变，此时取表内最近的导数，避免线性化后的方程组病态
+func enthalpySlope(parameter *Parameter, temp float32) float32 {
+	i := int(temp) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i > ArrayLength-2 {
+		i = ArrayLength - 2
+	}
+	for j := i; j < ArrayLength-1; j++ {
+		if slope := parameter.Enthalpy[j+1] - parameter.Enthalpy[j]; slope > 0 {
+			return slope
+		}
+	}
+	for j := i - 1; j >= 0; j-- {
+		if slope := parameter.Enthalpy[j+1] - parameter.Enthalpy[j]; slope > 0 {
+			return slope
+		}
+	}
+	return 1
+}
+
+// 用 ADI 计算切片 slice 经过 deltaT 后的温度，写入 target
+func adiSlice(deltaT float32, z int, slice, target *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) {
+	nx, ny := Length/XStep, Width/YStep
+	a := newADICoefficient(deltaT, z, slice, parameter, zone, electromagneticStirringFactor)
+
+	// 第一个半步：x 方向隐式
+	var half, enthalpy model.ItemType
+	lower, diag, upper, rhs := make([]float64, nx), make([]float64, nx), make([]float64, nx), make([]float64, nx)
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			slope := enthalpySlope(parameter, slice[y][x])
+			f := a.f[y][x]
+			lower[x] = float64(-f * a.w[y][x])
+			upper[x] = float64(-f * a.e[y][x])
+			diag[x] = float64(slope + f*(a.w[y][x]+a.e[y][x]))
+			rhs[x] = float64(slope*slice[y][x] - f*(a.dy(slice, x, y)+a.q[y][x]))
+		}
+		solveTridiagonal(lower, diag, upper, rhs)
+		for x := 0; x < nx; x++ {
+			half[y][x] = float32(rhs[x])
+		}
+	}
+	// 用焓值修正半步后的温度，与 Set 相同，温度不低于温度下限
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			enthalpy[y][x] = parameter.Temp2Enthalpy(slice[y][x]) - a.f[y][x]*(a.dx(&half, x, y)+a.dy(slice, x, y)+a.q[y][x])
+		}
+	}
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			half[y][x] = parameter.Enthalpy2Temp(enthalpy[y][x])
+			if !(half[y][x] >= parameter.TemperatureBottom) {
+				half[y][x] = parameter.TemperatureBottom
+				enthalpy[y][x] = parameter.Temp2Enthalpy(half[y][x])
+			}
+		}
+	}
+	var dxHalf model.ItemType // 第二个半步中 x 方向显式的一项
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			dxHalf[y][x] = a.dx(&half, x, y)
+		}
+	}
+
+	// 第二个半步：y 方向隐式
+	lower, diag, upper, rhs = make([]float64, ny), make([]float64, ny), make([]float64, ny), make([]float64, ny)
+	for x := 0; x < nx; x++ {
+		for y := 0; y < ny; y++ {
+			slope := enthalpySlope(parameter, half[y][x])
+			f := a.f[y][x]
+			lower[y] = float64(-f * a.s[y][x])
+			upper[y] = float64(-f * a.n[y][x])
+			diag[y] = float64(slope + f*(a.s[y][x]+a.n[y][x]))
+			rhs[y] = float64(slope*half[y][x] - f*(dxHalf[y][x]+a.q[y][x]))
+		}
+		solveTridiagonal(lower, diag, upper, rhs)
+		for y := 0; y < ny; y++ {
+			target[y][x] = float32(rhs[y])
+		}
+	}
+	var h model.ItemType
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			h[y][x] = enthalpy[y][x] - a.f[y][x]*(dxHalf[y][x]+a.dy(target, x, y)+a.q[y][x])
+		}
+	}
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			target[y][x] = parameter.Enthalpy2Temp(h[y][x])
+			if !(target[y][x] >= parameter.TemperatureBottom) {
+				target[y][x] = parameter.TemperatureBottom
+			}
+		}
+	}
+}
+
+// 追赶法求解三对角方程组，lower[i]、diag[i]、upper[i] 为第 i 行的三个系数，结果写入 rhs
+func solveTridiagonal(lower, diag, upper, rhs []float64) {
+	n := len(diag)
+	for i := 1; i < n; i++ {
+		m := lower[i] / diag[i-1]
+		diag[i] -= m * upper[i-1]
+		rhs[i] -= m * rhs[i-1]
+	}
+	rhs[n-1] /= diag[n-1]
+	for i := n - 2; i >= 0; i-- {
+		rhs[i] = (rhs[i] - upper[i]*rhs[i+1]) / diag[i]
+	}
+}
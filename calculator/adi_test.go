@@ -0,0 +1,147 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+	"testing"
+)
+
+func TestSolveTridiagonal(t *testing.T) {
+	// [2 1 0; 1 2 1; 0 1 2] x = [4 8 8]，解为 [1 2 3]
+	lower, diag, upper := []float64{0, 1, 1}, []float64{2, 2, 2}, []float64{1, 1, 0}
+	rhs := []float64{4, 8, 8}
+	solveTridiagonal(lower, diag, upper, rhs)
+	for i, want := range []float64{1, 2, 3} {
+		if math.Abs(rhs[i]-want) > 1e-9 {
+			t.Fatal("追赶法求解错误", rhs)
+		}
+	}
+}
+
+// 二冷区（导热修正系数为 1）中表面均匀冷却的切片
+func newADITestSlice(t *testing.T, q float32) (*model.ItemType, *Parameter) {
+	ZLength, Length, Width = 200, 50, 20
+	steel, err := NewSteel(3, &CastingMachine{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := range steel.Parameter.Q[0] {
+		steel.Parameter.Q[0][j] = q
+	}
+	var slice model.ItemType
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			slice[y][x] = 1450 - float32(x+y)
+		}
+	}
+	return &slice, steel.Parameter
+}
+
+func TestADISliceUniform(t *testing.T) {
+	slice, parameter := newADITestSlice(t, 0)
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			slice[y][x] = 1400
+		}
+	}
+	var target model.ItemType
+	adiSlice(2, 0, slice, &target, parameter, 1, 1)
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			if math.Abs(float64(target[y][x]-1400)) > 1e-3 {
+				t.Fatal("无热流时均匀温度场不应变化", y, x, target[y][x])
+			}
+		}
+	}
+}
+
+func TestADISliceEnergy(t *testing.T) {
+	slice, parameter := newADITestSlice(t, 2e5)
+	deltaT := float32(2)
+	var target model.ItemType
+	adiSlice(deltaT, 0, slice, &target, parameter, 1, 1)
+	// 焓的变化与表面带走的热量相等：Σρ(H'-H) = -2Δt·Σq
+	var change, flux float64
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			density := float64(parameter.Density[int(slice[y][x])-1])
+			change += density * float64(parameter.Temp2Enthalpy(target[y][x])-parameter.Temp2Enthalpy(slice[y][x]))
+			if y == Width/YStep-1 {
+				flux += float64(parameter.GetQ(x, y, 0) / (2 * stdYStep))
+			}
+			if x == Length/XStep-1 {
+				flux += float64(parameter.GetQ(x, y, 0) / (2 * stdXStep))
+			}
+		}
+	}
+	want := -2 * float64(deltaT) * flux
+	if math.Abs(change-want) > math.Abs(want)*1e-3 {
+		t.Fatal("ADI 不守恒", change, want)
+	}
+}
+
+func TestADISliceLargeStep(t *testing.T) {
+	slice, parameter := newADITestSlice(t, 2e5)
+	explicit := calculateTimeStepOfOneSlice(0, slice, parameter, 1, 1)
+	deltaT := 20 * explicit
+	for i := 0; i < 10; i++ {
+		var target model.ItemType
+		adiSlice(deltaT, 0, slice, &target, parameter, 1, 1)
+		*slice = target
+	}
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			temp := slice[y][x]
+			if math.IsNaN(float64(temp)) || temp > 1450 || temp < parameter.TemperatureBottom {
+				t.Fatal("时间步长为显式格式的 20 倍时结果不稳定", y, x, temp)
+			}
+		}
+	}
+	// 表面冷却，表面温度应低于中心
+	if slice[Width/YStep-1][Length/XStep-1] >= slice[0][0] {
+		t.Fatal("表面温度应低于中心温度")
+	}
+}
+
+func TestChangeSolver(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if c.solver != SolverExplicit {
+		t.Fatal("默认应使用显式格式", c.solver)
+	}
+	if err := c.ChangeSolver(SolverADI); err != nil || c.solver != SolverExplicit {
+		t.Fatal("切换求解器应在下一个时间步长开始时生效", err)
+	}
+	c.applyOptionChange()
+	if c.solver != SolverADI {
+		t.Fatal("切换求解器失败", c.solver)
+	}
+	if c.ChangeSolver("spline") == nil || c.solver != SolverADI {
+		t.Fatal("不支持的求解器应返回错误且不改变当前求解器")
+	}
+}
+
+func TestADIMatchesExplicit(t *testing.T) {
+	slice, parameter := newADITestSlice(t, 2e5)
+	c := NewCalculatorWithArrDeque(nil)
+	c.steel1 = &Steel{Parameter: parameter, CastingMachine: c.castingMachine}
+	c.addFirstSlice(0)
+	*c.thermalField.GetSlice(0) = *slice
+	c.runningState = stateRunning
+	c.alternating = true
+	deltaT := float32(0.01)
+	c.calculateSliceSpirally(deltaT, 0, c.thermalField.GetSlice(0))
+	explicit := c.thermalField1.GetSlice(0)
+
+	var target model.ItemType
+	adiSlice(deltaT, 0, slice, &target, parameter, c.castingMachine.WhichZone(0), 1)
+	// 时间步长很小时两种格式每个点的温度变化相同
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			change := math.Abs(float64(explicit[y][x] - slice[y][x]))
+			if diff := math.Abs(float64(target[y][x] - explicit[y][x])); diff > 0.01*change+1e-3 {
+				t.Fatal("ADI 与显式格式的结果不同", y, x, slice[y][x], explicit[y][x], target[y][x])
+			}
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package calculator
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"lz/model"
+	"sync"
+	"time"
+)
+
+// 热工状态报警
+//
+// 每个推送周期按报警规则检查一次温度场，规则从不满足变为满足时产生报警（raise），满足的规则不再满足时恢复（clear），
+// 产生和恢复都作为报警事件推送给前端并保存在报警历史中。规则被删除或无法检查（如冷却区内还没有铸坯）时当前的报警恢复。
+
+const (
+	AlarmRaise = "raise" // 产生报警
+	AlarmClear = "clear" // 报警恢复
+
+	AlarmZoneTemperatureHigh    = "zone_temperature_high"    // 冷却区表面温度高于上限
+	AlarmZoneTemperatureLow     = "zone_temperature_low"     // 冷却区表面温度低于下限
+	AlarmReheatRate             = "reheat_rate"              // 冷却区表面回温速率高于上限
+	AlarmMoldExitShell          = "mold_exit_shell"          // 结晶器出口坯壳厚度低于下限
+	AlarmLiquidCoreStraightener = "liquid_core_straightener" // 未完全凝固的液芯到达矫直点
+	AlarmLiquidCoreCutoff       = "liquid_core_cutoff"       // 未完全凝固的液芯到达切割点
+
+	maxAlarmHistory = 1000 // 保留的报警事件条数
+)
+
+// 报警在 Run 协程中检查，在推送和 HTTP 请求的协程中读取，读写时持有 mu
+type alarmEngine struct {
+	mu      sync.Mutex
+	rules   model.AlarmRules
+	active  map[string]model.Alarm // 当前未恢复的报警
+	history []model.Alarm          // 最近的报警事件
+}
+
+// 当前未恢复的报警和报警历史
+type AlarmData struct {
+	Rules   model.AlarmRules `json:"rules"`
+	Active  []model.Alarm    `json:"active"`
+	History []model.Alarm    `json:"history"`
+}
+
+// 一条规则的检查结果
+type alarmCheck struct {
+	rule     string
+	zone     int
+	value    float32
+	limit    float32
+	violated bool
+	message  string
+}
+
+func (a alarmCheck) key() string {
+	if a.zone > 0 {
+		return fmt.Sprintf("%s:%d", a.rule, a.zone)
+	}
+	return a.rule
+}
+
+// 检查报警规则，zones 为二冷区的分区数
+func checkAlarmRules(rules model.AlarmRules, zones int) error {
+	seen := make(map[int]bool)
+	for _, limit := range rules.ZoneTemperature {
+		if limit.Zone < 1 || limit.Zone > zones {
+			return fmt.Errorf("报警规则的冷却区编号 %d 超出范围 1-%d", limit.Zone, zones)
+		}
+		if seen[limit.Zone] {
+			return fmt.Errorf("冷却区 %d 的表面温度报警规则重复", limit.Zone)
+		}
+		seen[limit.Zone] = true
+		if limit.Min < 0 || limit.Max < 0 || (limit.Max > 0 && limit.Min > limit.Max) {
+			return fmt.Errorf("冷却区 %d 的表面温度上下限错误", limit.Zone)
+		}
+	}
+	if rules.MaxReheatRate < 0 || rules.MinMoldExitShell < 0 || rules.StraightenerDistance < 0 || rules.CutoffDistance < 0 {
+		return fmt.Errorf("报警规则的限值不能为负数")
+	}
+	return nil
+}
+
+// 设置报警规则，不再满足新规则的报警在下一个推送周期恢复
+func (c *calculatorWithArrDeque) SetAlarmRules(rules model.AlarmRules) error {
+	if err := checkAlarmRules(rules, len(c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg)); err != nil {
+		return err
+	}
+	c.alarm.mu.Lock()
+	c.alarm.rules = rules
+	c.alarm.mu.Unlock()
+	log.WithField("rules", rules).Info("设置报警规则")
+	return nil
+}
+
+// 当前未恢复的报警和最近的报警事件
+func (c *calculatorWithArrDeque) Alarms() *AlarmData {
+	c.alarm.mu.Lock()
+	defer c.alarm.mu.Unlock()
+	data := &AlarmData{
+		Rules:   c.alarm.rules,
+		Active:  make([]model.Alarm, 0, len(c.alarm.active)),
+		History: make([]model.Alarm, len(c.alarm.history)),
+	}
+	for _, alarm := range c.alarm.active {
+		data.Active = append(data.Active, alarm)
+	}
+	copy(data.History, c.alarm.history)
+	return data
+}
+
+// 按报警规则检查当前温度场，把产生和恢复的报警推送给前端
+func (c *calculatorWithArrDeque) checkAlarms() {
+	c.alarm.mu.Lock()
+	rules := c.alarm.rules
+	c.alarm.mu.Unlock()
+	checks := make(map[string]alarmCheck)
+	if !c.Field.IsEmpty() {
+		for _, check := range c.evaluateAlarmRules(rules) {
+			checks[check.key()] = check
+		}
+	}
+	if events := c.alarm.update(checks, c.clock.Seconds()); len(events) > 0 {
+		log.WithField("alarms", events).Warn("热工状态报警")
+		// 没有前端接收时丢弃，不阻塞计算
+		select {
+		case c.calcHub.Alarms <- events:
+		default:
+			log.Debug("报警推送通道已满，丢弃本次报警事件")
+		}
+	}
+}
+
+// 按检查结果更新当前的报警和报警历史，返回产生和恢复的报警事件，clock 为模拟时间 s
+func (a *alarmEngine) update(checks map[string]alarmCheck, clock float64) []model.Alarm {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.active == nil {
+		a.active = make(map[string]model.Alarm)
+	}
+	now := time.Now()
+	var events []model.Alarm
+	for key, check := range checks {
+		if _, ok := a.active[key]; ok || !check.violated {
+			continue
+		}
+		alarm := model.Alarm{
+			Key:     key,
+			Rule:    check.rule,
+			Zone:    check.zone,
+			State:   AlarmRaise,
+			Value:   check.value,
+			Limit:   check.limit,
+			Message: check.message,
+			Time:    clock,
+			At:      now,
+		}
+		a.active[key] = alarm
+		events = append(events, alarm)
+	}
+	for key, alarm := range a.active {
+		check, ok := checks[key]
+		if ok && check.violated {
+			continue
+		}
+		alarm.State = AlarmClear
+		alarm.Time = clock
+		alarm.At = now
+		if ok {
+			alarm.Value = check.value
+		}
+		alarm.Message = "报警恢复：" + alarm.Message
+		delete(a.active, key)
+		events = append(events, alarm)
+	}
+	a.history = append(a.history, events...)
+	if len(a.history) > maxAlarmHistory {
+		a.history = a.history[len(a.history)-maxAlarmHistory:]
+	}
+	return events
+}
+
+// 检查所有能够检查的报警规则
+func (c *calculatorWithArrDeque) evaluateAlarmRules(rules model.AlarmRules) []alarmCheck {
+	var checks []alarmCheck
+
+	// 各冷却区内弧宽面中心表面温度的范围和最大回温速率
+	zones := len(c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg)
+	minTemp := make([]float32, zones)
+	maxTemp := make([]float32, zones)
+	reheatRate := make([]float32, zones)
+	count := make([]int, zones)
+	var reheat reheatTracker
+	row := Width/YStep - 1
+	c.Field.Traverse(func(z int, item *model.ItemType) {
+		zone := c.castingMachine.SliceZone(z)
+		// 跳过为空的切片， 即值为-1
+		if item[0][0] == -1 || zone <= Zone0 || zone > zones {
+			reheat.reset()
+			return
+		}
+		temp := item[row][0]
+		i := zone - 1
+		if count[i] == 0 || temp < minTemp[i] {
+			minTemp[i] = temp
+		}
+		if count[i] == 0 || temp > maxTemp[i] {
+			maxTemp[i] = temp
+		}
+		count[i]++
+		if rate := reheat.add(temp); rate > reheatRate[i] {
+			reheatRate[i] = rate
+		}
+	}, 0, c.Field.Size())
+
+	for _, limit := range rules.ZoneTemperature {
+		i := limit.Zone - 1
+		if count[i] == 0 {
+			continue
+		}
+		if limit.Max > 0 {
+			checks = append(checks, alarmCheck{
+				rule: AlarmZoneTemperatureHigh, zone: limit.Zone, value: maxTemp[i], limit: limit.Max, violated: maxTemp[i] > limit.Max,
+				message: fmt.Sprintf("冷却区 %d 表面温度 %.1f℃ 高于上限 %.1f℃", limit.Zone, maxTemp[i], limit.Max),
+			})
+		}
+		if limit.Min > 0 {
+			checks = append(checks, alarmCheck{
+				rule: AlarmZoneTemperatureLow, zone: limit.Zone, value: minTemp[i], limit: limit.Min, violated: minTemp[i] < limit.Min,
+				message: fmt.Sprintf("冷却区 %d 表面温度 %.1f℃ 低于下限 %.1f℃", limit.Zone, minTemp[i], limit.Min),
+			})
+		}
+	}
+	if rules.MaxReheatRate > 0 {
+		for i := 0; i < zones; i++ {
+			if count[i] == 0 {
+				continue
+			}
+			checks = append(checks, alarmCheck{
+				rule: AlarmReheatRate, zone: i + 1, value: reheatRate[i], limit: rules.MaxReheatRate, violated: reheatRate[i] > rules.MaxReheatRate,
+				message: fmt.Sprintf("冷却区 %d 表面回温速率 %.1f℃/m 高于上限 %.1f℃/m", i+1, reheatRate[i], rules.MaxReheatRate),
+			})
+		}
+	}
+
+	if rules.MinMoldExitShell > 0 {
+		moldExit := float32(c.castingMachine.Coordinate.MdLength) - c.castingMachine.Coordinate.LevelHeight
+		if sample, ok := c.shellThicknessAt(c.steels(), moldExit); ok {
+			thinnest := sample.Thinnest()
+			checks = append(checks, alarmCheck{
+				rule: AlarmMoldExitShell, value: thinnest, limit: rules.MinMoldExitShell, violated: thinnest < rules.MinMoldExitShell,
+				message: fmt.Sprintf("结晶器出口坯壳厚度 %.1fmm 低于下限 %.1fmm", thinnest, rules.MinMoldExitShell),
+			})
+		}
+	}
+
+	// 凝固末端（冶金长度）之前中心仍有液相或处于两相区，铸坯已经到达某一位置且凝固末端在该位置之后（或还未出现）时，
+	// 液芯到达该位置。不使用液芯末端：中心低于液相线温度后仍要经过整个两相区才完全凝固
+	if rules.StraightenerDistance > 0 || rules.CutoffDistance > 0 {
+		solidEnd := c.SolidificationEnd().Center.SolidEnd
+		extent := float32(c.Field.Size() * ZStep)
+		value := solidEnd
+		if value == 0 {
+			value = extent
+		}
+		for _, position := range []struct {
+			rule     string
+			name     string
+			distance float32
+		}{
+			{AlarmLiquidCoreStraightener, "矫直点", rules.StraightenerDistance},
+			{AlarmLiquidCoreCutoff, "切割点", rules.CutoffDistance},
+		} {
+			if position.distance <= 0 || extent < position.distance {
+				continue
+			}
+			checks = append(checks, alarmCheck{
+				rule: position.rule, value: value, limit: position.distance, violated: solidEnd == 0 || solidEnd > position.distance,
+				message: fmt.Sprintf("凝固末端 %.0fmm 超过%s %.0fmm", value, position.name, position.distance),
+			})
+		}
+	}
+	return checks
+}
@@ -0,0 +1,109 @@
+package calculator
+
+import (
+	"lz/model"
+	"testing"
+)
+
+func TestSetAlarmRules(t *testing.T) {
+	c := newControlTestCalculator(t, 1010)
+	for _, rules := range []model.AlarmRules{
+		{ZoneTemperature: []model.ZoneTemperatureLimit{{Zone: 2, Max: 1000}}},
+		{ZoneTemperature: []model.ZoneTemperatureLimit{{Zone: 1, Max: 1000}, {Zone: 1, Min: 900}}},
+		{ZoneTemperature: []model.ZoneTemperatureLimit{{Zone: 1, Min: 1000, Max: 900}}},
+		{MaxReheatRate: -1},
+	} {
+		if c.SetAlarmRules(rules) == nil {
+			t.Fatal("报警规则错误时应返回错误", rules)
+		}
+	}
+	if err := c.SetAlarmRules(model.AlarmRules{ZoneTemperature: []model.ZoneTemperatureLimit{{Zone: 1, Min: 900}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckAlarms(t *testing.T) {
+	c := newControlTestCalculator(t, 1010)
+	if err := c.SetAlarmRules(model.AlarmRules{ZoneTemperature: []model.ZoneTemperatureLimit{{Zone: 1, Max: 1000}}}); err != nil {
+		t.Fatal(err)
+	}
+	c.checkAlarms()
+	events := <-c.calcHub.Alarms
+	if len(events) != 1 || events[0].State != AlarmRaise || events[0].Rule != AlarmZoneTemperatureHigh || events[0].Value != 1010 {
+		t.Fatal("应产生表面温度过高报警", events)
+	}
+
+	// 报警未恢复时不重复产生
+	c.checkAlarms()
+	if len(c.calcHub.Alarms) != 0 || len(c.Alarms().Active) != 1 {
+		t.Fatal("报警未恢复时不应重复产生")
+	}
+
+	if err := c.SetAlarmRules(model.AlarmRules{ZoneTemperature: []model.ZoneTemperatureLimit{{Zone: 1, Max: 1100}}}); err != nil {
+		t.Fatal(err)
+	}
+	c.checkAlarms()
+	events = <-c.calcHub.Alarms
+	if len(events) != 1 || events[0].State != AlarmClear || events[0].Key != AlarmZoneTemperatureHigh+":1" {
+		t.Fatal("应恢复表面温度过高报警", events)
+	}
+	data := c.Alarms()
+	if len(data.Active) != 0 || len(data.History) != 2 {
+		t.Fatal("报警历史错误", data)
+	}
+}
+
+func TestCheckAlarmsLiquidCore(t *testing.T) {
+	c := newControlTestCalculator(t, 1010)
+	// 5 个切片，铸坯已经到达 30mm 处但还未到达 100mm 处，中心处于两相区
+	mushy := (c.steel1.LiquidPhaseTemperature + c.steel1.SolidPhaseTemperature) / 2
+	for z := 0; z < c.Field.Size(); z++ {
+		c.thermalField.GetSlice(z)[0][0] = mushy
+	}
+	if err := c.SetAlarmRules(model.AlarmRules{StraightenerDistance: 30, CutoffDistance: 100}); err != nil {
+		t.Fatal(err)
+	}
+	c.checkAlarms()
+	active := c.Alarms().Active
+	if len(active) != 1 || active[0].Rule != AlarmLiquidCoreStraightener {
+		t.Fatal("中心低于液相线温度但未完全凝固时应产生液芯到达矫直点报警", active)
+	}
+
+	// 矫直点之前完全凝固后报警恢复
+	for z := 1; z < c.Field.Size(); z++ {
+		c.thermalField.GetSlice(z)[0][0] = c.steel1.SolidPhaseTemperature - 10
+	}
+	c.checkAlarms()
+	if active = c.Alarms().Active; len(active) != 0 {
+		t.Fatal("凝固末端在矫直点之前时不应报警", active)
+	}
+}
+
+func TestAlarmsConcurrent(t *testing.T) {
+	c := newControlTestCalculator(t, 1010)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			max := float32(1000)
+			if i%2 == 1 {
+				max = 1100
+			}
+			_ = c.SetAlarmRules(model.AlarmRules{ZoneTemperature: []model.ZoneTemperatureLimit{{Zone: 1, Max: max}}})
+			c.checkAlarms()
+			<-c.calcHub.Alarms
+		}
+	}()
+	// 推送和 HTTP 请求的协程读取报警时 Run 协程同时在检查报警
+	for {
+		select {
+		case <-done:
+			if data := c.Alarms(); len(data.History) != 100 {
+				t.Fatal("报警历史错误", len(data.History))
+			}
+			return
+		default:
+			_ = c.Alarms()
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package calculator
+
+import (
+	"lz/deque"
+	"lz/model"
+	"math"
+	"sync"
+)
+
+// 拉坯方向的导热
+//
+// 默认每个切片单独作为二维问题求解，忽略拉坯方向（z 方向）的导热。开启后每个时间步长在所有切片的二维计算之后，
+// 再沿拉坯方向计算一次导热（算子分裂），离散方式与 calculatePointIN 中 x、y 方向相同。
+//
+// 不同 (x, y) 位置沿拉坯方向的导热互不影响，按行并行计算。每个点使用相邻切片同一时刻的温度，自身的温度取隐式，
+// 因此不受稳定性条件限制；时间步长超过 maxTimeStep 时分为若干步计算，以保证精度。
+// 弯月面处和铸机末端的切片只与铸机内的一个相邻切片换热，空切片（值为-1）视为不存在。
+
+var stdZStep = float32(ZStep) / 1000
+
+// 开启或关闭拉坯方向的导热，下一个时间步长开始生效
+func (c *calculatorWithArrDeque) SetAxialConduction(on bool) {
+	c.optionMu.Lock()
+	c.pendingAxial = &on
+	c.optionMu.Unlock()
+}
+
+// 二维计算之后，对温度场 field 中 [start, end) 内的切片计算拉坯方向的导热，范围两端以外相邻的切片只作为边界，温度保持不变
+func (c *calculatorWithArrDeque) conductAxially(deltaT float32, start, end int, field *deque.ArrDeque) {
+	first, last := 0, end-start // 需要更新的切片在 slices 中的范围
+	if start > 0 {
+		start--
+		first, last = first+1, last+1
+	}
+	if end < field.Size() {
+		end++
+	}
+	n := end - start
+	slices := make([]*model.ItemType, n)
+	parameters := make([]*Parameter, n)
+	bottoms := make([]float32, n) // getParameter 返回的物性参数是共用的，温度下限需要单独保存
+	zones := make([]int, n)
+	for i := 0; i < n; i++ {
+		z := start + i
+		slices[i] = field.GetSlice(z)
+		// 跳过为空的切片， 即值为-1
+		if slices[i][0][0] == -1 {
+			slices[i] = nil
+			continue
+		}
+		parameters[i] = c.getParameter(z)
+		bottoms[i] = parameters[i].TemperatureBottom
+		zones[i] = c.castingMachine.WhichZone(z)
+	}
+
+	steps := int(math.Ceil(float64(deltaT / maxTimeStep)))
+	if steps < 1 {
+		steps = 1
+	}
+	deltaT = deltaT / float32(steps)
+	var wg sync.WaitGroup
+	for y := 0; y < Width/YStep; y++ {
+		wg.Add(1)
+		go func(y int) {
+			defer wg.Done()
+			for x := 0; x < Length/XStep; x++ {
+				for i := 0; i < steps; i++ {
+					conductColumn(deltaT, x, y, first, last, slices, parameters, bottoms, zones)
+				}
+			}
+		}(y)
+	}
+	wg.Wait()
+}
+
+// 计算 (x, y) 处第 first 到 last-1 个切片经过 deltaT 后拉坯方向的导热，每个点使用相邻切片本次计算前的温度
+func conductColumn(deltaT float32, x, y, first, last int, slices []*model.ItemType, parameters []*Parameter, bottoms []float32, zones []int) {
+	pre := float32(-1) // 上一个切片本次计算前的温度，-1 表示不存在
+	if first > 0 && slices[first-1] != nil {
+		pre = slices[first-1][y][x]
+	}
+	for i := first; i < last; i++ {
+		if slices[i] == nil {
+			pre = -1
+			continue
+		}
+		temp := slices[i][y][x]
+		parameter := parameters[i]
+		index := int(temp) - 1
+		var a, sum float32 // 与相邻切片之间的传热系数之和，及传热系数与相邻切片温度的乘积之和
+		if pre != -1 {
+			k := getAxialLambda(index, int(pre)-1, parameter, zones[i]) / (stdZStep * 2 * stdZStep)
+			a += k
+			sum += k * pre
+		}
+		if i+1 < len(slices) && slices[i+1] != nil {
+			next := slices[i+1][y][x]
+			k := getAxialLambda(index, int(next)-1, parameter, zones[i]) / (stdZStep * 2 * stdZStep)
+			a += k
+			sum += k * next
+		}
+		pre = temp
+		if a == 0 {
+			continue
+		}
+		// 自身温度取隐式，按焓对温度的导数线性化后求解，再用焓值修正温度，与 adiSlice 相同
+		f := 2 * deltaT / parameter.Density[index]
+		slope := enthalpySlope(parameter, temp)
+		implicit := (slope*temp + f*sum) / (slope + f*a)
+		target := parameter.Enthalpy2Temp(parameter.Temp2Enthalpy(temp) - f*(a*implicit-sum))
+		if !(target >= bottoms[i]) {
+			target = bottoms[i]
+		}
+		slices[i][y][x] = target
+	}
+}
+
+// 相邻两个切片之间的等效导热系数，与 getLambda 相同，取两点导热系数的调和平均，结晶器内乘以修正系数
+func getAxialLambda(index1, index2 int, parameter *Parameter, zone int) float32 {
+	var K float32 = 1.0
+	if zone == Zone0 {
+		K = parameter.K[index1+1]
+	}
+	return K * 2 * parameter.Lambda[index1] * parameter.Lambda[index2] / (parameter.Lambda[index1] + parameter.Lambda[index2])
+}
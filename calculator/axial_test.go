@@ -0,0 +1,70 @@
+package calculator
+
+import (
+	"testing"
+)
+
+func newAxialTestCalculator(t *testing.T, temps ...float32) *calculatorWithArrDeque {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	c.castingMachine.Coordinate.MdLength = ZLength // 所有切片都在结晶器内
+	for _, temp := range temps {
+		c.addLastSlice(temp)
+	}
+	c.runningState = stateRunning
+	return c
+}
+
+func TestConductAxially(t *testing.T) {
+	c := newAxialTestCalculator(t, 1000, 1400, 1000)
+	c.conductAxially(0.2, 0, 3, c.thermalField)
+	pre, mid, next := c.thermalField.Get(0, 1, 1), c.thermalField.Get(1, 1, 1), c.thermalField.Get(2, 1, 1)
+	if !(mid < 1400 && pre > 1000 && next > 1000 && mid > pre) {
+		t.Fatal("拉坯方向导热后温度错误", pre, mid, next)
+	}
+	if pre != next {
+		t.Fatal("两端切片的温度应相同", pre, next)
+	}
+	// 一个切片内各点的温度仍然相同
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			if c.thermalField.Get(1, y, x) != mid {
+				t.Fatal("切片内温度不均匀", y, x)
+			}
+		}
+	}
+}
+
+func TestConductAxiallyRange(t *testing.T) {
+	c := newAxialTestCalculator(t, 1000, 1400, 1000, -1)
+	// 只计算第 1 个切片，两侧的切片作为边界保持不变
+	c.conductAxially(2, 1, 2, c.thermalField)
+	if c.thermalField.Get(0, 0, 0) != 1000 || c.thermalField.Get(2, 0, 0) != 1000 {
+		t.Fatal("边界切片的温度不应改变")
+	}
+	mid := c.thermalField.Get(1, 0, 0)
+	if !(mid < 1400 && mid >= 1000) {
+		t.Fatal("时间步长较大时温度不应越过相邻切片", mid)
+	}
+	// 空切片不参与计算
+	c.conductAxially(0.2, 0, 4, c.thermalField)
+	if c.thermalField.Get(3, 0, 0) != -1 {
+		t.Fatal("空切片的温度不应改变")
+	}
+}
+
+func TestSetAxialConduction(t *testing.T) {
+	c := newAxialTestCalculator(t)
+	on := !c.axialConduction
+	c.SetAxialConduction(on)
+	if c.axialConduction == on {
+		t.Fatal("拉坯方向导热开关应在下一个时间步长开始时生效")
+	}
+	c.applyOptionChange()
+	if c.axialConduction != on {
+		t.Fatal("拉坯方向导热开关未生效")
+	}
+}
@@ -1,6 +1,9 @@
 package calculator
 
-import "lz/model"
+import (
+	"lz/model"
+	"time"
+)
 
 // calculator 的接口定义
 
@@ -13,8 +16,14 @@ type Calculator interface {
 	// 获取CalcHub
 	GetCalcHub() *CalcHub
 
-	// 初始化钢种
-	InitSteel(steelValue int, castingMachine *CastingMachine)
+	// 关闭计算器，停止所有协程，关闭后不能再使用
+	Close()
+
+	// 初始化钢种，钢种不存在时返回错误
+	InitSteel(steelValue int, castingMachine *CastingMachine) error
+
+	// 浇铸过程中更换钢种，mixingLength 为混浇长度 mm
+	ChangeSteel(steelValue int, mixingLength float32) error
 
 	// 初始化铸机
 	InitCastingMachine()
@@ -28,6 +37,45 @@ type Calculator interface {
 	// 运行
 	Run()
 
+	// 离线批量运行，直到模拟时间达到 duration
+	RunFor(duration time.Duration) time.Duration
+
+	// 切换求解器：explicit 或 adi
+	ChangeSolver(solver string) error
+
+	// 开启或关闭拉坯方向的导热
+	SetAxialConduction(on bool)
+
+	// 设置二冷动态控制
+	SetDynamicControl(cfg model.DynamicControl) error
+
+	// 求解当前拉速和冷却条件下的稳态温度场
+	SolveSteadyState() (*TemperatureFieldData, error)
+
+	// 在当前钢种和拉速下离线优化二冷水量
+	OptimizeWater(cfg model.WaterOptimization) (*WaterOptimizeResult, error)
+
+	// 构建离线计算的关键指标
+	BuildKPI() *KPI
+
+	// 计算液芯末端和凝固末端
+	SolidificationEnd() *SolidificationEndData
+
+	// 计算沿拉坯方向的坯壳厚度
+	ShellProfile() *ShellProfile
+
+	// 设置轻压下的中心固相率窗口
+	SetSoftReductionWindow(window model.SoftReductionWindow) error
+
+	// 计算应投入轻压下的扇形段
+	SoftReduction() *SoftReductionData
+
+	// 设置报警规则
+	SetAlarmRules(rules model.AlarmRules) error
+
+	// 获取当前报警和报警历史
+	Alarms() *AlarmData
+
 	// 设置拉尾坯
 	SetStateTail()
 
@@ -21,7 +21,7 @@ func TestCalculator1(t *testing.T) {
 			WideSurfaceOut:   38.0,
 		},
 	}, []byte{})
-	calculator.steel1 = NewSteel(1, calculator.castingMachine)
+	calculator.steel1, _ = NewSteel(3, calculator.castingMachine)
 	fmt.Println(calculator.castingMachine.CoolerConfig.StartTemperature)
 	calculator.runningState = stateRunning
 	calculator.Calculate()
@@ -49,7 +49,7 @@ func TestCalculator2(t *testing.T) {
 	calculator.castingMachine.SetFromJson(model.Coordinate{
 		MdLength: 950,
 	})
-	calculator.steel1 = NewSteel(1, calculator.castingMachine)
+	calculator.steel1, _ = NewSteel(3, calculator.castingMachine)
 	fmt.Println(calculator.castingMachine.CoolerConfig.StartTemperature)
 	calculator.runningState = stateRunning
 	//calculator.Calculate(
@@ -69,7 +69,7 @@ func TestCalculatorWithArrDeque_calculate(t *testing.T) {
 			WideSurfaceOut:   38.0,
 		},
 	},  []byte{})
-	calculator.steel1 = NewSteel(1, calculator.castingMachine)
+	calculator.steel1, _ = NewSteel(3, calculator.castingMachine)
 	fmt.Println(calculator.castingMachine.CoolerConfig.StartTemperature)
 	for i := 0; i < 4000; i++ {
 		calculator.Field.AddFirst(calculator.castingMachine.CoolerConfig.StartTemperature)
@@ -1,6 +1,7 @@
 package calculator
 
 import (
+	"context"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"lz/deque"
@@ -38,7 +39,8 @@ type calculatorWithArrDeque struct {
 
 	alternating bool // 每计算一个 ▲t 进行一次异或运算
 
-	reminder int64 // 累计产生的切片的余数
+	reminder int64         // 累计产生的切片的余数
+	clock    time.Duration // 模拟时间，每计算一个 ▲t 增加 ▲t，拉速为 0 时仍然增加
 
 	calcHub *CalcHub // 推送消息通道
 
@@ -55,7 +57,34 @@ type calculatorWithArrDeque struct {
 	steel1 *Steel // 第一种钢种
 	steel2 *Steel // 第二种钢种
 
-	e executor
+	sliceMeta  *sliceMetaDeque  // 每个切片所属的钢种及混合比例
+	transition *steelTransition // 钢种切换进度，未切换时为 nil
+
+	// steel1、steel2 和 transition 只在 Run 协程中修改（计算器开始计算之前除外），修改时持有 steelMu，
+	// 其他协程通过 steels 持有 steelMu 获取快照后读取
+	steelMu      sync.Mutex
+	pendingSteel *steelChange // 等待下一个时间步长开始时生效的钢种更换
+
+	solver          string // 求解器，SolverExplicit 或 SolverADI，只在计算协程中修改
+	axialConduction bool   // 是否计算拉坯方向的导热，只在计算协程中修改
+
+	// 等待下一个时间步长开始时生效的求解选项，读写时持有 optionMu
+	optionMu      sync.Mutex
+	pendingSolver string // 为空时没有等待生效的求解器
+	pendingAxial  *bool  // 为空时没有等待生效的拉坯方向导热开关
+
+	control *dynamicController // 二冷动态控制，未开启时为 nil，只在 Run 协程中修改
+	// 等待下一个时间步长开始时生效的动态控制配置。修改 control、pendingControl 和控制动作记录时持有 controlMu
+	controlMu      sync.Mutex
+	pendingControl *model.DynamicControl
+
+	reductionWindow model.SoftReductionWindow // 轻压下的中心固相率窗口
+
+	alarm alarmEngine // 热工状态报警
+
+	e            executor
+	stopExecutor context.CancelFunc // 停止 executor 的协程
+	runMu        sync.Mutex         // Run 运行期间持有，关闭时等待 Run 退出
 
 	mu sync.Mutex // 保护 push data时对温度数据的并发访问
 }
@@ -69,10 +98,18 @@ func NewCalculatorWithArrDeque(e executor) *calculatorWithArrDeque {
 	// 初始化数据结构
 	c.thermalField = deque.NewArrDeque(ZLength / ZStep)
 	c.thermalField1 = deque.NewArrDeque(ZLength / ZStep)
+	c.sliceMeta = newSliceMetaDeque(ZLength / ZStep)
 
 	c.Field = c.thermalField
 	c.alternating = true
 
+	c.solver = calCfg.Solver
+	if c.solver == "" {
+		c.solver = SolverExplicit
+	}
+	c.axialConduction = calCfg.AxialConduction
+	c.reductionWindow = defaultReductionWindow()
+
 	// 初始化推送消息通道
 	c.calcHub = NewCalcHub()
 	if e == nil {
@@ -80,7 +117,9 @@ func NewCalculatorWithArrDeque(e executor) *calculatorWithArrDeque {
 	} else {
 		c.e = e
 	}
-	c.e.run(c) // 启动master线程分配任务，启动worker线程执行任务
+	var ctx context.Context
+	ctx, c.stopExecutor = context.WithCancel(context.Background())
+	c.e.run(ctx, c) // 启动master线程分配任务，启动worker线程执行任务，计算器关闭时退出
 
 	c.runningState = stateNotRunning // 未开始运行，只是完成初始化
 
@@ -96,15 +135,23 @@ func (c *calculatorWithArrDeque) GetCastingMachine() *CastingMachine {
 	return c.castingMachine
 }
 
-func (c *calculatorWithArrDeque) InitSteel(steelValue int, castingMachine *CastingMachine) {
-	if c.runningState == stateRunning { // 如果此时有其他钢种正在计算，只有当拉尾坯模式将前一个铸坯全部移除铸机后，isRunning状态才会变为false
-		// todo
-	} else if c.runningState == stateSuspended {
-		// todo
-	} else {
+func (c *calculatorWithArrDeque) InitSteel(steelValue int, castingMachine *CastingMachine) error {
+	if _, err := getSteelGrade(steelValue); err != nil {
+		return err
+	}
+	if c.runningState == stateNotRunning {
 		// 还未运行
-		c.steel1 = NewSteel(steelValue, castingMachine)
+		steel, err := NewSteel(steelValue, castingMachine)
+		if err != nil {
+			return err
+		}
+		c.steelMu.Lock()
+		c.steel1 = steel
+		c.steelMu.Unlock()
+		return nil
 	}
+	// 铸机内还有铸坯时，按默认混浇长度进行钢种切换
+	return c.ChangeSteel(steelValue, DefaultMixingLength)
 }
 
 func (c *calculatorWithArrDeque) InitPushData(coordinate model.Coordinate) {
@@ -119,12 +166,35 @@ func (c *calculatorWithArrDeque) getParameter(z int) *Parameter {
 		c.steel1.SetParameter(z)
 		return c.steel1.Parameter
 	} else if c.runningState == stateRunningWithTwoSteel { // 处理两种钢种的情况
-		// todo
-		// return
+		steel := c.getSteel(z)
+		steel.SetParameter(z)
+		return steel.Parameter
 	}
 	return nil
 }
 
+// 开始运行，钢种切换尚未完成时继续按两种钢种计算
+func (c *calculatorWithArrDeque) setRunning() {
+	if c.transition != nil {
+		c.runningState = stateRunningWithTwoSteel
+	} else {
+		c.runningState = stateRunning
+	}
+}
+
+// 关闭计算器，停止计算、推送和 executor 的所有协程
+func (c *calculatorWithArrDeque) Close() {
+	if c.calcHub != nil {
+		c.calcHub.Close()
+	}
+	// 等待 Run 算完当前的时间步长后退出，再停止 executor，避免 worker 在计算中途退出
+	c.runMu.Lock()
+	if c.stopExecutor != nil {
+		c.stopExecutor()
+	}
+	c.runMu.Unlock()
+}
+
 func (c *calculatorWithArrDeque) GetCalcHub() *CalcHub {
 	return c.calcHub
 }
@@ -183,7 +253,7 @@ func (c *calculatorWithArrDeque) calculateQOffline() {
 			initialQ := 1 / (ROfWater(3000.0, 0.005, float64(averageTemp)) + ROfCu() + 1/2220.0) * (item[Width/YStep-1][0] - averageTemp)
 			j := 0
 			for ; j < Length/XStep; j++ {
-				if item[Width/YStep-1][j] > c.steel1.LiquidPhaseTemperature {
+				if item[Width/YStep-1][j] > c.getSteel(z).LiquidPhaseTemperature {
 					c.steel1.Parameter.Q[z][j] = initialQ
 				} else {
 					break
@@ -195,7 +265,7 @@ func (c *calculatorWithArrDeque) calculateQOffline() {
 			}
 			i := 0
 			for ; i < Width/YStep; i++ {
-				if item[i][Length/XStep-1] > c.steel1.LiquidPhaseTemperature {
+				if item[i][Length/XStep-1] > c.getSteel(z).LiquidPhaseTemperature {
 					c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-i] = initialQ
 				} else {
 					break
@@ -218,7 +288,7 @@ func (c *calculatorWithArrDeque) calculateWideSurfaceEnergy(wideSurfaceH float32
 		initialQ = 1 / (ROfWater(3000.0, 0.005, float64(averageTemp)) + ROfCu() + 1/wideSurfaceH) * (item[Width/YStep-1][0] - averageTemp)
 		j := 0
 		for ; j < Length/XStep; j++ {
-			if item[0][j] > c.steel1.LiquidPhaseTemperature {
+			if item[centerRow()][j] > c.getSteel(z).LiquidPhaseTemperature {
 				c.steel1.Parameter.Q[z][j] = initialQ
 				wideSurfaceEnergy += c.steel1.Parameter.Q[z][j] * float32(XStep*ZStep) / 1e6
 			} else {
@@ -239,20 +309,22 @@ func (c *calculatorWithArrDeque) calculateNarrowSurfaceEnergy(narrowSurfaceH flo
 	var initialQ float32
 	averageTemp := (c.castingMachine.CoolerConfig.NarrowSurfaceIn + c.castingMachine.CoolerConfig.NarrowSurfaceOut) / 2
 	c.Field.Traverse(func(z int, item *model.ItemType) {
-		initialQ = 1 / (ROfWater(3000.0, 0.005, float64(averageTemp)) + ROfCu() + 1/narrowSurfaceH) * (item[0][Length/XStep-1] - averageTemp)
+		// 只计算厚度中心线到内弧一侧的窄面，半断面时外弧一侧由 mirrorQOnlineAtMd 对称得到
+		off, rows := centerRow(), quarterRows()
+		initialQ = 1 / (ROfWater(3000.0, 0.005, float64(averageTemp)) + ROfCu() + 1/narrowSurfaceH) * (item[off][Length/XStep-1] - averageTemp)
 		i := 0
-		for ; i < Width/YStep; i++ {
-			if item[i][0] > c.steel1.LiquidPhaseTemperature {
-				c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-i] = initialQ
-				narrowSurfaceEnergy += c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-i] * float32(YStep*ZStep) / 1e6
+		for ; i < rows; i++ {
+			if item[off+i][0] > c.getSteel(z).LiquidPhaseTemperature {
+				c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-off-i] = initialQ
+				narrowSurfaceEnergy += c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-off-i] * float32(YStep*ZStep) / 1e6
 			} else {
 				break
 			}
 		}
 		start := i - 1
-		for ; i < Width/YStep; i++ {
-			c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-i] = initialQ - (initialQ * 0.7 * (float32((i-start)*YStep) - float32(YStep)/2) / float32((Width/YStep-1-start)*YStep))
-			narrowSurfaceEnergy += c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-i] * float32(YStep*ZStep) / 1e6
+		for ; i < rows; i++ {
+			c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-off-i] = initialQ - (initialQ * 0.7 * (float32((i-start)*YStep) - float32(YStep)/2) / float32((rows-1-start)*YStep))
+			narrowSurfaceEnergy += c.steel1.Parameter.Q[z][Length/XStep+Width/YStep-1-off-i] * float32(YStep*ZStep) / 1e6
 		}
 	}, 0, (c.castingMachine.Coordinate.MdLength-int(c.castingMachine.Coordinate.LevelHeight))/ZStep)
 	return narrowSurfaceEnergy
@@ -314,9 +386,23 @@ func (c *calculatorWithArrDeque) calculateQOnlineAtMd() {
 		}
 	}
 	fmt.Println("targetNarrowSurfaceEnergy:", targetNarrowSurfaceEnergy, "narrowSurfaceEnergy:", c.calculateNarrowSurfaceEnergy(narrowSurfaceH), narrowSurfaceH)
+	c.mirrorQOnlineAtMd()
 	fmt.Println("计算结晶器热流密度所需时间：", time.Since(start).Milliseconds())
 }
 
+// 半断面时结晶器内外弧铜板的冷却条件相同，外弧宽面的热流密度与内弧宽面相同，窄面关于厚度中心线对称
+func (c *calculatorWithArrDeque) mirrorQOnlineAtMd() {
+	if !isHalfSection() {
+		return
+	}
+	c.Field.Traverse(func(z int, item *model.ItemType) {
+		for j := 0; j < Length/XStep; j++ {
+			c.steel1.Parameter.Q[z][outerArcIndex(j)] = c.steel1.Parameter.Q[z][j]
+		}
+		mirrorNarrowFace(&c.steel1.Parameter.Q[z])
+	}, 0, (c.castingMachine.Coordinate.MdLength-int(c.castingMachine.Coordinate.LevelHeight))/ZStep)
+}
+
 // 根据二冷区冷区参数计算对应的综合换热系数
 func (c *calculatorWithArrDeque) calculateHeffOnlineAtSecondaryCoolingZone() {
 	// Hi、Hi_1 代表辊子距离结晶器液面高度
@@ -331,80 +417,17 @@ func (c *calculatorWithArrDeque) calculateHeffOnlineAtSecondaryCoolingZone() {
 	// Tma 铸坯坯壳平均温度
 	// 宽面，窄面分开计算
 	start := time.Now()
-	wideItems := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.NozzleCfg.WideItems
-	coolingZoneCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.CoolingZoneCfg
 	cooingWaterCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg
 	var envTemp = 70.0
-	var L, AB, BC, CD, DE, Ds, sprayWidth, Hbr float32
+	var AB, BC, CD, DE, Ds, sprayWidth, Hbr float32
 	var Deformation, centerRollersDistance, v, Si_1, Tm, Tma, S, Volume, T, R0, Ts_ float64
-	var preDistance = float32(c.castingMachine.Coordinate.MdLength) - c.castingMachine.Coordinate.LevelHeight
+	var preDistance float32
 	var curDistance float32
 	var startSliceIndex, endSliceIndex int
-	// 计算宽面
-	for _, item := range wideItems {
-		if c.Field.Size() < int(preDistance)/ZStep {
-			break
-		}
-		// step1. 计算平均综合换热系数
-		Ds = item.CenterSpraySection.Thickness // 喷淋厚度
-		L = item.RollerDistance
-		centerRollersDistance = float64(item.RollerDistance / 10.0)
-		AB = (L - Ds) / 2.0
-		v = float64(c.castingMachine.CoolerConfig.V) / 10.0 * 60.0                                             // 拉速 mm/s -> cm/min
-		Si_1 = float64(c.calculateSolidThickness(preDistance, "Wide"))                                         // 计算当前辊子处对应的坯壳厚度
-		Tm = float64(c.steel1.LiquidPhaseTemperature)                                                          // 液相线温度
-		Tma = float64(c.calculateTma(preDistance, "Wide"))                                                     // 坯壳平均温度
-		Deformation = calculateDeformation(centerRollersDistance, v, float64(item.Distance/10), Si_1, Tm, Tma) // 计算鼓肚量
-		DE = calculateDE(float64(item.InnerDiameter/10), float64(item.OuterDiameter/10), Deformation)          // 计算辊子直接接触宽度
-		BC = Ds
-		CD = AB - DE
-		sprayWidth = min(item.CenterSpraySection.RightLimit-item.CenterSpraySection.LeftLimit, float32(c.castingMachine.Coordinate.Length)) // 喷淋宽度
-		Ts_ = float64(c.calculateTs(preDistance, "Wide"))                                                                                   // 辊子对应铸坯表面平均温度
-		Hbr = calculateHbr(Ts_, envTemp, c.steel1.Parameter)                                                                                // 计算空气换热系数
-		S = float64(sprayWidth*Ds) / 1e6                                                                                                    // 喷淋面积
-		Volume = float64(cooingWaterCfg[item.CoolingZone-1].InnerArcWaterVolume / float32(coolingZoneCfg[item.CoolingZone-1].End-coolingZoneCfg[item.CoolingZone-1].Start+1) / 60.0)
-		R0 = float64(item.InnerDiameter) / 2.0 / 10.0         // 辊子半径
-		T = float64(c.calculateT(preDistance, item.Distance)) // 计算喷淋区域平均温度
-		// step2. 确定辊间距对应影响的切片范围，然后更新
-		curDistance = item.Distance
-		startSliceIndex = int(preDistance / float32(ZStep))
-		endSliceIndex = int(curDistance / float32(ZStep))
-		preDistance = curDistance
-		hci := calculateHci(Hbr, calculateHsr(R0, float64(DE), Ts_), L, DE)
-		if cooingWaterCfg[item.CoolingZone-1].InnerArcWaterVolume == 0.0 {
-			for z := startSliceIndex; z < endSliceIndex; z++ {
-				for j := 0; j < Length/XStep; j++ {
-					c.steel1.Parameter.Heff[z][j] = hci
-				}
-				continue
-			}
-		}
-		heff := calculateAverageHeffHelper(L, AB, BC, CD, DE, Hbr, item.Medium, S, Volume, T, float64(Ds), R0, Ts_) // 计算平均综合换热系数
-		Volume1 := float64(cooingWaterCfg[item.CoolingZone-1].Fuqie1Volume / float32(coolingZoneCfg[item.CoolingZone-1].End-coolingZoneCfg[item.CoolingZone-1].Start+1) / 60.0)
-		heff1 := calculateAverageHeffHelper(L, AB, BC, CD, DE, Hbr, item.Medium, S, Volume1, T, float64(Ds), R0, Ts_) // 计算幅切1平均综合换热系数
-		Volume2 := float64(cooingWaterCfg[item.CoolingZone-1].Fuqie2Volume / float32(coolingZoneCfg[item.CoolingZone-1].End-coolingZoneCfg[item.CoolingZone-1].Start+1) / 60.0)
-		heff2 := calculateAverageHeffHelper(L, AB, BC, CD, DE, Hbr, item.Medium, S, Volume2, T, float64(Ds), R0, Ts_)                         // 计算幅切2平均综合换热系数
-		sprayWidth1 := min(item.AlterSpraySection1.RightLimit-item.AlterSpraySection1.LeftLimit, float32(c.castingMachine.Coordinate.Length)) // 幅切1喷淋宽度
-		sprayWidth2 := min(item.AlterSpraySection2.RightLimit-item.AlterSpraySection2.LeftLimit, float32(c.castingMachine.Coordinate.Length)) // 幅切2喷淋宽度
-		log.Info("宽面平均综合换热系数：", heff, heff1, heff2, hci)
-		for z := startSliceIndex; z < endSliceIndex; z++ {
-			// 中心喷淋区
-			for j := 0; j < int(sprayWidth/2)/XStep; j++ {
-				c.steel1.Parameter.Heff[z][j] = heff
-			}
-			// 幅切1
-			for j := int(sprayWidth/2) / XStep; j < int(sprayWidth1/2)/XStep; j++ {
-				c.steel1.Parameter.Heff[z][j] = heff1
-			}
-			// 幅切2
-			for j := int(sprayWidth1/2) / XStep; j < int(sprayWidth2/2)/XStep; j++ {
-				c.steel1.Parameter.Heff[z][j] = heff2
-			}
-			// 自然冷却区
-			for j := int(sprayWidth2/2) / XStep; j < Length/XStep; j++ {
-				c.steel1.Parameter.Heff[z][j] = hci
-			}
-		}
+	// 计算宽面，半断面时内外弧宽面分别计算
+	c.calculateWideHeffAtSecondaryCoolingZone("Wide")
+	if isHalfSection() {
+		c.calculateWideHeffAtSecondaryCoolingZone("Outer")
 	}
 	// 计算窄面, 逻辑比较相似，但是有些不一样，因此还是分开处理
 	// 如果分区存在喷淋冷却则按照宽面的思路计算，否则，只计算空冷
@@ -427,7 +450,7 @@ func (c *calculatorWithArrDeque) calculateHeffOnlineAtSecondaryCoolingZone() {
 		AB = (W - Ds) / 2.0
 		v = float64(c.castingMachine.CoolerConfig.V) / 10.0 * 60.0                                                                 // 拉速 mm/s -> cm/min
 		Si_1 = float64(c.calculateSolidThickness(preDistance, "Narrow"))                                                           // 计算当前辊子处对应的坯壳厚度
-		Tm = float64(c.steel1.LiquidPhaseTemperature)                                                                              // 液相线温度
+		Tm = float64(c.steelAt(preDistance).LiquidPhaseTemperature)                                                                // 液相线温度
 		Tma = float64(c.calculateTma(preDistance, "Narrow"))                                                                       // 坯壳平均温度
 		Deformation = calculateDeformation(centerRollersDistance, v, float64((preDistance+item.RollerDistance)/10), Si_1, Tm, Tma) // 计算鼓肚量
 		DE = calculateDE(float64(item.Diameter/10), float64(item.Diameter/10), Deformation)                                        // 计算辊子直接接触宽度
@@ -435,11 +458,11 @@ func (c *calculatorWithArrDeque) calculateHeffOnlineAtSecondaryCoolingZone() {
 		CD = AB - DE
 		sprayWidth = min(item.SpraySection1.Width, float32(c.castingMachine.Coordinate.Width)) // 喷淋宽度
 		Ts_ = float64(c.calculateTs(preDistance, "Narrow"))                                    // 辊子对应铸坯表面平均温度
-		Hbr = calculateHbr(Ts_, envTemp, c.steel1.Parameter)                                   // 计算空气换热系数
+		Hbr = calculateHbr(Ts_, envTemp, c.steelAt(preDistance).Parameter)                     // 计算空气换热系数
 		S = float64(sprayWidth*Ds) / 1e6                                                       // 喷淋面积
 		Volume = float64(cooingWaterCfg[item.CoolingZone-1].NarrowSideWaterVolume / float32(len(narrowItems)) / 60.0)
-		R0 = float64(item.Diameter) / 2.0 / 10.0                                // 辊子半径
-		T = float64(c.calculateT(preDistance, preDistance+item.RollerDistance)) // 计算喷淋区域平均温度
+		R0 = float64(item.Diameter) / 2.0 / 10.0                                          // 辊子半径
+		T = float64(c.calculateT(preDistance, preDistance+item.RollerDistance, "Narrow")) // 计算喷淋区域平均温度
 		// step2. 确定辊间距对应影响的切片范围，然后更新
 		curDistance = preDistance + item.RollerDistance
 		startSliceIndex = int(preDistance / float32(ZStep))
@@ -452,16 +475,19 @@ func (c *calculatorWithArrDeque) calculateHeffOnlineAtSecondaryCoolingZone() {
 			for i := 0; i < int(sprayWidth/2)/YStep; i++ {
 				c.steel1.Parameter.Heff[z][Length/XStep+i] = heff
 			}
-			for i := int(sprayWidth/2) / YStep; i < Width/YStep; i++ {
+			for i := int(sprayWidth/2) / YStep; i < quarterRows(); i++ {
 				c.steel1.Parameter.Heff[z][Length/XStep+i] = hci
 			}
+			if isHalfSection() {
+				mirrorNarrowFace(&c.steel1.Parameter.Heff[z])
+			}
 		}
 	}
 	startSliceIndex = int(preDistance / float32(ZStep))
 	endSliceIndex = c.Field.Size()
 	for z := startSliceIndex + 1; z < endSliceIndex; {
-		Ts_ = float64(c.calculateTs(preDistance, "Narrow"))  // 辊子对应铸坯表面平均温度
-		Hbr = calculateHbr(Ts_, envTemp, c.steel1.Parameter) // 计算空气换热系数
+		Ts_ = float64(c.calculateTs(preDistance, "Narrow"))       // 辊子对应铸坯表面平均温度
+		Hbr = calculateHbr(Ts_, envTemp, c.getSteel(z).Parameter) // 计算空气换热系数
 		log.Info("窄面Hbr: ", Hbr, "Ts_:", Ts_)
 		for i := 0; i < Width/YStep; i++ {
 			c.steel1.Parameter.Heff[z][Length/XStep+i] = Hbr
@@ -472,6 +498,92 @@ func (c *calculatorWithArrDeque) calculateHeffOnlineAtSecondaryCoolingZone() {
 	fmt.Println("计算二冷区的综合换热系数所需时间: ", time.Since(start).Milliseconds())
 }
 
+// 计算宽面的综合换热系数，pos 为 "Wide" 时计算内弧宽面，为 "Outer" 时计算外弧宽面
+func (c *calculatorWithArrDeque) calculateWideHeffAtSecondaryCoolingZone(pos string) {
+	wideItems := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.NozzleCfg.WideItems
+	coolingZoneCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.CoolingZoneCfg
+	cooingWaterCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg
+	var envTemp = 70.0
+	var L, AB, BC, CD, DE, Ds, sprayWidth, Hbr float32
+	var Deformation, centerRollersDistance, v, Si_1, Tm, Tma, S, Volume, T, R0, Ts_ float64
+	var preDistance = float32(c.castingMachine.Coordinate.MdLength) - c.castingMachine.Coordinate.LevelHeight
+	var curDistance float32
+	var startSliceIndex, endSliceIndex int
+	base := 0 // 宽面第 0 列在综合换热系数中的位置
+	if pos == "Outer" {
+		base = outerArcIndex(0)
+	}
+	for _, item := range wideItems {
+		if c.Field.Size() < int(preDistance)/ZStep {
+			break
+		}
+		waterVolume := cooingWaterCfg[item.CoolingZone-1].InnerArcWaterVolume
+		if pos == "Outer" {
+			waterVolume = cooingWaterCfg[item.CoolingZone-1].OuterArcVolume()
+		}
+		// step1. 计算平均综合换热系数
+		Ds = item.CenterSpraySection.Thickness // 喷淋厚度
+		L = item.RollerDistance
+		centerRollersDistance = float64(item.RollerDistance / 10.0)
+		AB = (L - Ds) / 2.0
+		v = float64(c.castingMachine.CoolerConfig.V) / 10.0 * 60.0                                             // 拉速 mm/s -> cm/min
+		Si_1 = float64(c.calculateSolidThickness(preDistance, pos))                                            // 计算当前辊子处对应的坯壳厚度
+		Tm = float64(c.steelAt(preDistance).LiquidPhaseTemperature)                                            // 液相线温度
+		Tma = float64(c.calculateTma(preDistance, pos))                                                        // 坯壳平均温度
+		Deformation = calculateDeformation(centerRollersDistance, v, float64(item.Distance/10), Si_1, Tm, Tma) // 计算鼓肚量
+		DE = calculateDE(float64(item.InnerDiameter/10), float64(item.OuterDiameter/10), Deformation)          // 计算辊子直接接触宽度
+		BC = Ds
+		CD = AB - DE
+		sprayWidth = min(item.CenterSpraySection.RightLimit-item.CenterSpraySection.LeftLimit, float32(c.castingMachine.Coordinate.Length)) // 喷淋宽度
+		Ts_ = float64(c.calculateTs(preDistance, pos))                                                                                      // 辊子对应铸坯表面平均温度
+		Hbr = calculateHbr(Ts_, envTemp, c.steelAt(preDistance).Parameter)                                                                  // 计算空气换热系数
+		S = float64(sprayWidth*Ds) / 1e6                                                                                                    // 喷淋面积
+		Volume = float64(waterVolume / float32(coolingZoneCfg[item.CoolingZone-1].End-coolingZoneCfg[item.CoolingZone-1].Start+1) / 60.0)
+		R0 = float64(item.InnerDiameter) / 2.0 / 10.0              // 辊子半径
+		T = float64(c.calculateT(preDistance, item.Distance, pos)) // 计算喷淋区域平均温度
+		// step2. 确定辊间距对应影响的切片范围，然后更新
+		curDistance = item.Distance
+		startSliceIndex = int(preDistance / float32(ZStep))
+		endSliceIndex = int(curDistance / float32(ZStep))
+		preDistance = curDistance
+		hci := calculateHci(Hbr, calculateHsr(R0, float64(DE), Ts_), L, DE)
+		if waterVolume == 0.0 {
+			for z := startSliceIndex; z < endSliceIndex; z++ {
+				for j := 0; j < Length/XStep; j++ {
+					c.steel1.Parameter.Heff[z][base+j] = hci
+				}
+				continue
+			}
+		}
+		heff := calculateAverageHeffHelper(L, AB, BC, CD, DE, Hbr, item.Medium, S, Volume, T, float64(Ds), R0, Ts_) // 计算平均综合换热系数
+		Volume1 := float64(cooingWaterCfg[item.CoolingZone-1].Fuqie1Volume / float32(coolingZoneCfg[item.CoolingZone-1].End-coolingZoneCfg[item.CoolingZone-1].Start+1) / 60.0)
+		heff1 := calculateAverageHeffHelper(L, AB, BC, CD, DE, Hbr, item.Medium, S, Volume1, T, float64(Ds), R0, Ts_) // 计算幅切1平均综合换热系数
+		Volume2 := float64(cooingWaterCfg[item.CoolingZone-1].Fuqie2Volume / float32(coolingZoneCfg[item.CoolingZone-1].End-coolingZoneCfg[item.CoolingZone-1].Start+1) / 60.0)
+		heff2 := calculateAverageHeffHelper(L, AB, BC, CD, DE, Hbr, item.Medium, S, Volume2, T, float64(Ds), R0, Ts_)                         // 计算幅切2平均综合换热系数
+		sprayWidth1 := min(item.AlterSpraySection1.RightLimit-item.AlterSpraySection1.LeftLimit, float32(c.castingMachine.Coordinate.Length)) // 幅切1喷淋宽度
+		sprayWidth2 := min(item.AlterSpraySection2.RightLimit-item.AlterSpraySection2.LeftLimit, float32(c.castingMachine.Coordinate.Length)) // 幅切2喷淋宽度
+		log.Info(pos, "宽面平均综合换热系数：", heff, heff1, heff2, hci)
+		for z := startSliceIndex; z < endSliceIndex; z++ {
+			// 中心喷淋区
+			for j := 0; j < int(sprayWidth/2)/XStep; j++ {
+				c.steel1.Parameter.Heff[z][base+j] = heff
+			}
+			// 幅切1
+			for j := int(sprayWidth/2) / XStep; j < int(sprayWidth1/2)/XStep; j++ {
+				c.steel1.Parameter.Heff[z][base+j] = heff1
+			}
+			// 幅切2
+			for j := int(sprayWidth1/2) / XStep; j < int(sprayWidth2/2)/XStep; j++ {
+				c.steel1.Parameter.Heff[z][base+j] = heff2
+			}
+			// 自然冷却区
+			for j := int(sprayWidth2/2) / XStep; j < Length/XStep; j++ {
+				c.steel1.Parameter.Heff[z][base+j] = hci
+			}
+		}
+	}
+}
+
 func (c *calculatorWithArrDeque) calculateQOnlineAtSecondaryCoolingZone() {
 	//start := time.Now()
 	wideAverageTemp := (c.castingMachine.CoolerConfig.WideSurfaceIn + c.castingMachine.CoolerConfig.WideSurfaceOut) / 2
@@ -483,24 +595,36 @@ func (c *calculatorWithArrDeque) calculateQOnlineAtSecondaryCoolingZone() {
 		for i := 0; i < Width/YStep; i++ {
 			c.steel1.Parameter.Q[z][Length/XStep+i] = c.steel1.Parameter.Heff[z][Length/XStep+i] * (item[i][Length/XStep-1] - narrowAverageTemp)
 		}
+		if isHalfSection() {
+			for j := 0; j < Length/XStep; j++ {
+				c.steel1.Parameter.Q[z][outerArcIndex(j)] = c.steel1.Parameter.Heff[z][outerArcIndex(j)] * (item[0][j] - wideAverageTemp)
+			}
+		}
 	}, (c.castingMachine.Coordinate.MdLength-int(c.castingMachine.Coordinate.LevelHeight))/ZStep, c.Field.Size())
 	//fmt.Println("计算综合换热系数所需时间：", time.Since(start).Milliseconds())
 }
 
+// 辊子处（前一个切片）对应的钢种
+func (c *calculatorWithArrDeque) steelAt(distance float32) *Steel {
+	return c.getSteel(int(distance/float32(ZStep)) - 1)
+}
+
 // 计算辊子对应铸坯坯壳平均温度
 func (c *calculatorWithArrDeque) calculateTma(distance float32, pos string) float32 {
 	// 前一个辊子
 	sliceIndex := int(distance/float32(ZStep)) - 1
 	slice := c.Field.GetSlice(sliceIndex)
+	liquidTemp := c.getSteel(sliceIndex).LiquidPhaseTemperature
 	var sum float32
-	if pos == "Wide" {
+	if pos == "Wide" || pos == "Outer" {
+		row := wideSurfaceRow(pos)
 		for i := 0; i < Length/XStep; i++ {
-			sum += (c.steel1.LiquidPhaseTemperature + slice[Width/YStep-1][i]) / 2.0
+			sum += (liquidTemp + slice[row][i]) / 2.0
 		}
 		return sum / float32(Length/XStep)
 	} else {
 		for i := 0; i < Width/YStep; i++ {
-			sum += (c.steel1.LiquidPhaseTemperature + slice[i][Length/XStep-1]) / 2.0
+			sum += (liquidTemp + slice[i][Length/XStep-1]) / 2.0
 		}
 		return sum / float32(Width/YStep)
 	}
@@ -512,9 +636,10 @@ func (c *calculatorWithArrDeque) calculateTs(distance float32, pos string) float
 	sliceIndex := int(distance/float32(ZStep)) - 1
 	slice := c.Field.GetSlice(sliceIndex)
 	var sum float32
-	if pos == "Wide" {
+	if pos == "Wide" || pos == "Outer" {
+		row := wideSurfaceRow(pos)
 		for i := 0; i < Length/XStep; i++ {
-			sum += slice[Width/YStep-1][i]
+			sum += slice[row][i]
 		}
 		return sum / float32(Length/XStep)
 	} else {
@@ -525,15 +650,24 @@ func (c *calculatorWithArrDeque) calculateTs(distance float32, pos string) float
 	}
 }
 
+// 宽面所在的行，pos 为 "Outer" 时为外弧宽面，否则为内弧宽面
+func wideSurfaceRow(pos string) int {
+	if pos == "Outer" {
+		return 0
+	}
+	return Width/YStep - 1
+}
+
 // 计算喷淋区域平均温度
-func (c *calculatorWithArrDeque) calculateT(preDistance, distance float32) float32 {
+func (c *calculatorWithArrDeque) calculateT(preDistance, distance float32, pos string) float32 {
 	startIndex := int(preDistance/float32(ZStep)) - 1
 	endIndex := int(distance / float32(ZStep))
+	row := wideSurfaceRow(pos)
 	var sum float32
 	var count int
 	c.Field.Traverse(func(z int, item *model.ItemType) {
 		for j := 0; j < Length/XStep; j++ {
-			sum += item[Width/XStep-1][j]
+			sum += item[row][j]
 			count++
 		}
 	}, startIndex, endIndex)
@@ -555,12 +689,12 @@ func (c *calculatorWithArrDeque) calculateSolidThickness(distance float32, pos s
 	// 前一个辊子
 	sliceIndex := int(distance/float32(ZStep)) - 1
 	slice := c.Field.GetSlice(sliceIndex)
-	liquidTemp := c.steel1.LiquidPhaseTemperature
+	liquidTemp := c.getSteel(sliceIndex).LiquidPhaseTemperature
 	var sum, count float32
 	if pos == "Wide" {
 		for i := 0; i < Length/XStep; i++ {
 			count = 0
-			for j := Width/YStep - 1; j >= 0; j-- {
+			for j := Width/YStep - 1; j >= centerRow(); j-- {
 				if slice[j][i] <= liquidTemp {
 					count++
 				} else {
@@ -571,6 +705,19 @@ func (c *calculatorWithArrDeque) calculateSolidThickness(distance float32, pos s
 		}
 		//fmt.Println("calculateSolidThickness wide: ", sum, float32(Length/XStep))
 		return sum / float32(Length/XStep)
+	} else if pos == "Outer" {
+		for i := 0; i < Length/XStep; i++ {
+			count = 0
+			for j := 0; j < centerRow(); j++ {
+				if slice[j][i] <= liquidTemp {
+					count++
+				} else {
+					break
+				}
+			}
+			sum += count * float32(YStep)
+		}
+		return sum / float32(Length/XStep)
 	} else {
 		for i := 0; i < Width/YStep; i++ {
 			count = 0
@@ -591,7 +738,7 @@ func (c *calculatorWithArrDeque) calculateSolidThickness(distance float32, pos s
 // 计算综合换热系数
 func (c *calculatorWithArrDeque) calculateHeffOnlineAtMd() {
 	//start := time.Now()
-	if c.runningState == stateRunning {
+	if c.runningState == stateRunning || c.runningState == stateRunningWithTwoSteel {
 		c.Field.Traverse(func(z int, item *model.ItemType) {
 			for j := 0; j < Length/XStep; j++ {
 				c.steel1.Parameter.Heff[z][j] = c.steel1.Parameter.Q[z][j] / (item[Width/YStep-1][j] - c.castingMachine.CoolerConfig.WideSurfaceIn)
@@ -599,15 +746,22 @@ func (c *calculatorWithArrDeque) calculateHeffOnlineAtMd() {
 			for i := 0; i < Width/YStep; i++ {
 				c.steel1.Parameter.Heff[z][Length/XStep+i] = c.steel1.Parameter.Q[z][Length/XStep+i] / (item[i][Length/XStep-1] - c.castingMachine.CoolerConfig.NarrowSurfaceIn)
 			}
+			if isHalfSection() {
+				for j := 0; j < Length/XStep; j++ {
+					c.steel1.Parameter.Heff[z][outerArcIndex(j)] = c.steel1.Parameter.Q[z][outerArcIndex(j)] / (item[0][j] - c.castingMachine.CoolerConfig.WideSurfaceIn)
+				}
+			}
 		}, 0, (c.castingMachine.Coordinate.MdLength-int(c.castingMachine.Coordinate.LevelHeight))/ZStep)
 	}
 	//fmt.Println("计算综合换热系数所需时间：", time.Since(start).Milliseconds())
 }
 
 func (c *calculatorWithArrDeque) Run() {
-	c.runningState = stateRunning
-	// 先计算timeStep
-	var duration, calcDuration, gap time.Duration
+	stop := c.calcHub.StopChan()
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+	c.setRunning()
+	var duration time.Duration
 	var deltaT float32
 LOOP:
 	for {
@@ -615,42 +769,20 @@ LOOP:
 		//	return
 		//}
 		select {
-		case <-c.calcHub.Stop:
+		case <-stop:
+			c.runningState = stateSuspended
+			break LOOP
+		case <-c.calcHub.Done():
 			c.runningState = stateSuspended
 			break LOOP
 		default:
-			if c.Field.Size() == 0 { // 计算时间等于0，意味着还没有切片产生，此时可以等待产生一个切片再计算
-				log.Info("切片数为0，此时直接生成一个切片")
-				duration += OneSliceDuration
-				gap = OneSliceDuration
-				deltaT = float32(OneSliceDuration.Seconds())
-			} else {
-				c.calculateQAndHeffOnline()
+			deltaT = c.step()
+			duration += time.Duration(int64(deltaT * 1e9))
+			if !c.Field.IsEmpty() {
 				fmt.Println("Q: ", c.steel1.Parameter.Q[c.Field.Size()-1][:Length/XStep])
 				fmt.Println("Q: ", c.steel1.Parameter.Q[c.Field.Size()-1][Length/XStep:Length/XStep+Width/YStep])
 				fmt.Println("Heff: ", c.steel1.Parameter.Heff[c.Field.Size()-1][:Length/XStep])
 				fmt.Println("Heff: ", c.steel1.Parameter.Heff[c.Field.Size()-1][Length/XStep:Length/XStep+Width/YStep])
-				deltaT, _ = c.calculateTimeStep()
-				calcDuration = c.e.dispatchTask(deltaT, 0, c.Field.Size()) // c.ThermalField.Field 最开始赋值为 ThermalField对应的指针
-				fmt.Println("计算单次时间：", calcDuration.Milliseconds(), "ms")
-				gap = time.Duration(int64(deltaT*1e9)) - calcDuration
-				if gap < 0 {
-					gap = 0
-				}
-				duration += time.Duration(int64(deltaT * 1e9))
-			}
-
-			fmt.Println("时间步长: ", deltaT, gap, duration)
-			// todo 加速计算过程
-			//time.Sleep(gap)
-			if c.alternating {
-				c.Field = c.thermalField1
-			} else {
-				c.Field = c.thermalField
-			}
-
-			c.updateSliceInfo(time.Duration(int64(deltaT * 1e9)))
-			if !c.Field.IsEmpty() {
 				for i := Width/YStep - 1; i >= 0; i-- {
 					for j := 0; j <= Length/XStep-1; j++ {
 						fmt.Printf("%.2f ", c.Field.Get(c.Field.Size()-1, i, j))
@@ -658,9 +790,9 @@ LOOP:
 					fmt.Println()
 				}
 			}
-			c.alternating = !c.alternating // 仅在这里修改
 			log.WithFields(log.Fields{"deltaT": deltaT, "cost": duration.Milliseconds()}).Info("计算一次")
 			if duration > time.Second*4 {
+				c.checkAlarms()
 				c.calcHub.PushSignal()
 				duration = time.Second * 0
 			}
@@ -668,32 +800,89 @@ LOOP:
 	}
 }
 
+// 离线批量计算：不等待也不推送，直到模拟时间达到 duration，返回实际模拟的时间
+func (c *calculatorWithArrDeque) RunFor(duration time.Duration) time.Duration {
+	c.setRunning()
+	var simulated time.Duration
+	for simulated < duration {
+		simulated += time.Duration(int64(c.step() * 1e9))
+	}
+	c.runningState = stateSuspended
+	return simulated
+}
+
+// 推进一个时间步长：计算边界条件、时间步长和温度场，再更新切片，返回本次的时间步长
+func (c *calculatorWithArrDeque) step() float32 {
+	var calcDuration, gap time.Duration
+	var deltaT float32
+	c.applySteelChange()
+	c.applyControlChange()
+	c.applyOptionChange()
+	if c.Field.Size() == 0 { // 计算时间等于0，意味着还没有切片产生，此时可以等待产生一个切片再计算
+		log.Info("切片数为0，此时直接生成一个切片")
+		gap = OneSliceDuration
+		deltaT = float32(OneSliceDuration.Seconds())
+	} else {
+		c.calculateQAndHeffOnline()
+		if c.solver == SolverADI {
+			deltaT = adiTimeStep()
+		} else {
+			deltaT, _ = c.calculateTimeStep()
+		}
+		calcDuration = c.e.dispatchTask(deltaT, 0, c.Field.Size()) // c.ThermalField.Field 最开始赋值为 ThermalField对应的指针
+		if c.axialConduction {
+			c.conductAxially(deltaT, 0, c.Field.Size(), c.targetField())
+		}
+		fmt.Println("计算单次时间：", calcDuration.Milliseconds(), "ms")
+		gap = time.Duration(int64(deltaT*1e9)) - calcDuration
+		if gap < 0 {
+			gap = 0
+		}
+	}
+
+	fmt.Println("时间步长: ", deltaT, gap)
+	// todo 加速计算过程
+	//time.Sleep(gap)
+	if c.alternating {
+		c.Field = c.thermalField1
+	} else {
+		c.Field = c.thermalField
+	}
+
+	c.updateSliceInfo(time.Duration(int64(deltaT * 1e9)))
+	c.controlCooling()
+	c.checkTransition()
+	c.alternating = !c.alternating // 仅在这里修改
+	return deltaT
+}
+
 func (c *calculatorWithArrDeque) updateSliceInfo(calcDuration time.Duration) {
 	v := c.castingMachine.CoolerConfig.V // m/min -> mm/s
 	var distance int64
 	distance = v*calcDuration.Microseconds() + c.reminder
+	// 铸机内已有的切片按本次的拉速前进
+	c.advanceSlices(calcDuration, v)
 	//fmt.Println("走过的距离: ", distance, c.v, calcDuration)
 	if distance == 0 {
 		return
 	}
+	reminder := c.reminder
 	c.reminder = distance % 1e7 // Microseconds = 1e6 and zStep = 10
 	newSliceNum := distance / 1e7
-	add := int(newSliceNum) // 加入的新切片数
+	add := int(newSliceNum)                                          // 加入的新切片数
+	defer c.trackNewSlices(add, reminder, distance, calcDuration, v) // 新切片加入后再设置生成时间和走过的距离
 	if c.isTail {
 		// 处理拉尾坯的阶段
 		log.Info("updateSliceInfo: 拉尾坯")
 		for i := 0; i < add; i++ {
 			if c.Field.IsFull() {
-				c.thermalField.RemoveLast()
-				c.thermalField.AddFirst(-1) // 使用-1代表该切片是空的
-				c.thermalField1.RemoveLast()
-				c.thermalField1.AddFirst(-1)
+				c.removeLastSlice()
+				c.addFirstSlice(-1) // 使用-1代表该切片是空的
 				// 当没有温度不为空的切片时，需要退出
 				// 需要结合有没有新的钢种注入
 				// 遍历时需要跳过为空的切片
 			} else {
-				c.thermalField.AddFirst(-1)
-				c.thermalField1.AddFirst(-1)
+				c.addFirstSlice(-1)
 			}
 			if c.start < c.end {
 				c.start++
@@ -707,22 +896,17 @@ func (c *calculatorWithArrDeque) updateSliceInfo(calcDuration time.Duration) {
 		log.Info("updateSliceInfo: 切片已满")
 		// 新加入的切片未组成一个三维数组
 		for i := 0; i < add; i++ {
-			c.thermalField.RemoveLast()
-			c.thermalField1.RemoveLast()
-			c.thermalField.AddFirst(c.castingMachine.CoolerConfig.StartTemperature)
-			c.thermalField1.AddFirst(c.castingMachine.CoolerConfig.StartTemperature)
+			c.removeLastSlice()
+			c.addFirstSlice(c.castingMachine.CoolerConfig.StartTemperature)
 		}
 	} else {
 		log.Info("切片未满, updateSliceInfo: 新增切片数:", add)
 		for i := 0; i < add; i++ {
 			if c.Field.IsFull() {
-				c.thermalField.RemoveLast()
-				c.thermalField1.RemoveLast()
-				c.thermalField.AddFirst(c.castingMachine.CoolerConfig.StartTemperature)
-				c.thermalField1.AddFirst(c.castingMachine.CoolerConfig.StartTemperature)
+				c.removeLastSlice()
+				c.addFirstSlice(c.castingMachine.CoolerConfig.StartTemperature)
 			} else {
-				c.thermalField.AddFirst(c.castingMachine.CoolerConfig.StartTemperature)
-				c.thermalField1.AddFirst(c.castingMachine.CoolerConfig.StartTemperature)
+				c.addFirstSlice(c.castingMachine.CoolerConfig.StartTemperature)
 			}
 			if c.end < ZLength/ZStep {
 				c.end++
@@ -735,6 +919,27 @@ func (c *calculatorWithArrDeque) updateSliceInfo(calcDuration time.Duration) {
 	log.Info("updateSliceInfo 目前的切片数为：", c.Field.Size())
 }
 
+// 在弯月面处加入一个新切片，两个温度场容器和切片附加信息同步移动
+func (c *calculatorWithArrDeque) addFirstSlice(initialVal float32) {
+	c.thermalField.AddFirst(initialVal)
+	c.thermalField1.AddFirst(initialVal)
+	c.sliceMeta.AddFirst(c.newSliceMeta())
+}
+
+// 在铸机末端加入一个切片，仅用于稳态计算
+func (c *calculatorWithArrDeque) addLastSlice(initialVal float32) {
+	c.thermalField.AddLast(initialVal)
+	c.thermalField1.AddLast(initialVal)
+	c.sliceMeta.AddLast(c.newSliceMeta())
+}
+
+// 移除铸机末端的切片
+func (c *calculatorWithArrDeque) removeLastSlice() {
+	c.thermalField.RemoveLast()
+	c.thermalField1.RemoveLast()
+	c.sliceMeta.RemoveLast()
+}
+
 // 计算一个left top点的温度变化
 func (c *calculatorWithArrDeque) calculatePointLT(deltaT float32, z int, slice *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) {
 	var index = int(slice[Width/YStep-1][0]) - 1
@@ -852,7 +1057,8 @@ func (c *calculatorWithArrDeque) calculatePointRB(deltaT float32, z int, slice *
 
 	var deltaHrb = getLambda(index, index1, Length/XStep-1, 0, Length/XStep-2, 0, parameter, zone, electromagneticStirringFactor)*(slice[0][Length/XStep-1]-slice[0][Length/XStep-2])/(stdXStep*(getEx(Length/XStep-2)+getEx(Length/XStep-1))) +
 		getLambda(index, index2, Length/XStep-1, 0, Length/XStep-1, 1, parameter, zone, electromagneticStirringFactor)*(slice[0][Length/XStep-1]-slice[1][Length/XStep-1])/(stdYStep*(getEy(1)+getEy(0))) +
-		parameter.GetQ(Length/XStep-1, 0, z)/(2*stdXStep)
+		parameter.GetQ(Length/XStep-1, 0, z)/(2*stdXStep) +
+		outerArcQ(parameter, Length/XStep-1, z)
 	deltaHrb = deltaHrb * (2 * deltaT / parameter.Density[index])
 
 	//fmt.Println(
@@ -878,7 +1084,8 @@ func (c *calculatorWithArrDeque) calculatePointBA(deltaT float32, x, z int, slic
 	var index3 = int(slice[1][x]) - 1
 	var deltaHba = getLambda(index, index1, x, 0, x-1, 0, parameter, zone, electromagneticStirringFactor)*(slice[0][x]-slice[0][x-1])/(stdXStep*(getEx(x-1)+getEx(x))) +
 		getLambda(index, index2, x, 0, x+1, 0, parameter, zone, electromagneticStirringFactor)*(slice[0][x]-slice[0][x+1])/(stdXStep*(getEx(x+1)+getEx(x))) +
-		getLambda(index, index3, x, 0, x, 1, parameter, zone, electromagneticStirringFactor)*(slice[0][x]-slice[1][x])/(stdYStep*(getEy(1)+getEy(0)))
+		getLambda(index, index3, x, 0, x, 1, parameter, zone, electromagneticStirringFactor)*(slice[0][x]-slice[1][x])/(stdYStep*(getEy(1)+getEy(0))) +
+		outerArcQ(parameter, x, z)
 	deltaHba = deltaHba * (2 * deltaT / parameter.Density[index])
 	//fmt.Println(
 	//	getLambda(index, index1, x, 0, x-1, 0, parameter)*(slice[0][x]-slice[0][x-1])/(stdXStep*(getEx(x-1)+getEx(x))),
@@ -901,7 +1108,8 @@ func (c *calculatorWithArrDeque) calculatePointLB(deltaT float32, z int, slice *
 	var index1 = int(slice[0][1]) - 1
 	var index2 = int(slice[1][0]) - 1
 	var deltaHlb = getLambda(index, index1, 1, 0, 0, 0, parameter, zone, electromagneticStirringFactor)*(slice[0][0]-slice[0][1])/(stdXStep*(getEx(0)+getEx(1))) +
-		getLambda(index, index2, 0, 1, 0, 0, parameter, zone, electromagneticStirringFactor)*(slice[0][0]-slice[1][0])/(stdYStep*(getEy(1)+getEy(0)))
+		getLambda(index, index2, 0, 1, 0, 0, parameter, zone, electromagneticStirringFactor)*(slice[0][0]-slice[1][0])/(stdYStep*(getEy(1)+getEy(0))) +
+		outerArcQ(parameter, 0, z)
 	deltaHlb = deltaHlb * (2 * deltaT / parameter.Density[index])
 	//fmt.Println(
 	//	getLambda(index, index1, 1, 0, 0, 0, parameter)*(slice[0][0]-slice[0][1])/(stdXStep*(getEx(0)+getEx(1))),
@@ -985,6 +1193,7 @@ func NewCalculatorForGenerate() *calculatorWithArrDeque {
 	// 初始化数据结构
 	c.thermalField = deque.NewArrDeque(ZLength / ZStep)
 	c.thermalField1 = deque.NewArrDeque(ZLength / ZStep)
+	c.sliceMeta = newSliceMetaDeque(ZLength / ZStep)
 	c.Field = c.thermalField
 	return c
 }
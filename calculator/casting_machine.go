@@ -2,6 +2,7 @@ package calculator
 
 import (
 	"encoding/json"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"lz/model"
 	"time"
@@ -34,6 +35,10 @@ var (
 type CastingMachine struct {
 	Coordinate   model.Coordinate // 铸机的一些尺寸配置
 	CoolerConfig model.CoolerCfg
+	WaterTables  []model.ZoneWaterTable // 二冷区水表，设置拉速时按水表设置二冷水量
+	Segments     []model.Segment        // 扇形段
+
+	speed float32 // 拉速 m/min，CoolerConfig.V 为取整后的 mm/s
 }
 
 func NewCastingMachine() *CastingMachine {
@@ -60,6 +65,27 @@ func (c *CastingMachine) SetFromJson(coordinate model.Coordinate) {
 	log.Info("铸机尺寸配置: ", c.Coordinate)
 }
 
+// 检查计算环境中的二冷水量配置，需在 SetSection 之后调用
+func CheckEnv(env model.Env) error {
+	waterCfg := env.SecondaryCoolingWaterCfg
+	if len(env.CoolingZoneCfg) > 0 && len(waterCfg) != len(env.CoolingZoneCfg) {
+		return fmt.Errorf("二冷水量配置的分区数 %d 与冷却区数 %d 不一致", len(waterCfg), len(env.CoolingZoneCfg))
+	}
+	if err := CheckWaterTables(env.WaterTables, len(waterCfg)); err != nil {
+		return err
+	}
+	for i, cfg := range waterCfg {
+		if cfg.InnerArcWaterVolume < 0 || cfg.OuterArcVolume() < 0 || cfg.NarrowSideWaterVolume < 0 || cfg.Fuqie1Volume < 0 || cfg.Fuqie2Volume < 0 {
+			return fmt.Errorf("二冷区第 %d 区的水量不能为负数", i+1)
+		}
+		// 四分之一断面只计算内弧一侧，外弧水量不起作用
+		if !isHalfSection() && cfg.OuterArcVolume() != cfg.InnerArcWaterVolume {
+			log.WithFields(log.Fields{"zone": i + 1, "inner": cfg.InnerArcWaterVolume, "outer": cfg.OuterArcVolume()}).Warn("四分之一断面计算时忽略外弧水量，如需分别设置内外弧水量请使用半断面")
+		}
+	}
+	return nil
+}
+
 func (c *CastingMachine) SetCoolerConfig(env model.Env, nozzleCfgData []byte) {
 	c.Coordinate.LevelHeight = env.LevelHeight
 	c.CoolerConfig.StartTemperature = env.StartTemperature
@@ -89,6 +115,8 @@ func (c *CastingMachine) SetCoolerConfig(env model.Env, nozzleCfgData []byte) {
 		}
 	}
 	c.CoolerConfig.SecondaryCoolingZoneCfg.CoolingZoneCfg = env.CoolingZoneCfg
+	c.WaterTables = env.WaterTables
+	c.Segments = env.Segments
 	log.WithFields(log.Fields{
 		"StartTemperature":        env.StartTemperature,
 		"NarrowSurfaceIn":         env.Md.NarrowSurfaceIn,
@@ -102,12 +130,19 @@ func (c *CastingMachine) SetCoolerConfig(env model.Env, nozzleCfgData []byte) {
 }
 
 func (c *CastingMachine) SetV(v float32) {
+	c.speed = v
 	c.CoolerConfig.V = int64(v * 1000 / 60)
 	OneSliceDuration = time.Millisecond * time.Duration(1000*float32(model.ZStep)/float32(c.CoolerConfig.V)) // 10 / c.v
 	log.WithFields(log.Fields{
 		"V":                c.CoolerConfig.V,
 		"oneSliceDuration": OneSliceDuration.Milliseconds(),
 	}).Info("设置拉速")
+	c.applyWaterTables()
+}
+
+// 拉速 m/min
+func (c *CastingMachine) Speed() float32 {
+	return c.speed
 }
 
 // 冷却器参数单独设置
@@ -132,6 +167,10 @@ func (c *CastingMachine) SetWideSurfaceOut(wideSurfaceOut float32) {
 }
 
 // 获取在那个冷却区
+//
+// 求解器（导热修正系数 K、时间步长和表面的边界温度）使用的原有划分：切片下标按推送数据的缩放比例 StepZ 换算为距离，
+// 并与包含液面高度的结晶器长度比较，与切片距弯月面的实际距离不一致。为了不改变求解器已有的计算结果而保留，
+// 按冷却区统计或控制的功能（二冷动态控制、水量优化、报警）都使用 SliceZone
 func (c *CastingMachine) WhichZone(z int) int {
 	z = z * model.ZStep / StepZ // stepZ代表Z方向的缩放比例
 	if z <= c.Coordinate.MdLength {
@@ -146,6 +185,22 @@ func (c *CastingMachine) WhichZone(z int) int {
 	return -1
 }
 
+// 温度场中第 z 个切片所在的冷却区，按切片距弯月面的距离划分，与二冷区综合换热系数的计算保持一致。
+// 冷却区的水量只影响这一划分下的综合换热系数，因此按冷却区统计表面温度时只能使用这一划分，不能使用 WhichZone
+func (c *CastingMachine) SliceZone(z int) int {
+	distance := float32(z * ZStep)
+	if distance < float32(c.Coordinate.MdLength)-c.Coordinate.LevelHeight {
+		return Zone0
+	}
+	coolingZoneCfg := c.CoolerConfig.SecondaryCoolingZoneCfg.CoolingZoneCfg
+	for i, v := range coolingZoneCfg {
+		if distance < v.EndDistance {
+			return i + 1
+		}
+	}
+	return -1
+}
+
 // 获取对应的电磁搅拌系数对换热修正系数的影响因子
 func (c *CastingMachine) GetElectromagneticStirringFactor(z int) float32 {
 	wideItems := c.CoolerConfig.SecondaryCoolingZoneCfg.NozzleCfg.WideItems
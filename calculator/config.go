@@ -1,7 +1,6 @@
 package calculator
 
 import (
-	"fmt"
 	"gopkg.in/ini.v1"
 )
 // 暂时没用到该功能
@@ -18,15 +17,31 @@ type Config struct {
 	ArrayLength int
 
 	EdgeWidth int
+
+	PropertyInterpolation string // 物性参数插值方式：linear 或 cubic
+
+	Solver      string  // 求解器：explicit 或 adi
+	ADITimeStep float32 // ADI 的时间步长 s
+
+	Section string // 计算断面：quarter 或 half
+
+	AxialConduction bool // 是否计算拉坯方向的导热
+
+	MinMoldExitShell float32 // 结晶器出口坯壳厚度的安全下限 mm，用于计算漏钢裕量
+
+	SoftReductionStart float32 // 轻压下中心固相率窗口的下限
+	SoftReductionEnd   float32 // 轻压下中心固相率窗口的上限
 }
 
-func init() {
-	file, err := ini.Load("E:/GoWorkPlace/src/lz/conf/config.ini")
+// 读取 config.ini 中的计算器参数，需在 config.Init 之后调用
+func LoadCfg(fileName string) error {
+	file, err := ini.Load(fileName)
 	if err != nil {
-		fmt.Println("配置文件读取错误，请检查文件路径: ", err)
+		return err
 	}
 
 	loadCfg(file)
+	return nil
 }
 
 func loadCfg(file *ini.File) {
@@ -39,5 +54,19 @@ func loadCfg(file *ini.File) {
 		ZLength: file.Section("calculator").Key("ZLength").MustInt(40000),
 		ArrayLength: file.Section("calculator").Key("ArrayLength").MustInt(320),
 		EdgeWidth: file.Section("calculator").Key("EdgeWidth").MustInt(40),
+
+		PropertyInterpolation: file.Section("calculator").Key("PropertyInterpolation").In(InterpolationLinear, []string{InterpolationLinear, InterpolationMonotoneCubic}),
+
+		Solver:      file.Section("calculator").Key("Solver").In(SolverExplicit, []string{SolverExplicit, SolverADI}),
+		ADITimeStep: float32(file.Section("calculator").Key("ADITimeStep").MustFloat64(defaultADITimeStep)),
+
+		Section: file.Section("calculator").Key("Section").In(SectionQuarter, []string{SectionQuarter, SectionHalf}),
+
+		AxialConduction: file.Section("calculator").Key("AxialConduction").MustBool(false),
+
+		MinMoldExitShell: float32(file.Section("calculator").Key("MinMoldExitShell").MustFloat64(defaultMinMoldExitShell)),
+
+		SoftReductionStart: float32(file.Section("calculator").Key("SoftReductionStart").MustFloat64(defaultSoftReductionStart)),
+		SoftReductionEnd:   float32(file.Section("calculator").Key("SoftReductionEnd").MustFloat64(defaultSoftReductionEnd)),
 	}
 }
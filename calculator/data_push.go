@@ -10,6 +10,7 @@ type SlicePushDataStruct struct {
 	Start   int         `json:"start"`
 	End     int         `json:"end"`
 	Current int         `json:"current"`
+	SliceTrack
 }
 
 type TemperatureFieldData struct {
@@ -21,6 +22,8 @@ type TemperatureFieldData struct {
 	IsFull bool   `json:"is_full"` // 切片是否充满铸机
 	IsTail bool   `json:"is_tail"` // 是否拉尾坯
 	Sides  *Sides `json:"sides"`
+
+	Transition *SteelTransitionData `json:"transition,omitempty"` // 钢种切换时混浇区的位置
 }
 
 type Sides struct {
@@ -58,19 +61,30 @@ var (
 	StepX = 2
 	StepY = 1
 	StepZ = 2
-
-	width  int
-	length int
-
-	sides = &Sides{}
 )
 
 func initPushData(up, arc, down float32) {
 	UpLength, ArcLength, DownLength = up, arc, down
-	width = Width / YStep / StepY * 2
-	length = Length / XStep / StepX * 2
-	fmt.Println("pushData:", width, length, ZLength/ZStep/StepZ)
-	sides = &Sides{
+	fmt.Println("pushData:", pushWidth(), pushLength(), ZLength/ZStep/StepZ)
+}
+
+// 推送数据中端面的行数：四分之一断面关于厚度中心线对称还原为两倍，半断面不需要
+func pushWidth() int {
+	if isHalfSection() {
+		return Width / YStep / StepY
+	}
+	return Width / YStep / StepY * 2
+}
+
+// 推送数据中端面的列数，关于宽度中心线对称还原为两倍
+func pushLength() int {
+	return Length / XStep / StepX * 2
+}
+
+// 分配一份温度场推送数据。每次构建推送数据都使用新的一份，多个协程同时构建和编码时互不影响
+func newSides() *Sides {
+	width, length := pushWidth(), pushLength()
+	sides := &Sides{
 		Up:    make([][]float32, width),
 		Left:  make([][]float32, ZLength/ZStep/StepZ),
 		Right: make([][]float32, ZLength/ZStep/StepZ),
@@ -89,51 +103,71 @@ func initPushData(up, arc, down float32) {
 		sides.Front[i] = make([]float32, length)
 		sides.Back[i] = make([]float32, length)
 	}
+	return sides
+}
+
+// 切片第 y 行在推送数据中对应的两行：四分之一断面关于厚度中心线对称，半断面不需要对称，两行相同
+func pushRows(y int) (int, int) {
+	if isHalfSection() {
+		return y / StepY, y / StepY
+	}
+	width := pushWidth()
+	return width/2 + y/StepY, (width/2 - 1) - y/StepY
 }
 
 func (c *calculatorWithArrDeque) BuildData() *TemperatureFieldData {
 	fmt.Println("buildData", c.Field.Size())
 	temperatureData := &TemperatureFieldData{
-		Sides: sides,
+		Sides: newSides(),
 	}
+	length := pushLength()
 
 	//startTime := time.Now()
 	startSlice := c.Field.GetSlice(0)
 	EndSlice := c.Field.GetSlice(c.Field.Size() - 1)
 	for y := Width/YStep - 1; y >= 0; y -= StepY {
+		y1, y2 := pushRows(y)
 		for x := Length/XStep - 1; x >= 0; x -= StepX {
-			temperatureData.Sides.Up[width/2+y/StepY][length/2+x/StepX] = startSlice[y][x]
-			temperatureData.Sides.Up[(width/2-1)-y/StepY][(length/2-1)-x/StepX] = startSlice[y][x]
-			temperatureData.Sides.Up[width/2+y/StepY][(length/2-1)-x/StepX] = startSlice[y][x]
-			temperatureData.Sides.Up[(width/2-1)-y/StepY][length/2+x/StepX] = startSlice[y][x]
+			temperatureData.Sides.Up[y1][length/2+x/StepX] = startSlice[y][x]
+			temperatureData.Sides.Up[y2][(length/2-1)-x/StepX] = startSlice[y][x]
+			temperatureData.Sides.Up[y1][(length/2-1)-x/StepX] = startSlice[y][x]
+			temperatureData.Sides.Up[y2][length/2+x/StepX] = startSlice[y][x]
 		}
 	}
 
+	// 四分之一断面的外弧宽面与内弧宽面相同，半断面的外弧宽面为第 0 行
+	backRow := Width/YStep - 1
+	if isHalfSection() {
+		backRow = 0
+	}
+
 	for z := c.Field.Size() - 1; z >= 0; z -= StepZ {
 		slice := c.Field.GetSlice(z)
 		for x := Length/XStep - 1; x >= 0; x -= StepX {
 			temperatureData.Sides.Front[z/StepZ][length/2+x/StepX] = slice[Width/YStep-1][x]
 			temperatureData.Sides.Front[z/StepZ][length/2-1-x/StepX] = slice[Width/YStep-1][x]
 
-			temperatureData.Sides.Back[z/StepZ][length/2+x/StepX] = slice[Width/YStep-1][x]
-			temperatureData.Sides.Back[z/StepZ][length/2-1-x/StepX] = slice[Width/YStep-1][x]
+			temperatureData.Sides.Back[z/StepZ][length/2+x/StepX] = slice[backRow][x]
+			temperatureData.Sides.Back[z/StepZ][length/2-1-x/StepX] = slice[backRow][x]
 		}
 
 		for y := Width/YStep - 1; y >= 0; y -= StepY {
-			temperatureData.Sides.Left[z/StepZ][width/2+y/StepY] = slice[y][Length/XStep-1]
-			temperatureData.Sides.Left[z/StepZ][width/2-1-y/StepY] = slice[y][Length/XStep-1]
+			y1, y2 := pushRows(y)
+			temperatureData.Sides.Left[z/StepZ][y1] = slice[y][Length/XStep-1]
+			temperatureData.Sides.Left[z/StepZ][y2] = slice[y][Length/XStep-1]
 
-			temperatureData.Sides.Right[z/StepZ][width/2+y/StepY] = slice[y][Length/XStep-1]
-			temperatureData.Sides.Right[z/StepZ][width/2-1-y/StepY] = slice[y][Length/XStep-1]
+			temperatureData.Sides.Right[z/StepZ][y1] = slice[y][Length/XStep-1]
+			temperatureData.Sides.Right[z/StepZ][y2] = slice[y][Length/XStep-1]
 		}
 	}
 
 	for y := Width/YStep - 1; y >= 0; y -= StepY {
+		y1, y2 := pushRows(y)
 		for x := Length/XStep - 1; x >= 0; x -= StepX {
-			temperatureData.Sides.Down[width/2+y/StepY][length/2+x/StepX] = EndSlice[y][x]
-			temperatureData.Sides.Down[(width/2-1)-y/StepY][(length/2-1)-x/StepX] = EndSlice[y][x]
-			temperatureData.Sides.Down[width/2+y/StepY][(length/2-1)-x/StepX] = EndSlice[y][x]
-			temperatureData.Sides.Down[(width/2-1)-y/StepY][length/2+x/StepX] = EndSlice[y][x]
+			temperatureData.Sides.Down[y1][length/2+x/StepX] = EndSlice[y][x]
+			temperatureData.Sides.Down[y2][(length/2-1)-x/StepX] = EndSlice[y][x]
+			temperatureData.Sides.Down[y1][(length/2-1)-x/StepX] = EndSlice[y][x]
+			temperatureData.Sides.Down[y2][length/2+x/StepX] = EndSlice[y][x]
 		}
 	}
 
@@ -144,6 +178,7 @@ func (c *calculatorWithArrDeque) BuildData() *TemperatureFieldData {
 	temperatureData.End = c.end
 	temperatureData.IsFull = c.Field.IsFull()
 	temperatureData.IsTail = c.isTail
+	temperatureData.Transition = c.buildTransitionData()
 	// fmt.Println("build data cost: ", time.Since(startTime))
 	return temperatureData
 }
@@ -151,11 +186,31 @@ func (c *calculatorWithArrDeque) BuildData() *TemperatureFieldData {
 // 横切面推送数据
 func (c *calculatorWithArrDeque) BuildSliceData(index int) *SlicePushDataStruct {
 	res := SlicePushDataStruct{}
+	res.Slice = buildFullSlice(c.Field.GetSlice(index))
+	res.Start = c.getFieldStart()
+	res.End = ZLength / model.ZStep
+	res.Current = c.getFieldEnd()
+	res.SliceTrack = c.buildSliceTrack(index)
+	return &res
+}
+
+// 还原整个横切面，第 0 行为内弧宽面：四分之一断面关于宽度和厚度中心线对称还原，半断面只关于宽度中心线对称还原
+func buildFullSlice(originData *model.ItemType) [][]float32 {
+	if isHalfSection() {
+		slice := make([][]float32, Width/YStep)
+		for i := 0; i < len(slice); i++ {
+			slice[i] = make([]float32, Length/XStep*2)
+			for j := 0; j < Length/XStep; j++ {
+				slice[i][j] = originData[Width/YStep-1-i][Length/XStep-1-j]
+				slice[i][Length/XStep+j] = originData[Width/YStep-1-i][j]
+			}
+		}
+		return slice
+	}
 	slice := make([][]float32, Width/YStep*2)
 	for i := 0; i < len(slice); i++ {
 		slice[i] = make([]float32, Length/XStep*2)
 	}
-	originData := c.Field.GetSlice(index)
 	// 从右上角的四分之一还原整个二维数组
 	for i := 0; i < Width/YStep; i++ {
 		for j := 0; j < Length/XStep; j++ {
@@ -177,11 +232,7 @@ func (c *calculatorWithArrDeque) BuildSliceData(index int) *SlicePushDataStruct
 			slice[i][j] = originData[i-Width/YStep][Length/XStep-1-j]
 		}
 	}
-	res.Slice = slice
-	res.Start = c.getFieldStart()
-	res.End = ZLength / model.ZStep
-	res.Current = c.getFieldEnd()
-	return &res
+	return slice
 }
 
 // 纵切面推送数据
@@ -191,6 +242,7 @@ type SliceInfo struct {
 	HorizontalLiquidThickness int         `json:"horizontal_liquid_thickness"`
 	VerticalLiquidThickness   int         `json:"vertical_liquid_thickness"`
 	Slice                     [][]float32 `json:"slice"`
+	SliceTrack
 }
 
 func (c *calculatorWithArrDeque) GenerateSLiceInfo(index int) *SliceInfo {
@@ -198,55 +250,32 @@ func (c *calculatorWithArrDeque) GenerateSLiceInfo(index int) *SliceInfo {
 }
 
 func (c *calculatorWithArrDeque) buildSliceGenerateData(index int) *SliceInfo {
-	solidTemp := c.steel1.SolidPhaseTemperature
-	liquidTemp := c.steel1.LiquidPhaseTemperature
-	sliceInfo := &SliceInfo{}
-	slice := make([][]float32, Width/YStep*2)
-	for i := 0; i < len(slice); i++ {
-		slice[i] = make([]float32, Length/XStep*2)
-	}
+	steel := c.steels().at(index)
+	solidTemp := steel.SolidPhaseTemperature
+	liquidTemp := steel.LiquidPhaseTemperature
+	sliceInfo := &SliceInfo{SliceTrack: c.buildSliceTrack(index)}
 	originData := c.Field.GetSlice(index)
-	// 从右上角的四分之一还原整个二维数组
-	for i := 0; i < Width/YStep; i++ {
-		for j := 0; j < Length/XStep; j++ {
-			slice[i][j] = originData[Width/YStep-1-i][Length/XStep-1-j]
-		}
-	}
-	for i := 0; i < Width/YStep; i++ {
-		for j := Length / XStep; j < Length/XStep*2; j++ {
-			slice[i][j] = originData[Width/YStep-1-i][j-Length/XStep]
-		}
-	}
-	for i := Width / YStep; i < Width/YStep*2; i++ {
-		for j := Length / XStep; j < Length/XStep*2; j++ {
-			slice[i][j] = originData[i-Width/YStep][j-Length/XStep]
-		}
-	}
-	for i := Width / YStep; i < Width/YStep*2; i++ {
-		for j := 0; j < Length/XStep; j++ {
-			slice[i][j] = originData[i-Width/YStep][Length/XStep-1-j]
-		}
-	}
-	sliceInfo.Slice = slice
+	sliceInfo.Slice = buildFullSlice(originData)
 	length := Length/XStep - 1
 	width := Width/YStep - 1
 	for i := length; i >= 0; i-- {
-		if originData[0][i] <= solidTemp {
+		if originData[centerRow()][i] <= solidTemp {
 			sliceInfo.HorizontalSolidThickness = XStep * (length - i + 1)
 		}
 	}
 	for i := length; i >= 0; i-- {
-		if originData[0][i] <= liquidTemp {
+		if originData[centerRow()][i] <= liquidTemp {
 			sliceInfo.HorizontalLiquidThickness = XStep * (length - i + 1)
 		}
 	}
 
-	for j := width; j >= 0; j-- {
+	// 厚度方向为内弧一侧的坯壳厚度
+	for j := width; j >= centerRow(); j-- {
 		if originData[j][0] <= solidTemp {
 			sliceInfo.VerticalSolidThickness = YStep * (width - j + 1)
 		}
 	}
-	for j := width; j >= 0; j-- {
+	for j := width; j >= centerRow(); j-- {
 		if originData[j][0] <= liquidTemp {
 			sliceInfo.VerticalLiquidThickness = YStep * (width - j + 1)
 		}
@@ -276,11 +305,11 @@ func (c *calculatorWithArrDeque) GenerateVerticalSlice1Data() *VerticalSliceData
 		if step == 5 {
 			index = Length/XStep - 1
 			res.CenterOuter = append(res.CenterOuter, [2]float32{float32((z + 1) * model.ZStep), item[Width/YStep-1][Length/XStep-1-index]})
-			res.CenterInner = append(res.CenterInner, [2]float32{float32((z + 1) * model.ZStep), item[0][Length/XStep-1-index]})
+			res.CenterInner = append(res.CenterInner, [2]float32{float32((z + 1) * model.ZStep), item[centerRow()][Length/XStep-1-index]})
 
 			index = 0
 			res.EdgeOuter = append(res.EdgeOuter, [2]float32{float32((z + 1) * model.ZStep), item[Width/YStep-1][Length/XStep-1-index]})
-			res.EdgeInner = append(res.EdgeInner, [2]float32{float32((z + 1) * model.ZStep), item[0][Length/XStep-1-index]})
+			res.EdgeInner = append(res.EdgeInner, [2]float32{float32((z + 1) * model.ZStep), item[centerRow()][Length/XStep-1-index]})
 
 			step = 0
 		}
@@ -303,8 +332,7 @@ type Join struct {
 }
 
 func (c *calculatorWithArrDeque) GenerateVerticalSlice2Data(reqData model.VerticalReqData) *VerticalSliceData2 {
-	solidTemp := c.steel1.SolidPhaseTemperature
-	liquidTemp := c.steel1.LiquidPhaseTemperature
+	var solidTemp, liquidTemp float32
 	index := reqData.Index
 	zScale := reqData.ZScale
 	res := &VerticalSliceData2{
@@ -314,18 +342,24 @@ func (c *calculatorWithArrDeque) GenerateVerticalSlice2Data(reqData model.Vertic
 		Liquid:        make([]int, c.Field.Size()),
 	}
 
+	rows := Width / YStep * 2
+	if isHalfSection() {
+		rows = Width / YStep
+	}
 	for i := 0; i < len(res.VerticalSlice); i++ {
-		res.VerticalSlice[i] = make([]float32, Width/YStep*2)
+		res.VerticalSlice[i] = make([]float32, rows)
 	}
 
 	var temp float32
 	var solidJoinSet, liquidJoinSet bool
+	steels := c.steels()
 	step := 0
 	zIndex := 0
 	c.Field.Traverse(func(z int, item *model.ItemType) {
 		step++
 		if step == zScale {
-			for i := 0; i < Width/YStep; i++ {
+			// 半断面不需要对称，只有第 Width/YStep-1-i 个元素对应第 i 行
+			for i := 0; i < Width/YStep && !isHalfSection(); i++ {
 				res.VerticalSlice[zIndex][Width/YStep+i] = item[i][Length/XStep-1-index]
 			}
 			for i := Width/YStep - 1; i >= 0; i-- {
@@ -334,11 +368,15 @@ func (c *calculatorWithArrDeque) GenerateVerticalSlice2Data(reqData model.Vertic
 			step = 0
 			zIndex++
 		}
-		for i := 0; i < Width/YStep; i++ {
-			temp = item[i][Length/XStep-1-index]
+		solidTemp = steels.at(z).SolidPhaseTemperature
+		liquidTemp = steels.at(z).LiquidPhaseTemperature
+		// 厚度中心线到内弧宽面之间的坯壳厚度
+		off, quarter := centerRow(), quarterRows()
+		for i := 0; i < quarter; i++ {
+			temp = item[off+i][Length/XStep-1-index]
 			if temp <= solidTemp {
-				res.Solid[z] = Width/YStep - i
-				if res.Solid[z] == Width/YStep && !solidJoinSet {
+				res.Solid[z] = quarter - i
+				if res.Solid[z] == quarter && !solidJoinSet {
 					res.SolidJoin.IsJoin = true
 					res.SolidJoin.JoinIndex = z
 					solidJoinSet = true
@@ -350,11 +388,11 @@ func (c *calculatorWithArrDeque) GenerateVerticalSlice2Data(reqData model.Vertic
 			}
 		}
 
-		for i := 0; i < Width/YStep; i++ {
-			temp = item[i][Length/XStep-1-index]
+		for i := 0; i < quarter; i++ {
+			temp = item[off+i][Length/XStep-1-index]
 			if temp <= liquidTemp {
-				res.Liquid[z] = Width/YStep - i
-				if res.Liquid[z] == Width/YStep && !liquidJoinSet {
+				res.Liquid[z] = quarter - i
+				if res.Liquid[z] == quarter && !liquidJoinSet {
 					res.LiquidJoin.IsJoin = true
 					res.LiquidJoin.JoinIndex = z
 					liquidJoinSet = true
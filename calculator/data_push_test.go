@@ -0,0 +1,22 @@
+package calculator
+
+import "testing"
+
+func TestBuildDataSnapshots(t *testing.T) {
+	c := newAxialTestCalculator(t, 1000, 1200)
+	first := c.BuildData()
+	slice := c.Field.GetSlice(0)
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			slice[y][x] = 1500
+		}
+	}
+	second := c.BuildData()
+	// 每次构建的推送数据互相独立，之后的构建不会修改正在编码或发送的数据
+	if first.Sides == second.Sides {
+		t.Fatal("两次构建的推送数据不应共用同一份")
+	}
+	if first.Sides.Up[0][0] != 1000 || second.Sides.Up[0][0] != 1500 {
+		t.Fatal("推送数据的端面温度错误", first.Sides.Up[0][0], second.Sides.Up[0][0])
+	}
+}
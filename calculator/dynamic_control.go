@@ -0,0 +1,204 @@
+package calculator
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"lz/model"
+	"time"
+)
+
+// 二冷动态控制
+//
+// 每隔一个控制周期统计各冷却区内弧宽面的平均温度，与目标温度比较后按增量式 PID 调节该区的内弧水量：
+//   Δw = Kp·(e - e1) + Ki·e·Δt + Kd·(e - 2e1 + e2)/Δt，e 为平均温度与目标温度之差，e1、e2 为前两次的偏差
+// 增量式在当前水量的基础上调节，水量被限制在上下限之间时不会积分饱和，拉速变化时水表设置的水量也可以作为前馈。
+// 外弧水量单独设置时按内弧水量的比例同步调节，窄面水量不变。
+
+const (
+	defaultControlPeriod = 5.0  // 默认控制周期 s
+	maxControlHistory    = 1000 // 保留的控制动作条数
+)
+
+type dynamicController struct {
+	cfg     model.DynamicControl
+	next    time.Duration         // 下一次控制的模拟时间
+	errors  map[int][2]float32    // 每个冷却区前两次的偏差
+	history []model.ControlAction // 最近的控制动作
+}
+
+// 检查动态控制配置，zones 为二冷区的分区数
+func checkDynamicControl(cfg model.DynamicControl, zones int) error {
+	if cfg.Kp < 0 || cfg.Ki < 0 || cfg.Kd < 0 {
+		return fmt.Errorf("PID 系数不能为负数")
+	}
+	if cfg.Period < 0 {
+		return fmt.Errorf("控制周期不能为负数")
+	}
+	seen := make(map[int]bool)
+	for _, zone := range cfg.Zones {
+		if zone.Zone < 1 || zone.Zone > zones {
+			return fmt.Errorf("动态控制的冷却区编号 %d 超出范围 1-%d", zone.Zone, zones)
+		}
+		if seen[zone.Zone] {
+			return fmt.Errorf("冷却区 %d 的动态控制配置重复", zone.Zone)
+		}
+		seen[zone.Zone] = true
+		// 未设置水量上限时为 0，控制后会把该区的水量关闭
+		if zone.MaxWater <= 0 {
+			return fmt.Errorf("冷却区 %d 的水量上限必须大于 0", zone.Zone)
+		}
+		if zone.MinWater < 0 || zone.MaxWater < zone.MinWater {
+			return fmt.Errorf("冷却区 %d 的水量范围错误", zone.Zone)
+		}
+	}
+	return nil
+}
+
+// 设置二冷动态控制，Enabled 为 false 时关闭动态控制，水量保持当前值。
+// 配置检查通过后在下一个时间步长开始时生效，计算过程中不会改变正在使用的控制器
+func (c *calculatorWithArrDeque) SetDynamicControl(cfg model.DynamicControl) error {
+	zoneCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg
+	if err := checkDynamicControl(cfg, len(zoneCfg.SecondaryCoolingWaterCfg)); err != nil {
+		return err
+	}
+	if cfg.Period == 0 {
+		cfg.Period = defaultControlPeriod
+	}
+	c.controlMu.Lock()
+	c.pendingControl = &cfg
+	c.controlMu.Unlock()
+	return nil
+}
+
+// 在 Run 协程中应用等待生效的动态控制配置，每个时间步长开始时调用
+func (c *calculatorWithArrDeque) applyControlChange() {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	if c.pendingControl == nil {
+		return
+	}
+	cfg := *c.pendingControl
+	c.pendingControl = nil
+	if !cfg.Enabled {
+		c.control = nil
+		log.Info("关闭二冷动态控制")
+		return
+	}
+	zoneCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg
+	targets := make(map[string]float32)
+	for _, zone := range cfg.Zones {
+		name := fmt.Sprint(zone.Zone)
+		if zone.Zone <= len(zoneCfg.CoolingZoneCfg) && zoneCfg.CoolingZoneCfg[zone.Zone-1].ZoneName != "" {
+			name = zoneCfg.CoolingZoneCfg[zone.Zone-1].ZoneName
+		}
+		targets[name] = zone.Target
+	}
+	c.castingMachine.CoolerConfig.TargetTemperature = targets
+	c.control = &dynamicController{
+		cfg:    cfg,
+		next:   c.clock,
+		errors: make(map[int][2]float32),
+	}
+	log.WithFields(log.Fields{"cfg": cfg, "targets": targets}).Info("开启二冷动态控制")
+}
+
+// 最近的控制动作，按时间先后排列，返回副本
+func (c *calculatorWithArrDeque) ControlHistory() []model.ControlAction {
+	c.controlMu.Lock()
+	defer c.controlMu.Unlock()
+	if c.control == nil {
+		return nil
+	}
+	return append([]model.ControlAction(nil), c.control.history...)
+}
+
+// 各冷却区内弧宽面的平均温度，冷却区内没有切片时不返回该区。
+// 冷却区按 SliceZone 划分，与水量实际作用的范围一致
+func (c *calculatorWithArrDeque) zoneSurfaceTemperature() map[int]float32 {
+	sum := make(map[int]float32)
+	count := make(map[int]int)
+	row := Width/YStep - 1
+	c.Field.Traverse(func(z int, item *model.ItemType) {
+		// 跳过为空的切片， 即值为-1
+		if item[0][0] == -1 {
+			return
+		}
+		zone := c.castingMachine.SliceZone(z)
+		if zone <= Zone0 {
+			return
+		}
+		for x := 0; x < Length/XStep; x++ {
+			sum[zone] += item[row][x]
+		}
+		count[zone] += Length / XStep
+	}, 0, c.Field.Size())
+	temps := make(map[int]float32)
+	for zone, s := range sum {
+		temps[zone] = s / float32(count[zone])
+	}
+	return temps
+}
+
+// 到达控制周期时调节各冷却区的水量，并把控制动作推送给前端
+func (c *calculatorWithArrDeque) controlCooling() {
+	if c.control == nil || c.clock < c.control.next || c.Field.IsEmpty() {
+		return
+	}
+	cfg := c.control.cfg
+	c.control.next = c.clock + time.Duration(float64(cfg.Period)*float64(time.Second))
+	temps := c.zoneSurfaceTemperature()
+	waterCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg
+	var actions []model.ControlAction
+	for _, zone := range cfg.Zones {
+		temp, ok := temps[zone.Zone]
+		if !ok {
+			continue
+		}
+		e := temp - zone.Target
+		pre, seen := c.control.errors[zone.Zone]
+		if !seen {
+			pre = [2]float32{e, e} // 第一次控制时只有积分项，实现无扰切换
+		}
+		c.control.errors[zone.Zone] = [2]float32{e, pre[0]}
+		delta := cfg.Kp*(e-pre[0]) + cfg.Ki*e*cfg.Period + cfg.Kd*(e-2*pre[0]+pre[1])/cfg.Period
+
+		section := &waterCfg[zone.Zone-1]
+		preWater := section.InnerArcWaterVolume
+		water := preWater + delta
+		if water < zone.MinWater {
+			water = zone.MinWater
+		}
+		if water > zone.MaxWater {
+			water = zone.MaxWater
+		}
+		section.InnerArcWaterVolume = water
+		if section.OuterArcWaterVolume != nil && preWater > 0 {
+			outer := *section.OuterArcWaterVolume * water / preWater
+			section.OuterArcWaterVolume = &outer
+		}
+		actions = append(actions, model.ControlAction{
+			Time:        c.clock.Seconds(),
+			Zone:        zone.Zone,
+			Temperature: temp,
+			Target:      zone.Target,
+			PreWater:    preWater,
+			Water:       water,
+		})
+	}
+	if len(actions) == 0 {
+		return
+	}
+	c.controlMu.Lock()
+	c.control.history = append(c.control.history, actions...)
+	if len(c.control.history) > maxControlHistory {
+		c.control.history = c.control.history[len(c.control.history)-maxControlHistory:]
+	}
+	c.controlMu.Unlock()
+	log.WithField("actions", actions).Info("二冷动态控制")
+	// 没有前端接收时丢弃，不阻塞计算
+	select {
+	case c.calcHub.ControlActions <- actions:
+	default:
+		log.Debug("控制动作推送通道已满，丢弃本次控制动作")
+	}
+}
@@ -0,0 +1,116 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCheckDynamicControl(t *testing.T) {
+	cases := map[string]model.DynamicControl{
+		"PID 系数为负数": {Kp: -1},
+		"控制周期为负数":   {Period: -1},
+		"冷却区编号超出范围": {Zones: []model.ZoneControl{{Zone: 3, MaxWater: 10}}},
+		"冷却区重复":     {Zones: []model.ZoneControl{{Zone: 1, MaxWater: 10}, {Zone: 1, MaxWater: 10}}},
+		"水量范围错误":    {Zones: []model.ZoneControl{{Zone: 1, MinWater: 20, MaxWater: 10}}},
+		"水量上限未设置":   {Zones: []model.ZoneControl{{Zone: 1}}},
+	}
+	for name, cfg := range cases {
+		if checkDynamicControl(cfg, 2) == nil {
+			t.Fatal(name, "未返回错误")
+		}
+	}
+}
+
+// 铸机内只有二冷区第 1 区，切片的内弧宽面温度为 temp
+func newControlTestCalculator(t *testing.T, temp float32) *calculatorWithArrDeque {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.CoolingZoneCfg = []model.CoolingZone{{ZoneName: "1 Subarea", EndDistance: float32(ZLength)}}
+	outer := float32(50)
+	c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg = []model.SecondaryCoolingWaterSection{
+		{InnerArcWaterVolume: 100, OuterArcWaterVolume: &outer},
+	}
+	for i := 0; i < 5; i++ {
+		c.addLastSlice(1500)
+		for x := 0; x < Length/XStep; x++ {
+			c.thermalField.GetSlice(i)[Width/YStep-1][x] = temp
+		}
+	}
+	return c
+}
+
+func TestControlCooling(t *testing.T) {
+	c := newControlTestCalculator(t, 1010)
+	err := c.SetDynamicControl(model.DynamicControl{
+		Enabled: true,
+		Kp:      2,
+		Ki:      0.5,
+		Period:  2,
+		Zones:   []model.ZoneControl{{Zone: 1, Target: 1000, MinWater: 10, MaxWater: 130}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 配置在下一个时间步长开始时才生效
+	if c.control != nil {
+		t.Fatal("动态控制应等待 Run 协程生效")
+	}
+	c.applyControlChange()
+	if c.castingMachine.CoolerConfig.TargetTemperature["1 Subarea"] != 1000 {
+		t.Fatal("目标温度未设置", c.castingMachine.CoolerConfig.TargetTemperature)
+	}
+	waterCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg
+	// 第一次控制只有积分项：0.5*10*2
+	c.controlCooling()
+	if waterCfg[0].InnerArcWaterVolume != 110 || math.Abs(float64(waterCfg[0].OuterArcVolume()-55)) > 1e-4 {
+		t.Fatal("第一次控制后水量错误", waterCfg[0].InnerArcWaterVolume, waterCfg[0].OuterArcVolume())
+	}
+	// 未到控制周期时不调节
+	c.clock += time.Second
+	c.controlCooling()
+	if len(c.ControlHistory()) != 1 {
+		t.Fatal("未到控制周期时不应调节", c.ControlHistory())
+	}
+	// 温度继续升高，比例项和积分项都增加水量，超过上限时取上限
+	for i := 0; i < 5; i++ {
+		for x := 0; x < Length/XStep; x++ {
+			c.thermalField.GetSlice(i)[Width/YStep-1][x] = 1060
+		}
+	}
+	c.clock += time.Second
+	c.controlCooling()
+	history := c.ControlHistory()
+	if len(history) != 2 || history[1].Temperature != 1060 || history[1].PreWater != 110 || history[1].Water != 130 {
+		t.Fatal("第二次控制动作错误", history)
+	}
+	history[0].Water = 0
+	if c.ControlHistory()[0].Water != 110 {
+		t.Fatal("返回的控制动作应为副本")
+	}
+	select {
+	case actions := <-c.calcHub.ControlActions:
+		if actions[0].Water != 110 {
+			t.Fatal("推送的控制动作错误", actions)
+		}
+	default:
+		t.Fatal("控制动作未推送")
+	}
+	// 关闭动态控制后水量保持不变
+	if err = c.SetDynamicControl(model.DynamicControl{}); err != nil || c.control == nil {
+		t.Fatal("关闭动态控制应等待 Run 协程生效", err)
+	}
+	c.applyControlChange()
+	if c.control != nil {
+		t.Fatal("关闭动态控制失败")
+	}
+	c.clock += 10 * time.Second
+	c.controlCooling()
+	if waterCfg[0].InnerArcWaterVolume != 130 {
+		t.Fatal("关闭动态控制后水量不应改变")
+	}
+}
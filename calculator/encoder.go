@@ -1,156 +1,345 @@
 package calculator
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"lz/model"
-	"math"
-	"time"
+	"sort"
 )
 
-// 第一步先将数据进行处理
-type encoder struct {
-}
+// 表面温度压缩编码
+//
+// 表面温度量化为整数后，相邻温度的差分大多是 0 和很小的数，连续相同的差分合并为游程，
+// 差分值和游程长度再分别用 Huffman 编码。量化后的整数可以无损还原。编码结果：
+//
+//	uvarint  温度个数
+//	uvarint  游程个数
+//	         差分值的码表：uvarint 符号个数，每个符号为 varint 值和 1 字节码长，按值排序
+//	         游程长度的码表，格式同上
+//	         位流：每个游程依次为差分值和游程长度的 Huffman 码，高位在前，最后一个字节低位补 0
+//
+// 码表只保存码长，编码和解码都按 (码长, 值) 的顺序分配范式 Huffman 码。
+
+// 码长不超过 maxCodeLength，对应的符号频次需要超过斐波那契数 F(58)，推送数据远达不到
+const maxCodeLength = 57
 
-type EncodedPushData struct {
-	Top    Encoder
-	Arc    Encoder
-	Bottom Encoder
+// 量化后表面温度的游程
+type surfaceRun struct {
+	delta  int32
+	length int32
 }
 
-type Encoder struct {
-	Start int
-	Data  []int8
+// 按 Huffman 树得到每个符号的码长
+func codeLengths(counts map[int32]int) map[int32]uint8 {
+	leaves := make([]*Node, 0, len(counts))
+	for v, count := range counts {
+		leaves = append(leaves, &Node{Value: ValueType(v), Count: count})
+	}
+	// Build 对相同的输入得到相同的树，先按值排序保证结果确定
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].Value < leaves[j].Value })
+	nodes := make([]*Node, len(leaves))
+	copy(nodes, leaves)
+	Build(nodes)
+
+	lengths := make(map[int32]uint8, len(leaves))
+	for _, leaf := range leaves {
+		_, bits := leaf.Code()
+		if bits == 0 {
+			// 只有一个符号时树根就是叶子，仍然用 1 位表示
+			bits = 1
+		}
+		lengths[int32(leaf.Value)] = bits
+	}
+	return lengths
 }
 
-type MiddleState struct {
-	Top    []int
-	Arc    []int
-	Bottom []int
+// 范式 Huffman 码表
+type huffmanTable struct {
+	symbols []int32 // 按 (码长, 值) 排序的符号
+	counts  []int   // 每种码长的符号个数
+	codes   map[int32]uint64
+	lengths map[int32]uint8
 }
 
-func newEncoder() *encoder {
-	return &encoder{}
+func newHuffmanTable(lengths map[int32]uint8) (*huffmanTable, error) {
+	t := &huffmanTable{
+		counts:  make([]int, maxCodeLength+1),
+		codes:   make(map[int32]uint64, len(lengths)),
+		lengths: lengths,
+	}
+	for v, l := range lengths {
+		if l == 0 || l > maxCodeLength {
+			return nil, fmt.Errorf("Huffman 码长 %d 不合法", l)
+		}
+		t.symbols = append(t.symbols, v)
+		t.counts[l]++
+	}
+	sort.Slice(t.symbols, func(i, j int) bool {
+		a, b := t.symbols[i], t.symbols[j]
+		if lengths[a] != lengths[b] {
+			return lengths[a] < lengths[b]
+		}
+		return a < b
+	})
+	var code uint64
+	var prev uint8
+	for i, v := range t.symbols {
+		l := lengths[v]
+		if i > 0 {
+			code++
+		}
+		code <<= l - prev
+		prev = l
+		if code >= 1<<l {
+			return nil, errors.New("Huffman 码长不满足前缀码的条件")
+		}
+		t.codes[v] = code
+	}
+	return t, nil
 }
 
-func (e *encoder) GeneratePushData1() EncodedPushData {
-	c := NewCalculatorForGenerate()
-	res := c.GenerateResultForEncoder()
-	//printTop(res)
-	//printArc(res)
-	printBottom(res)
-	start := time.Now()
-	final := EncodedPushData{}
-	final.Top = generateMiddleData(res.Top)
-	final.Arc = generateMiddleData(res.Arc)
-	final.Bottom = generateMiddleData(res.Bottom)
-	//fmt.Println(len(final.Top.Data), len(final.Arc.Data), len(final.Bottom.Data))
-	//fmt.Println(final.Top)
-	//fmt.Println(final.Bottom)
-	fmt.Println(time.Since(start), "1321312")
-	return final
+// 按值排序写入码表
+func (t *huffmanTable) marshal(buf []byte) []byte {
+	values := make([]int32, 0, len(t.lengths))
+	for v := range t.lengths {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	buf = appendUvarint(buf, uint64(len(values)))
+	for _, v := range values {
+		buf = appendVarint(buf, int64(v))
+		buf = append(buf, t.lengths[v])
+	}
+	return buf
 }
 
-func (e *encoder) GeneratePushData2() *MiddleState {
-	c := NewCalculatorForGenerate()
-	for i := 0; i < 4000; i++ {
-		c.Field.AddFirst(1600.0)
+func unmarshalHuffmanTable(r *byteReader) (*huffmanTable, error) {
+	n, err := r.uvarint()
+	if err != nil {
+		return nil, err
 	}
-	return c.GenerateResultForEncoder()
+	if n == 0 || n > uint64(len(r.data)) {
+		return nil, errors.New("Huffman 码表长度不正确")
+	}
+	lengths := make(map[int32]uint8, n)
+	for i := uint64(0); i < n; i++ {
+		v, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+		l, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		lengths[int32(v)] = l
+	}
+	if uint64(len(lengths)) != n {
+		return nil, errors.New("Huffman 码表有重复的符号")
+	}
+	return newHuffmanTable(lengths)
 }
 
-func generateMiddleData(data []int) Encoder {
-	max := math.MinInt32
-	res := make([]int8, 0)
-	first := data[0]
-	pre := first
-	start := first
+// 从位流中解码一个符号
+func (t *huffmanTable) decode(r *bitReader) (int32, error) {
+	var code, first uint64
 	index := 0
-	length := 0
-	gap := 0
-	for index < len(data) {
-		if start == data[index] {
-			for index < len(data) && start == data[index] {
-				index++
-				length++
-				res = append(res, int8(gap))
-				if index < len(data) && gap > max {
-					max = gap
-				}
-			}
-		} else {
-			gap = Abs(data[index] - pre)
-			pre = data[index]
-			start = data[index]
-			length = 0
-		}
-	}
-	return Encoder{
-		Start: first,
-		Data: res,
-	}
-}
-
-func printTop(res *MiddleState) {
-	fmt.Println("-----------------------------top--------------------------------")
-	fmt.Println(len(res.Top))
-	lenTop := model.Length/model.XStep + model.Width/model.YStep - 1
-	index := 0
-	fmt.Println(len(res.Top))
-	for index < len(res.Top) {
-		for i := 0; i < lenTop; i++ {
-			fmt.Printf("%4d ", res.Top[i+index])
+	for l := 1; l <= maxCodeLength; l++ {
+		bit, err := r.bit()
+		if err != nil {
+			return 0, err
+		}
+		code |= uint64(bit)
+		count := uint64(t.counts[l])
+		if code-first < count {
+			return t.symbols[index+int(code-first)], nil
 		}
-		index += lenTop
-		fmt.Println()
-		lenTop -= 2
+		index += int(count)
+		first = (first + count) << 1
+		code <<= 1
 	}
-	fmt.Println(index)
+	return 0, errors.New("Huffman 码不存在")
 }
 
-func printArc(res *MiddleState) {
-	fmt.Println(len(res.Arc))
-	index := 0
-	fmt.Println("-----------------------------arc--------------------------------")
-	lenArc := model.Length/model.XStep + model.Width/model.YStep - 1
-	for index < len(res.Arc) {
-		for i := 0; i < lenArc; i++ {
-			fmt.Printf("%4d ", res.Arc[i+index])
+// 压缩量化后的表面温度
+func EncodeSurface(values []int32) []byte {
+	runs := make([]surfaceRun, 0)
+	var prev int32
+	for i, v := range values {
+		delta := v - prev
+		prev = v
+		if i > 0 && runs[len(runs)-1].delta == delta {
+			runs[len(runs)-1].length++
+			continue
 		}
-		fmt.Println()
-		index += lenArc
+		runs = append(runs, surfaceRun{delta: delta, length: 1})
+	}
+
+	deltaCounts, lengthCounts := make(map[int32]int), make(map[int32]int)
+	for _, run := range runs {
+		deltaCounts[run.delta]++
+		lengthCounts[run.length]++
 	}
-	fmt.Println(index)
+	buf := appendUvarint(nil, uint64(len(values)))
+	buf = appendUvarint(buf, uint64(len(runs)))
+	if len(runs) == 0 {
+		return buf
+	}
+	// 码长由 Huffman 树得到，一定满足前缀码的条件
+	deltaTable, _ := newHuffmanTable(codeLengths(deltaCounts))
+	lengthTable, _ := newHuffmanTable(codeLengths(lengthCounts))
+	buf = deltaTable.marshal(buf)
+	buf = lengthTable.marshal(buf)
+
+	w := bitWriter{buf: buf}
+	for _, run := range runs {
+		w.write(deltaTable.codes[run.delta], deltaTable.lengths[run.delta])
+		w.write(lengthTable.codes[run.length], lengthTable.lengths[run.length])
+	}
+	return w.flush()
 }
 
-func printBottom(res *MiddleState) {
-	fmt.Println(len(res.Bottom))
-	index := 0
-	lenBottom := model.Length/model.XStep + model.Width/model.YStep - 1
-	fmt.Println("-----------------------------bottom--------------------------------")
-	for index < len(res.Bottom) {
-		for i := 0; i < lenBottom; i++ {
-			fmt.Printf("%4d ", res.Bottom[i+index])
+// 解码 EncodeSurface 的结果，得到量化后的表面温度
+func DecodeSurface(data []byte) ([]int32, error) {
+	r := &byteReader{data: data}
+	n, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	runCount, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	// 每个游程至少占 2 位
+	if runCount > n || runCount > uint64(len(data))*4 {
+		return nil, errors.New("表面温度编码的长度不正确")
+	}
+	values := make([]int32, 0, runCount)
+	if runCount == 0 {
+		if n != 0 {
+			return nil, errors.New("表面温度编码缺少游程")
+		}
+		return values, nil
+	}
+	deltaTable, err := unmarshalHuffmanTable(r)
+	if err != nil {
+		return nil, err
+	}
+	lengthTable, err := unmarshalHuffmanTable(r)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := &bitReader{data: r.data}
+	var v int32
+	for i := uint64(0); i < runCount; i++ {
+		delta, err := deltaTable.decode(bits)
+		if err != nil {
+			return nil, err
+		}
+		length, err := lengthTable.decode(bits)
+		if err != nil {
+			return nil, err
+		}
+		if length <= 0 || uint64(len(values))+uint64(length) > n {
+			return nil, errors.New("表面温度游程长度不正确")
+		}
+		for j := int32(0); j < length; j++ {
+			v += delta
+			values = append(values, v)
+		}
+	}
+	if uint64(len(values)) != n {
+		return nil, errors.New("表面温度个数不正确")
+	}
+	return values, nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return append(buf, b[:binary.PutUvarint(b, v)]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	return append(buf, b[:binary.PutVarint(b, v)]...)
+}
+
+var errShortSurface = errors.New("表面温度编码长度不足")
+
+type byteReader struct {
+	data []byte
+}
+
+func (r *byteReader) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		return 0, errShortSurface
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+func (r *byteReader) varint() (int64, error) {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		return 0, errShortSurface
+	}
+	r.data = r.data[n:]
+	return v, nil
+}
+
+func (r *byteReader) readByte() (byte, error) {
+	if len(r.data) == 0 {
+		return 0, errShortSurface
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b, nil
+}
+
+// 高位在前写入位流
+type bitWriter struct {
+	buf   []byte
+	cur   byte
+	nbits uint8
+}
+
+func (w *bitWriter) write(code uint64, length uint8) {
+	for i := int(length) - 1; i >= 0; i-- {
+		w.cur = w.cur<<1 | byte(code>>uint(i)&1)
+		w.nbits++
+		if w.nbits == 8 {
+			w.buf = append(w.buf, w.cur)
+			w.cur, w.nbits = 0, 0
 		}
-		index += lenBottom
-		fmt.Println()
-		lenBottom -= 2
 	}
-	fmt.Println(index)
 }
 
-func Abs(x int) int {
-	if x < 0 {
-		return -x
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, w.cur<<(8-w.nbits))
+		w.cur, w.nbits = 0, 0
 	}
-	return x
+	return w.buf
 }
 
-func decode(src Encoder) []int {
-	res := make([]int, 0)
-	start := src.Start
-	for i := 0; i < len(src.Data); i++ {
-		res = append(res, start + int(src.Data[i]))
-		start = start + int(src.Data[i])
+type bitReader struct {
+	data []byte
+	pos  uint64
+}
+
+func (r *bitReader) bit() (byte, error) {
+	if r.pos >= uint64(len(r.data))*8 {
+		return 0, errShortSurface
 	}
-	return res
-}
\ No newline at end of file
+	b := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return b, nil
+}
+
+// 测试数据生成器 GenerateResultForEncoder 的结果
+type MiddleState struct {
+	Top    []int
+	Arc    []int
+	Bottom []int
+}
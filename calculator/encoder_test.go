@@ -1,19 +1,46 @@
 package calculator
 
 import (
-	"encoding/json"
-	"fmt"
+	"math/rand"
+	"reflect"
 	"testing"
-	"time"
 )
 
-func TestGeneratePushData(t *testing.T) {
-	e := newEncoder()
-	start := time.Now()
-	res1 := e.GeneratePushData1()
-	fmt.Println(time.Since(start), "dasdasdasd")
-	res2 := e.GeneratePushData2()
-	b1, _ := json.Marshal(&res1)
-	b2, _ := json.Marshal(&res2)
-	fmt.Println(len(b1), len(b2))
+func TestSurfaceCodec(t *testing.T) {
+	// 模拟表面温度：大段相同的温度、缓慢下降的温度和随机波动
+	values := make([]int32, 0)
+	for i := 0; i < 2000; i++ {
+		values = append(values, 16000)
+	}
+	for i := 0; i < 3000; i++ {
+		values = append(values, int32(15000-i/3))
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		values = append(values, int32(9000+r.Intn(50)-25))
+	}
+
+	for _, c := range [][]int32{values, {}, {7}, {-3, -3, -3}, {1, 2, 3, 5, 8, 13, 21, -34}} {
+		data := EncodeSurface(c)
+		decoded, err := DecodeSurface(data)
+		if err != nil {
+			t.Fatal(c, err)
+		}
+		if len(c) == 0 && len(decoded) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(c, decoded) {
+			t.Fatal("解码结果与原始数据不同", len(c), len(decoded))
+		}
+	}
+
+	data := EncodeSurface(values)
+	if raw := len(values) * 4; len(data)*4 > raw {
+		t.Fatal("压缩后应不到 float32 的四分之一", len(data), len(values)*4)
+	}
+	for _, n := range []int{0, 1, len(data) / 2, len(data) - 1} {
+		if _, err := DecodeSurface(data[:n]); err == nil {
+			t.Fatal("截断的数据应解码失败", n)
+		}
+	}
 }
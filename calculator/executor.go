@@ -1,13 +1,15 @@
 package calculator
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"time"
 )
 
+// ctx 取消后 run 启动的协程全部退出，之后的 dispatchTask 立即返回
 type executor interface {
-	run(c *calculatorWithArrDeque)
+	run(ctx context.Context, c *calculatorWithArrDeque)
 	dispatchTask(deltaT float32, first, last int) time.Duration
 }
 
@@ -19,6 +21,8 @@ type executorBaseOnSlice struct {
 	doneSoFar chan struct{}
 	finish    chan struct{}
 	start     chan task
+
+	ctx context.Context
 }
 
 type task struct {
@@ -35,6 +39,8 @@ func newExecutorBaseOnSlice(workers int) *executorBaseOnSlice {
 		doneSoFar: make(chan struct{}, 50),
 		finish:    make(chan struct{}, 1),
 		start:     make(chan task, 1),
+
+		ctx: context.Background(),
 	}
 
 	return e
@@ -43,14 +49,22 @@ func newExecutorBaseOnSlice(workers int) *executorBaseOnSlice {
 func (e *executorBaseOnSlice) dispatchTask(deltaT float32, first, last int) time.Duration {
 	//fmt.Println("calculate start")
 	start := time.Now()
-	e.start <- task{start: first, end: last, deltaT: deltaT}
+	select {
+	case e.start <- task{start: first, end: last, deltaT: deltaT}:
+	case <-e.ctx.Done():
+		return time.Since(start)
+	}
 	//fmt.Println("task dispatched")
-	<-e.finish
+	select {
+	case <-e.finish:
+	case <-e.ctx.Done():
+	}
 	//fmt.Println("task finished")
 	return time.Since(start)
 }
 
-func (e *executorBaseOnSlice) run(c *calculatorWithArrDeque) {
+func (e *executorBaseOnSlice) run(ctx context.Context, c *calculatorWithArrDeque) {
+	e.ctx = ctx
 	total := 0
 	totalTasks := 0
 	doneSoFar := 0
@@ -116,8 +130,8 @@ func (e *executorBaseOnSlice) run(c *calculatorWithArrDeque) {
 					e.finish <- struct{}{}
 					doneSoFar = 0
 				}
-			default:
-				time.Sleep(1 * time.Millisecond)
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
@@ -131,8 +145,8 @@ func (e *executorBaseOnSlice) run(c *calculatorWithArrDeque) {
 					e.traverseSpirally(t, c)
 					e.doneSoFar <- struct{}{}
 					//fmt.Println("worker ", i, "完成任务: ", t)
-				default:
-					time.Sleep(1 * time.Millisecond)
+				case <-ctx.Done():
+					return
 				}
 			}
 		}(i)
@@ -147,6 +161,7 @@ type executorBaseOnBlock struct {
 	dispatchChan chan task
 	finishChan   chan struct{}
 	f            []func(t task, c *calculatorWithArrDeque)
+	ctx          context.Context
 }
 
 func newExecutorBaseOnBlock(edgeWidth int) *executorBaseOnBlock {
@@ -163,6 +178,7 @@ func newExecutorBaseOnBlock(edgeWidth int) *executorBaseOnBlock {
 		dispatchChan: make(chan task, 1),
 		finishChan:   make(chan struct{}, 10),
 		f:            make([]func(t task, c *calculatorWithArrDeque), 4),
+		ctx:          context.Background(),
 	}
 
 	e.step = 1
@@ -179,7 +195,8 @@ func newExecutorBaseOnBlock(edgeWidth int) *executorBaseOnBlock {
 	return e
 }
 
-func (e *executorBaseOnBlock) run(c *calculatorWithArrDeque) {
+func (e *executorBaseOnBlock) run(ctx context.Context, c *calculatorWithArrDeque) {
+	e.ctx = ctx
 	go func() {
 		for {
 			select {
@@ -195,8 +212,8 @@ func (e *executorBaseOnBlock) run(c *calculatorWithArrDeque) {
 					}(i)
 				}
 				e.wg.Wait()
-			default:
-				time.Sleep(time.Millisecond)
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
@@ -210,10 +227,18 @@ func (e *executorBaseOnBlock) dispatchTask(deltaT float32, first, last int) time
 		deltaT: deltaT,
 	}
 	fmt.Println("分配任务")
-	e.dispatchChan <- t
+	select {
+	case e.dispatchChan <- t:
+	case <-e.ctx.Done():
+		return time.Since(start)
+	}
 
 	for i := 0; i < 4; i++ {
-		<-e.finishChan
+		select {
+		case <-e.finishChan:
+		case <-e.ctx.Done():
+			return time.Since(start)
+		}
 		fmt.Println("完成任务：", i)
 	}
 	return time.Since(start)
@@ -0,0 +1,26 @@
+package calculator
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCalculatorClose(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	baseline := runtime.NumGoroutine()
+	c := NewCalculatorWithArrDeque(nil)
+	if runtime.NumGoroutine() <= baseline {
+		t.Fatal("应启动 executor 协程")
+	}
+	c.Close()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Fatal("关闭后 executor 协程应全部退出", n, baseline)
+	}
+	// 关闭后分配任务立即返回
+	c.e.dispatchTask(0.1, 0, 1)
+}
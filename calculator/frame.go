@@ -0,0 +1,325 @@
+package calculator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"math"
+)
+
+// 温度场推送的二进制帧
+//
+// 温度场 json 每 4 秒推送一次，整个铸机的数据有几 MB，二进制帧可以大幅减小推送的数据量。
+// 帧中所有数值都是小端序：
+//
+//	偏移  长度  内容
+//	0     4     魔数 "TFLD"
+//	4     1     帧格式版本，当前为 1
+//	5     1     温度编码：1 为 float32，2 为量化后的 uint16，3 为差分游程 + Huffman 压缩
+//	6     1     标志位：bit0 为 is_full，bit1 为 is_tail
+//	7     1     保留，为 0
+//	8     20    int32 x_scale, y_scale, z_scale, start, end
+//	28    48    六个面的 uint32 行数和列数，顺序为 up, left, right, front, back, down
+//	76    8     仅 uint16 编码：float32 最低温度 min 和量化步长 step，温度 = min + q * step
+//	76    4     仅 Huffman 编码：float32 量化精度 quantum，温度 = q * quantum
+//	...         六个面的温度，按上面的顺序逐行排列，每个温度 4 字节（float32）或 2 字节（uint16）；
+//	            Huffman 编码时为 uint32 长度和 EncodeSurface 压缩后的 q
+//	...   4     uint32 钢种切换数据的长度 n，没有钢种切换时为 0
+//	...   n     钢种切换数据的 json，与 TemperatureFieldData.Transition 相同
+//
+// uint16 编码的最大误差为 step / 2，温度范围 1600 ℃ 时约 0.012 ℃；Huffman 编码的最大误差为 quantum / 2。
+
+type FrameEncoding uint8
+
+const (
+	FrameFloat32 FrameEncoding = 1
+	FrameUint16  FrameEncoding = 2
+	FrameHuffman FrameEncoding = 3
+)
+
+// Huffman 编码时表面温度的量化精度 ℃
+const SurfaceQuantum float32 = 0.1
+
+const (
+	frameMagic   = "TFLD"
+	frameVersion = 1
+
+	frameFull = 1 << 0
+	frameTail = 1 << 1
+)
+
+// 按编码名称 float32、uint16 或 huffman 获取编码
+func ParseFrameEncoding(name string) (FrameEncoding, error) {
+	switch name {
+	case "float32":
+		return FrameFloat32, nil
+	case "uint16":
+		return FrameUint16, nil
+	case "huffman":
+		return FrameHuffman, nil
+	}
+	return 0, fmt.Errorf("不支持的温度场编码 %q，只能是 float32、uint16 或 huffman", name)
+}
+
+func (e FrameEncoding) String() string {
+	switch e {
+	case FrameFloat32:
+		return "float32"
+	case FrameUint16:
+		return "uint16"
+	case FrameHuffman:
+		return "huffman"
+	}
+	return fmt.Sprintf("FrameEncoding(%d)", uint8(e))
+}
+
+func (s *Sides) faces() []*[][]float32 {
+	return []*[][]float32{&s.Up, &s.Left, &s.Right, &s.Front, &s.Back, &s.Down}
+}
+
+// 把温度场编码为二进制帧，每个面的各行长度必须相同
+func EncodeFieldFrame(data *TemperatureFieldData, encoding FrameEncoding) ([]byte, error) {
+	if encoding != FrameFloat32 && encoding != FrameUint16 && encoding != FrameHuffman {
+		return nil, fmt.Errorf("不支持的温度场编码 %d", encoding)
+	}
+	if data.Sides == nil {
+		return nil, errors.New("温度场没有数据")
+	}
+	faces := data.Sides.faces()
+	min, max := float32(math.MaxFloat32), float32(-math.MaxFloat32)
+	count := 0
+	for _, face := range faces {
+		for _, row := range *face {
+			if len(row) != len((*face)[0]) {
+				return nil, errors.New("温度场每行的长度不同")
+			}
+			for _, t := range row {
+				if t < min {
+					min = t
+				}
+				if t > max {
+					max = t
+				}
+			}
+			count += len(row)
+		}
+	}
+
+	var flags uint8
+	if data.IsFull {
+		flags |= frameFull
+	}
+	if data.IsTail {
+		flags |= frameTail
+	}
+	size := 4
+	if encoding == FrameUint16 {
+		size = 2
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, 84+count*size))
+	buf.WriteString(frameMagic)
+	buf.Write([]byte{frameVersion, byte(encoding), flags, 0})
+	for _, v := range []int32{int32(data.XScale), int32(data.YScale), int32(data.ZScale), int32(data.Start), int32(data.End)} {
+		_ = binary.Write(buf, binary.LittleEndian, v)
+	}
+	for _, face := range faces {
+		rows, cols := len(*face), 0
+		if rows > 0 {
+			cols = len((*face)[0])
+		}
+		_ = binary.Write(buf, binary.LittleEndian, [2]uint32{uint32(rows), uint32(cols)})
+	}
+
+	var step float32
+	if encoding == FrameUint16 {
+		if count == 0 {
+			min, max = 0, 0
+		}
+		step = (max - min) / math.MaxUint16
+		_ = binary.Write(buf, binary.LittleEndian, [2]float32{min, step})
+	}
+	if encoding == FrameHuffman {
+		_ = binary.Write(buf, binary.LittleEndian, SurfaceQuantum)
+		values := make([]int32, 0, count)
+		for _, face := range faces {
+			for _, row := range *face {
+				for _, t := range row {
+					values = append(values, int32(math.Round(float64(t/SurfaceQuantum))))
+				}
+			}
+		}
+		payload := EncodeSurface(values)
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(payload)))
+		buf.Write(payload)
+		log.WithFields(log.Fields{
+			"values":     count,
+			"float32":    count * 4,
+			"compressed": len(payload),
+			"ratio":      float32(count*4) / float32(len(payload)),
+		}).Info("温度场压缩")
+	}
+	b := make([]byte, size)
+	for _, face := range faces {
+		if encoding == FrameHuffman {
+			break
+		}
+		for _, row := range *face {
+			for _, t := range row {
+				if encoding == FrameFloat32 {
+					binary.LittleEndian.PutUint32(b, math.Float32bits(t))
+				} else {
+					var q float64
+					if step > 0 {
+						q = math.Min(math.Round(float64((t-min)/step)), math.MaxUint16)
+					}
+					binary.LittleEndian.PutUint16(b, uint16(q))
+				}
+				buf.Write(b)
+			}
+		}
+	}
+
+	var transition []byte
+	if data.Transition != nil {
+		var err error
+		if transition, err = json.Marshal(data.Transition); err != nil {
+			return nil, err
+		}
+	}
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(transition)))
+	buf.Write(transition)
+	return buf.Bytes(), nil
+}
+
+// 解码 EncodeFieldFrame 编码的二进制帧，uint16 编码的温度按 min + q * step 还原，Huffman 编码按 q * quantum 还原
+func DecodeFieldFrame(frame []byte) (*TemperatureFieldData, error) {
+	r := bytes.NewReader(frame)
+	var header struct {
+		Magic    [4]byte
+		Version  uint8
+		Encoding FrameEncoding
+		Flags    uint8
+		_        uint8
+		Scales   [5]int32
+		Dims     [6][2]uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("温度场帧头不完整: %v", err)
+	}
+	if string(header.Magic[:]) != frameMagic {
+		return nil, errors.New("不是温度场帧")
+	}
+	if header.Version != frameVersion {
+		return nil, fmt.Errorf("不支持的温度场帧版本 %d", header.Version)
+	}
+	if header.Encoding != FrameFloat32 && header.Encoding != FrameUint16 && header.Encoding != FrameHuffman {
+		return nil, fmt.Errorf("不支持的温度场编码 %d", header.Encoding)
+	}
+	var quant [2]float32
+	if header.Encoding == FrameUint16 {
+		if err := binary.Read(r, binary.LittleEndian, &quant); err != nil {
+			return nil, fmt.Errorf("温度场量化参数不完整: %v", err)
+		}
+	}
+	var values []int32
+	if header.Encoding == FrameHuffman {
+		var err error
+		if values, err = readSurface(r, &quant[1]); err != nil {
+			return nil, err
+		}
+	}
+	size := 4
+	if header.Encoding == FrameUint16 {
+		size = 2
+	}
+	for _, dim := range header.Dims {
+		if dim[0] > 0 && dim[1] == 0 {
+			return nil, errors.New("温度场帧的面尺寸不正确")
+		}
+		if header.Encoding == FrameHuffman {
+			if uint64(dim[0])*uint64(dim[1]) > uint64(len(values)) {
+				return nil, errors.New("温度场帧长度不足")
+			}
+			continue
+		}
+		if uint64(dim[0])*uint64(dim[1])*uint64(size) > uint64(r.Len()) {
+			return nil, errors.New("温度场帧长度不足")
+		}
+	}
+
+	data := &TemperatureFieldData{
+		XScale: int(header.Scales[0]),
+		YScale: int(header.Scales[1]),
+		ZScale: int(header.Scales[2]),
+		Start:  int(header.Scales[3]),
+		End:    int(header.Scales[4]),
+		IsFull: header.Flags&frameFull != 0,
+		IsTail: header.Flags&frameTail != 0,
+		Sides:  &Sides{},
+	}
+	b := make([]byte, size)
+	for i, face := range data.Sides.faces() {
+		rows, cols := int(header.Dims[i][0]), int(header.Dims[i][1])
+		*face = make([][]float32, rows)
+		for y := range *face {
+			row := make([]float32, cols)
+			for x := range row {
+				if header.Encoding == FrameHuffman {
+					if len(values) == 0 {
+						return nil, errors.New("温度场帧长度不足")
+					}
+					row[x] = float32(values[0]) * quant[1]
+					values = values[1:]
+					continue
+				}
+				if _, err := io.ReadFull(r, b); err != nil {
+					return nil, errors.New("温度场帧长度不足")
+				}
+				if header.Encoding == FrameFloat32 {
+					row[x] = math.Float32frombits(binary.LittleEndian.Uint32(b))
+				} else {
+					row[x] = quant[0] + float32(binary.LittleEndian.Uint16(b))*quant[1]
+				}
+			}
+			(*face)[y] = row
+		}
+	}
+
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, fmt.Errorf("温度场帧缺少钢种切换数据: %v", err)
+	}
+	if n > 0 {
+		if uint64(n) > uint64(r.Len()) {
+			return nil, errors.New("温度场帧长度不足")
+		}
+		transition := make([]byte, n)
+		_, _ = io.ReadFull(r, transition)
+		data.Transition = &SteelTransitionData{}
+		if err := json.Unmarshal(transition, data.Transition); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// 读取 Huffman 编码的量化精度和压缩后的表面温度
+func readSurface(r *bytes.Reader, quantum *float32) ([]int32, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, quantum); err != nil {
+		return nil, fmt.Errorf("温度场量化精度不完整: %v", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, fmt.Errorf("温度场压缩数据不完整: %v", err)
+	}
+	if uint64(n) > uint64(r.Len()) {
+		return nil, errors.New("温度场帧长度不足")
+	}
+	payload := make([]byte, n)
+	_, _ = io.ReadFull(r, payload)
+	return DecodeSurface(payload)
+}
@@ -0,0 +1,116 @@
+package calculator
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func testFieldData() *TemperatureFieldData {
+	face := func(rows, cols int) [][]float32 {
+		f := make([][]float32, rows)
+		for i := range f {
+			f[i] = make([]float32, cols)
+			for j := range f[i] {
+				f[i][j] = 800 + float32(i*cols+j)*1.37
+			}
+		}
+		return f
+	}
+	return &TemperatureFieldData{
+		XScale: 2, YScale: 2, ZScale: 10, Start: 0, End: 30, IsFull: false, IsTail: true,
+		Sides: &Sides{
+			Up: face(4, 6), Down: face(4, 6),
+			Left: face(30, 4), Right: face(30, 4),
+			Front: face(30, 6), Back: face(30, 6),
+		},
+		Transition: &SteelTransitionData{MixingLength: 3000, Start: 1200, End: 4200, Progress: 0.5},
+	}
+}
+
+func TestFieldFrameFloat32(t *testing.T) {
+	data := testFieldData()
+	frame, err := EncodeFieldFrame(data, FrameFloat32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeFieldFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, decoded) {
+		t.Fatal("float32 编码应无损", decoded)
+	}
+	if _, err = DecodeFieldFrame(frame[:len(frame)-10]); err == nil {
+		t.Fatal("截断的帧应解码失败")
+	}
+	if _, err = DecodeFieldFrame([]byte("{\"x_scale\":1}")); err == nil {
+		t.Fatal("json 不是温度场帧")
+	}
+}
+
+func TestFieldFrameUint16(t *testing.T) {
+	data := testFieldData()
+	data.Transition = nil
+	frame, err := EncodeFieldFrame(data, FrameUint16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	float32Frame, _ := EncodeFieldFrame(data, FrameFloat32)
+	if len(frame) >= len(float32Frame) {
+		t.Fatal("uint16 编码应小于 float32 编码", len(frame), len(float32Frame))
+	}
+	decoded, err := DecodeFieldFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.End != data.End || decoded.IsTail != data.IsTail || decoded.Transition != nil {
+		t.Fatal("帧头解码错误", decoded)
+	}
+	// 温度范围约 400 ℃，最大误差为半个量化步长
+	maxErr := float64(0)
+	for i, face := range data.Sides.faces() {
+		got := *decoded.Sides.faces()[i]
+		for y, row := range *face {
+			for x, v := range row {
+				maxErr = math.Max(maxErr, math.Abs(float64(got[y][x]-v)))
+			}
+		}
+	}
+	if maxErr > 0.01 {
+		t.Fatal("uint16 量化误差过大", maxErr)
+	}
+}
+
+func TestFieldFrameHuffman(t *testing.T) {
+	data := testFieldData()
+	frame, err := EncodeFieldFrame(data, FrameHuffman)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uint16Frame, _ := EncodeFieldFrame(data, FrameUint16)
+	if len(frame) >= len(uint16Frame) {
+		t.Fatal("Huffman 编码应小于 uint16 编码", len(frame), len(uint16Frame))
+	}
+	decoded, err := DecodeFieldFrame(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Transition, data.Transition) {
+		t.Fatal("钢种切换数据解码错误", decoded.Transition)
+	}
+	// 量化到 0.1 ℃，误差不超过半个量化精度
+	for i, face := range data.Sides.faces() {
+		got := *decoded.Sides.faces()[i]
+		for y, row := range *face {
+			for x, v := range row {
+				if math.Abs(float64(got[y][x]-v)) > float64(SurfaceQuantum)/2+1e-3 {
+					t.Fatal("Huffman 量化误差过大", got[y][x], v)
+				}
+			}
+		}
+	}
+	if _, err = DecodeFieldFrame(frame[:90]); err == nil {
+		t.Fatal("截断的压缩数据应解码失败")
+	}
+}
@@ -1,13 +1,17 @@
 package calculator
 
 import (
-	"fmt"
+	"context"
+	log "github.com/sirupsen/logrus"
+	"lz/model"
+	"sync"
 	"time"
 )
 
 type CalcHub struct {
 	// 温度场推送
-	Stop             chan struct{}
+	Stop             chan struct{} // 计算停止时关闭，开始计算时替换，读写时持有 stopMu
+	stopMu           sync.Mutex
 	PeriodCalcResult chan struct{}
 	// 切片横截面温度数据推送
 	PushSliceDetailRunning         bool
@@ -17,10 +21,22 @@ type CalcHub struct {
 	StopSuccessForPush             chan struct{}
 	PeriodPushSliceData            chan struct{}
 	// 切片纵截面
+	// 二冷动态控制动作推送
+	ControlActions chan []model.ControlAction
+	// 报警事件推送
+	Alarms chan []model.Alarm
+
+	// 计算器关闭时取消，计算、推送和 executor 的所有协程随之退出
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func NewCalcHub() *CalcHub {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &CalcHub{
+		ctx:    ctx,
+		cancel: cancel,
+
 		PeriodCalcResult: make(chan struct{}),
 
 		PeriodPushSliceData:            make(chan struct{}),
@@ -28,35 +44,73 @@ func NewCalcHub() *CalcHub {
 		StopPushSliceDataSignalForPush: make(chan struct{}, 10),
 		StopSuccessForRun:              make(chan struct{}, 10),
 		StopSuccessForPush:             make(chan struct{}, 10),
+
+		ControlActions: make(chan []model.ControlAction, 100),
+		Alarms:         make(chan []model.Alarm, 100),
 	}
 }
 
+// 计算器关闭后 Done 返回的通道被关闭
+func (ch *CalcHub) Done() <-chan struct{} {
+	return ch.ctx.Done()
+}
+
+// 关闭计算器，通知所有协程退出
+func (ch *CalcHub) Close() {
+	ch.cancel()
+}
+
 // 温度场计算
 func (ch *CalcHub) PushSignal() {
-	ch.PeriodCalcResult <- struct{}{}
+	select {
+	case ch.PeriodCalcResult <- struct{}{}:
+	case <-ch.ctx.Done():
+	}
 }
 
 func (ch *CalcHub) StopSignal() {
+	ch.stopMu.Lock()
+	defer ch.stopMu.Unlock()
 	close(ch.Stop)
 }
 
 func (ch *CalcHub) StartSignal() {
+	ch.stopMu.Lock()
+	defer ch.stopMu.Unlock()
 	ch.Stop = make(chan struct{})
 }
 
+// 本次计算的停止信号，计算和推送协程开始时获取一次，之后再开始计算替换的通道不影响已经停止的协程
+func (ch *CalcHub) StopChan() <-chan struct{} {
+	ch.stopMu.Lock()
+	defer ch.stopMu.Unlock()
+	return ch.Stop
+}
+
 // 切片详情数据
 func (ch *CalcHub) PushSliceDetailSignal() {
-	ch.PeriodPushSliceData <- struct{}{}
+	select {
+	case ch.PeriodPushSliceData <- struct{}{}:
+	case <-ch.ctx.Done():
+	}
 }
 
+// 停止切片详情的计算和推送协程，计算器已关闭时协程已经退出，直接返回
 func (ch *CalcHub) StopPushSliceDetail() {
-	fmt.Println("start to stop push slice detail")
+	log.Debug("开始停止切片详情推送")
 	ch.StopPushSliceDataSignalForRun <- struct{}{}
-	<-ch.StopSuccessForRun
-	fmt.Println("stop running slice detail success")
+	select {
+	case <-ch.StopSuccessForRun:
+	case <-ch.ctx.Done():
+		return
+	}
 	ch.StopPushSliceDataSignalForPush <- struct{}{}
-	<-ch.StopSuccessForPush
-	fmt.Println("stop push slice detail success")
+	select {
+	case <-ch.StopSuccessForPush:
+	case <-ch.ctx.Done():
+		return
+	}
+	log.Debug("停止切片详情推送成功")
 }
 
 // 横切面周期性推送任务
@@ -65,12 +119,17 @@ LOOP:
 	for {
 		select {
 		case <-ch.StopPushSliceDataSignalForRun:
-			fmt.Println("stop slice detail running")
+			log.Debug("切片详情计算协程退出")
 			ch.StopSuccessForRun <- struct{}{}
 			break LOOP
+		case <-ch.ctx.Done():
+			break LOOP
 		default:
 			ch.PushSliceDetailSignal()
-			time.Sleep(1 * time.Second)
+			select {
+			case <-time.After(1 * time.Second):
+			case <-ch.ctx.Done():
+			}
 		}
 	}
 }
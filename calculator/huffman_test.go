@@ -1,93 +1,26 @@
 package calculator
 
 import (
+	"reflect"
 	"testing"
 )
 
-type EncodedPushData2 struct {
-	Top    Encoder2
-	Arc    Encoder2
-	Bottom Encoder2
-}
-
-type Encoder2 struct {
-	Start int
-	Data  []int
-}
-
-func TestPrint(t *testing.T) {
-	e := newEncoder()
-	middle := e.GeneratePushData2()
-	final := EncodedPushData2{
-		Top: Encoder2{
-			Data: make([]int, 0),
-		},
-		Arc: Encoder2{
-			Data: make([]int, 0),
-		},
-		Bottom: Encoder2{
-			Data: make([]int, 0),
-		},
-	}
-	final.Top.Start = middle.Top[0]
-	for i := 1; i < len(middle.Top); i++ {
-		final.Top.Data = append(final.Top.Data, middle.Top[i]-final.Top.Start)
-	}
-	final.Arc.Start = middle.Arc[0]
-	for i := 1; i < len(middle.Arc); i++ {
-		final.Arc.Data = append(final.Arc.Data, middle.Arc[i]-final.Arc.Start)
-	}
-	final.Bottom.Start = middle.Bottom[0]
-	for i := 1; i < len(middle.Bottom); i++ {
-		final.Bottom.Data = append(final.Bottom.Data, middle.Bottom[i]-final.Bottom.Start)
-	}
-
-	m := make(map[int]int, 10)
-	for i := 0; i < len(final.Top.Data); i++ {
-		m[final.Top.Data[i]]++
-	}
-	for i := 0; i < len(final.Arc.Data); i++ {
-		m[final.Arc.Data[i]]++
+func TestHuffmanTable(t *testing.T) {
+	// Build 的文档示例
+	lengths := codeLengths(map[int32]int{' ': 20, 'a': 40, 'm': 10, 'l': 7, 'f': 8, 't': 15})
+	want := map[int32]uint8{'a': 1, 'm': 3, 'l': 4, 'f': 4, 't': 3, ' ': 3}
+	if !reflect.DeepEqual(lengths, want) {
+		t.Fatal("码长不正确", lengths)
 	}
-	for i := 0; i < len(final.Bottom.Data); i++ {
-		m[final.Bottom.Data[i]]++
+	table, err := newHuffmanTable(lengths)
+	if err != nil {
+		t.Fatal(err)
 	}
-
-	var leaves []*Node
-	for k, v := range m {
-		leaves = append(leaves, &Node{
-			Value: ValueType(k),
-			Count: v,
-		})
-	}
-
-	root := Build(leaves)
-	Print(root)
-}
-
-func TestPrint1(t *testing.T) {
-	e := newEncoder()
-	middle := e.GeneratePushData1()
-
-	m := make(map[int8]int, 10)
-	for i := 0; i < len(middle.Top.Data); i++ {
-		m[middle.Top.Data[i]]++
-	}
-	for i := 0; i < len(middle.Arc.Data); i++ {
-		m[middle.Arc.Data[i]]++
+	// 范式码：码长相同的按值排序
+	if table.codes['a'] != 0 || table.codes[' '] != 0b100 || table.codes['m'] != 0b101 || table.codes['f'] != 0b1110 {
+		t.Fatal("范式 Huffman 码不正确", table.codes)
 	}
-	for i := 0; i < len(middle.Bottom.Data); i++ {
-		m[middle.Bottom.Data[i]]++
+	if _, err = newHuffmanTable(map[int32]uint8{1: 1, 2: 1, 3: 1}); err == nil {
+		t.Fatal("不满足前缀码条件的码长应返回错误")
 	}
-
-	var leaves []*Node
-	for k, v := range m {
-		leaves = append(leaves, &Node{
-			Value: ValueType(k),
-			Count: v,
-		})
-	}
-
-	root := Build(leaves)
-	Print(root)
 }
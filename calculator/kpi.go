@@ -0,0 +1,112 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+)
+
+// 离线计算结束后输出的关键指标
+
+const kpiSampleStep = 100 // 坯壳厚度沿拉坯方向的采样间隔（切片数），即每 1m 采样一次
+
+type KPI struct {
+	SimulatedTime          float64                `json:"simulated_time"`            // 模拟时间 s
+	SliceNum               int                    `json:"slice_num"`                 // 铸机内的切片数
+	IsFull                 bool                   `json:"is_full"`                   // 铸坯是否充满铸机
+	MoldExitShellThickness ShellThicknessSample   `json:"mold_exit_shell_thickness"` // 结晶器出口坯壳厚度
+	ShellThickness         []ShellThicknessSample `json:"shell_thickness"`           // 沿拉坯方向的坯壳厚度
+	IsSolidified           bool                   `json:"is_solidified"`             // 铸坯中心是否已完全凝固
+	MetallurgicalLength    float32                `json:"metallurgical_length"`      // 冶金长度 mm，未完全凝固时为 0
+}
+
+// 某一位置处的坯壳厚度，单位 mm
+type ShellThicknessSample struct {
+	Distance float32 `json:"distance"`        // 距弯月面的距离
+	Wide     float32 `json:"wide"`            // 宽面中心，半断面时为内弧宽面中心
+	Narrow   float32 `json:"narrow"`          // 窄面中心
+	Corner   float32 `json:"corner"`          // 角部，沿角部到中心的对角线方向，半断面时为内弧一侧的角部
+	Outer    float32 `json:"outer,omitempty"` // 外弧宽面中心，仅半断面时计算
+}
+
+// 宽面、窄面、角部（半断面时包括外弧宽面）中最薄处的坯壳厚度
+func (s ShellThicknessSample) Thinnest() float32 {
+	thinnest := s.Wide
+	if s.Narrow < thinnest {
+		thinnest = s.Narrow
+	}
+	if s.Corner < thinnest {
+		thinnest = s.Corner
+	}
+	if isHalfSection() && s.Outer < thinnest {
+		thinnest = s.Outer
+	}
+	return thinnest
+}
+
+func (c *calculatorWithArrDeque) BuildKPI() *KPI {
+	kpi := &KPI{
+		SliceNum:       c.Field.Size(),
+		IsFull:         c.Field.IsFull(),
+		ShellThickness: make([]ShellThicknessSample, 0),
+	}
+	moldExit := (c.castingMachine.Coordinate.MdLength - int(c.castingMachine.Coordinate.LevelHeight)) / ZStep
+	steels := c.steels()
+	c.Field.Traverse(func(z int, item *model.ItemType) {
+		if item[0][0] == -1 {
+			return
+		}
+		solidTemp := steels.at(z).SolidPhaseTemperature
+		if z == moldExit-1 {
+			kpi.MoldExitShellThickness = shellThicknessOfSlice(z, item, solidTemp)
+		}
+		if (z+1)%kpiSampleStep == 0 {
+			kpi.ShellThickness = append(kpi.ShellThickness, shellThicknessOfSlice(z, item, solidTemp))
+		}
+		// 铸坯中心温度首次低于固相线温度的位置即为冶金长度
+		if !kpi.IsSolidified && centerTemperature(item) <= solidTemp {
+			kpi.IsSolidified = true
+			kpi.MetallurgicalLength = float32((z + 1) * ZStep)
+		}
+	}, 0, c.Field.Size())
+	return kpi
+}
+
+// 铸坯中心的温度
+func centerTemperature(slice *model.ItemType) float32 {
+	return coreTemperature(slice, 0)
+}
+
+// 第 x 列厚度中心的温度，半断面时内外弧冷却不同，最后凝固的位置不一定在厚度中心线上，取该列的最高温度
+func coreTemperature(slice *model.ItemType, x int) float32 {
+	if !isHalfSection() {
+		return slice[0][x]
+	}
+	temp := slice[0][x]
+	for j := 1; j < Width/YStep; j++ {
+		if slice[j][x] > temp {
+			temp = slice[j][x]
+		}
+	}
+	return temp
+}
+
+// 计算一个切片宽面中心、窄面中心和角部的坯壳厚度
+func shellThicknessOfSlice(z int, slice *model.ItemType, solidTemp float32) ShellThicknessSample {
+	sample := ShellThicknessSample{Distance: float32((z + 1) * ZStep)}
+	for j := Width/YStep - 1; j >= centerRow() && slice[j][0] <= solidTemp; j-- {
+		sample.Wide += float32(YStep)
+	}
+	for i := Length/XStep - 1; i >= 0 && slice[centerRow()][i] <= solidTemp; i-- {
+		sample.Narrow += float32(XStep)
+	}
+	diagonal := float32(math.Sqrt(float64(XStep*XStep + YStep*YStep)))
+	for i, j := Length/XStep-1, Width/YStep-1; i >= 0 && j >= centerRow() && slice[j][i] <= solidTemp; i, j = i-1, j-1 {
+		sample.Corner += diagonal
+	}
+	if isHalfSection() {
+		for j := 0; j < centerRow() && slice[j][0] <= solidTemp; j++ {
+			sample.Outer += float32(YStep)
+		}
+	}
+	return sample
+}
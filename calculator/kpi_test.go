@@ -0,0 +1,38 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+	"testing"
+)
+
+func TestShellThicknessOfSlice(t *testing.T) {
+	Length, Width = 50, 25
+	var slice model.ItemType
+	for i := 0; i < Width/YStep; i++ {
+		for j := 0; j < Length/XStep; j++ {
+			slice[i][j] = 1500
+		}
+	}
+	// 宽面两层、窄面三层节点低于固相线
+	for j := 0; j < Length/XStep; j++ {
+		slice[Width/YStep-1][j] = 1000
+		slice[Width/YStep-2][j] = 1200
+	}
+	for i := 0; i < Width/YStep; i++ {
+		for j := Length/XStep - 3; j < Length/XStep; j++ {
+			slice[i][j] = 1100
+		}
+	}
+	sample := shellThicknessOfSlice(9, &slice, 1400)
+	if sample.Distance != float32(10*ZStep) {
+		t.Fatal("distance:", sample.Distance)
+	}
+	if sample.Wide != float32(2*YStep) || sample.Narrow != float32(3*XStep) {
+		t.Fatal("shell thickness:", sample)
+	}
+	// 角部沿对角线有三个节点低于固相线
+	if math.Abs(float64(sample.Corner)-3*math.Sqrt(float64(XStep*XStep+YStep*YStep))) > 1e-3 {
+		t.Fatal("corner shell thickness:", sample.Corner)
+	}
+}
@@ -0,0 +1,20 @@
+package calculator
+
+import (
+	"fmt"
+	"lz/config"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if err := config.Init("../conf"); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := LoadSteelLibrary(config.PhaseTemperatureFile(), config.PhysicalParameterFile()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
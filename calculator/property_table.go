@@ -0,0 +1,179 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	"lz/model"
+	"math"
+)
+
+// 物性参数表：将任意温度间隔的物性参数表插值为按 1℃ 排列的数组
+//
+// 温度间隔可以不均匀，表外的温度保持端点值不变
+
+const (
+	InterpolationLinear        = "linear" // 线性插值
+	InterpolationMonotoneCubic = "cubic"  // 单调三次插值（Fritsch-Carlson），不会在数据点之间产生过冲
+	maxPropertyTableGap        = 20.0     // 相邻两行之间允许的最大温度间隔 ℃，超过则认为物性参数表有缺失
+	propertyTableTempTolerance = 1e-3     // 温度相同的判断阈值
+	propertyTableMinRows       = 2
+)
+
+// 单列物性参数的插值函数
+type interpolator func(temp float64) float64
+
+// 校验物性参数表，rows 需已按温度升序排列
+func checkPropertyTable(rows []model.PhysicalParameter) error {
+	if len(rows) < propertyTableMinRows {
+		return fmt.Errorf("物性参数表至少需要 %d 行，实际为 %d 行", propertyTableMinRows, len(rows))
+	}
+	for i := 1; i < len(rows); i++ {
+		gap := rows[i].Temperature - rows[i-1].Temperature
+		if gap < propertyTableTempTolerance {
+			return fmt.Errorf("物性参数表中温度 %v 重复", rows[i].Temperature)
+		}
+		if gap > maxPropertyTableGap {
+			return fmt.Errorf("物性参数表在 %v ~ %v 之间缺失数据，最大允许间隔为 %v", rows[i-1].Temperature, rows[i].Temperature, maxPropertyTableGap)
+		}
+		if rows[i].Enthalpy <= rows[i-1].Enthalpy {
+			return fmt.Errorf("物性参数表中焓值在 %v ~ %v 之间不是单调递增的", rows[i-1].Temperature, rows[i].Temperature)
+		}
+	}
+	return nil
+}
+
+// 根据插值方式构建一列物性参数的插值函数
+func newInterpolator(method string, temps, values []float64) (interpolator, error) {
+	switch method {
+	case "", InterpolationLinear:
+		return linearInterpolator(temps, values), nil
+	case InterpolationMonotoneCubic:
+		return monotoneCubicInterpolator(temps, values), nil
+	}
+	return nil, errors.New("不支持的插值方式: " + method)
+}
+
+// 找到 temp 所在的区间 [temps[k], temps[k+1]]，temps 升序且 temps[0] < temp < temps[n-1]
+func searchInterval(temps []float64, temp float64) int {
+	left, right := 0, len(temps)-2
+	for left < right {
+		m := left + (right-left+1)>>1
+		if temps[m] <= temp {
+			left = m
+		} else {
+			right = m - 1
+		}
+	}
+	return left
+}
+
+func linearInterpolator(temps, values []float64) interpolator {
+	n := len(temps)
+	return func(temp float64) float64 {
+		if temp <= temps[0] {
+			return values[0]
+		}
+		if temp >= temps[n-1] {
+			return values[n-1]
+		}
+		k := searchInterval(temps, temp)
+		return values[k] + (values[k+1]-values[k])*(temp-temps[k])/(temps[k+1]-temps[k])
+	}
+}
+
+func monotoneCubicInterpolator(temps, values []float64) interpolator {
+	n := len(temps)
+	// 1. 各区间的割线斜率
+	delta := make([]float64, n-1)
+	for k := 0; k < n-1; k++ {
+		delta[k] = (values[k+1] - values[k]) / (temps[k+1] - temps[k])
+	}
+	// 2. 各数据点处的切线斜率，端点取单侧差分，内部点取相邻割线斜率的平均值
+	m := make([]float64, n)
+	m[0], m[n-1] = delta[0], delta[n-2]
+	for k := 1; k < n-1; k++ {
+		if delta[k-1]*delta[k] <= 0 {
+			m[k] = 0
+		} else {
+			m[k] = (delta[k-1] + delta[k]) / 2
+		}
+	}
+	// 3. 修正切线斜率以保证单调性
+	for k := 0; k < n-1; k++ {
+		if delta[k] == 0 {
+			m[k], m[k+1] = 0, 0
+			continue
+		}
+		alpha, beta := m[k]/delta[k], m[k+1]/delta[k]
+		if alpha < 0 {
+			m[k], alpha = 0, 0
+		}
+		if beta < 0 {
+			m[k+1], beta = 0, 0
+		}
+		if s := alpha*alpha + beta*beta; s > 9 {
+			tau := 3 / math.Sqrt(s)
+			m[k] = tau * alpha * delta[k]
+			m[k+1] = tau * beta * delta[k]
+		}
+	}
+	return func(temp float64) float64 {
+		if temp <= temps[0] {
+			return values[0]
+		}
+		if temp >= temps[n-1] {
+			return values[n-1]
+		}
+		k := searchInterval(temps, temp)
+		h := temps[k+1] - temps[k]
+		t := (temp - temps[k]) / h
+		t2, t3 := t*t, t*t*t
+		return (2*t3-3*t2+1)*values[k] + (t3-2*t2+t)*h*m[k] + (-2*t3+3*t2)*values[k+1] + (t3-t2)*h*m[k+1]
+	}
+}
+
+// 将物性参数表插值到 Parameter 的各个数组中，rows 需已通过 checkPropertyTable 校验
+func fillPropertyTable(parameter *Parameter, rows []model.PhysicalParameter, method string) error {
+	temps := make([]float64, len(rows))
+	for i, row := range rows {
+		temps[i] = float64(row.Temperature)
+	}
+	column := func(get func(row model.PhysicalParameter) float32) (interpolator, error) {
+		values := make([]float64, len(rows))
+		for i, row := range rows {
+			values[i] = float64(get(row))
+		}
+		return newInterpolator(method, temps, values)
+	}
+	// 1. 导热系数 2. 密度 3. 焓值 4. 比热容 5. 固相率 6. 发射率
+	var f [6]interpolator
+	var err error
+	getters := [6]func(row model.PhysicalParameter) float32{
+		func(row model.PhysicalParameter) float32 { return row.ThermalConductivity },
+		func(row model.PhysicalParameter) float32 { return row.Density },
+		func(row model.PhysicalParameter) float32 { return row.Enthalpy },
+		func(row model.PhysicalParameter) float32 { return row.SpecficHeat },
+		func(row model.PhysicalParameter) float32 { return 1 - row.LiquidPhaseFraction },
+		func(row model.PhysicalParameter) float32 { return row.Emissivity },
+	}
+	for i, get := range getters {
+		if f[i], err = column(get); err != nil {
+			return err
+		}
+	}
+	// Lambda、Density、Enthalpy、C 的下标 i 对应温度 i+1 ℃
+	for i := 0; i < ArrayLength; i++ {
+		temp := float64(i + 1)
+		parameter.Lambda[i] = float32(f[0](temp))
+		parameter.Density[i] = float32(f[1](temp))
+		parameter.Enthalpy[i] = float32(f[2](temp))
+		parameter.C[i] = float32(f[3](temp))
+	}
+	// SolidFraction、Emissivity 的下标 i 对应温度 i ℃
+	for i := 0; i <= ArrayLength; i++ {
+		temp := float64(i)
+		parameter.SolidFraction[i] = float32(f[4](temp))
+		parameter.Emissivity[i] = float32(f[5](temp))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+	"testing"
+)
+
+// 生成间隔为 step 的物性参数表，焓值随温度线性增加，导热系数在 1450℃ 处有一个台阶
+func genPropertyTable(from, to, step float32) []model.PhysicalParameter {
+	var rows []model.PhysicalParameter
+	for temp := from; temp <= to; temp += step {
+		lambda := float32(30)
+		if temp >= 1450 {
+			lambda = 40
+		}
+		rows = append(rows, model.PhysicalParameter{
+			Temperature:         temp,
+			ThermalConductivity: lambda,
+			Density:             7000,
+			Enthalpy:            700 * temp,
+			SpecficHeat:         700,
+			Emissivity:          0.8,
+		})
+	}
+	return rows
+}
+
+func TestCheckPropertyTable(t *testing.T) {
+	if err := checkPropertyTable(genPropertyTable(25, 1600, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkPropertyTable(genPropertyTable(25, 1600, 1)); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]model.PhysicalParameter{
+		"温度重复": append(genPropertyTable(25, 100, 5), genPropertyTable(100, 200, 5)...),
+		"数据缺失": append(genPropertyTable(25, 100, 5), genPropertyTable(200, 300, 5)...),
+		"行数不足": genPropertyTable(25, 25, 5),
+	}
+	rows := genPropertyTable(25, 100, 5)
+	rows[3].Enthalpy = rows[2].Enthalpy
+	cases["焓值不单调"] = rows
+	for name, rows := range cases {
+		if checkPropertyTable(rows) == nil {
+			t.Fatal(name, "的物性参数表未被拒绝")
+		}
+	}
+}
+
+func TestFillPropertyTableLinear(t *testing.T) {
+	var p1, p10 Parameter
+	if err := fillPropertyTable(&p1, genPropertyTable(25, 1600, 1), InterpolationLinear); err != nil {
+		t.Fatal(err)
+	}
+	if err := fillPropertyTable(&p10, genPropertyTable(25, 1600, 10), InterpolationLinear); err != nil {
+		t.Fatal(err)
+	}
+	// 焓值是温度的线性函数，不同温度间隔的表插值结果应一致
+	for temp := 25; temp <= 1595; temp++ {
+		if math.Abs(float64(p1.Enthalpy[temp-1]-p10.Enthalpy[temp-1])) > 1 {
+			t.Fatal("温度", temp, "处的焓值不一致", p1.Enthalpy[temp-1], p10.Enthalpy[temp-1])
+		}
+	}
+	// 10℃ 间隔表的数据点为 25、35、…、1595，1445~1455 之间的导热系数应线性过渡
+	if p10.Lambda[1450-1] != 35 {
+		t.Fatal("导热系数插值错误", p10.Lambda[1450-1])
+	}
+	// 表外的温度保持端点值
+	if p10.Enthalpy[0] != p10.Enthalpy[24] || p10.Lambda[ArrayLength-1] != 40 {
+		t.Fatal("表外温度未保持端点值")
+	}
+}
+
+func TestFillPropertyTableMonotoneCubic(t *testing.T) {
+	var p Parameter
+	rows := genPropertyTable(25, 1600, 10)
+	if err := fillPropertyTable(&p, rows, InterpolationMonotoneCubic); err != nil {
+		t.Fatal(err)
+	}
+	// 经过数据点
+	for _, row := range rows {
+		if p.Lambda[int(row.Temperature)-1] != row.ThermalConductivity {
+			t.Fatal("温度", row.Temperature, "处未经过数据点")
+		}
+	}
+	// 台阶处不产生过冲，焓值保持单调递增
+	for i := 1; i < ArrayLength; i++ {
+		if p.Lambda[i] < 30 || p.Lambda[i] > 40 {
+			t.Fatal("导热系数在温度", i+1, "处过冲", p.Lambda[i])
+		}
+		if p.Lambda[i] < p.Lambda[i-1] {
+			t.Fatal("导热系数在温度", i+1, "处不单调")
+		}
+		if i >= 25 && i < 1595 && p.Enthalpy[i] <= p.Enthalpy[i-1] {
+			t.Fatal("焓值在温度", i+1, "处不单调")
+		}
+	}
+}
+
+func TestFillPropertyTableUnknownMethod(t *testing.T) {
+	var p Parameter
+	if fillPropertyTable(&p, genPropertyTable(25, 100, 5), "spline") == nil {
+		t.Fatal("不支持的插值方式应返回错误")
+	}
+}
@@ -0,0 +1,110 @@
+package calculator
+
+import (
+	"fmt"
+	"lz/model"
+)
+
+// 计算断面
+//
+// 内外弧冷却条件相同时铸坯断面关于宽度中心线和厚度中心线都对称，只需计算四分之一断面；
+// 内外弧水量不同或一侧喷嘴堵塞时厚度方向不再对称，此时计算半断面（整个厚度，宽度方向的一半）。
+//
+// 四分之一断面：第 Width/YStep-1 行为内弧宽面，第 0 行为厚度中心线（对称面）。
+// 半断面：第 Width/YStep-1 行为内弧宽面，第 0 行为外弧宽面，厚度中心线位于第 Width/YStep/2 行附近。
+// 两种断面的第 Length/XStep-1 列均为窄面，第 0 列均为宽度中心线（对称面）。
+//
+// 热流密度和综合换热系数的存放位置：[0, Nx) 为内弧宽面，[Nx, Nx+Ny) 为窄面，[Nx+Ny, 2Nx+Ny) 为外弧宽面，
+// 其中 Nx = Length/XStep，Ny = Width/YStep，外弧宽面仅在半断面时使用。
+
+const (
+	SectionQuarter = "quarter" // 四分之一断面
+	SectionHalf    = "half"    // 半断面，内外弧分别计算
+)
+
+// 当前的计算断面，需在创建计算器之前通过 SetSection 设置
+var SectionMode = SectionQuarter
+
+// 设置计算断面和对应的铸坯尺寸，length、width 为铸坯的宽度和厚度 mm，mode 为空时使用 config.ini 中的配置
+func SetSection(mode string, length, width int) error {
+	mode, l, w, err := ResolveSection(mode, length, width)
+	if err != nil {
+		return err
+	}
+	SectionMode = mode
+	Length, Width = l, w
+	return nil
+}
+
+// 检查计算断面和铸坯尺寸，返回 SetSection 会设置的断面 SectionMode 和计算区域的尺寸 Length、Width，不修改全局变量
+func ResolveSection(mode string, length, width int) (string, int, int, error) {
+	if mode == "" {
+		mode = calCfg.Section
+	}
+	if mode == "" {
+		mode = SectionQuarter
+	}
+	if mode != SectionQuarter && mode != SectionHalf {
+		return "", 0, 0, fmt.Errorf("不支持的计算断面 %s，可选 %s、%s", mode, SectionQuarter, SectionHalf)
+	}
+	l, w := length/2, width/2
+	maxWidth := model.Width * 2
+	if mode == SectionHalf {
+		w, maxWidth = width, model.Width
+		if w/YStep%2 != 0 {
+			return "", 0, 0, fmt.Errorf("半断面计算时铸坯厚度 %dmm 需为 %dmm 的偶数倍", width, YStep)
+		}
+	}
+	if l/XStep < 2 || w/YStep < 2 {
+		return "", 0, 0, fmt.Errorf("铸坯尺寸 %dx%d 过小", length, width)
+	}
+	if l > model.Length || w > model.Width {
+		return "", 0, 0, fmt.Errorf("铸坯尺寸 %dx%d 超过 %s 断面计算的最大尺寸 %dx%d", length, width, mode, model.Length*2, maxWidth)
+	}
+	return mode, l, w, nil
+}
+
+func isHalfSection() bool {
+	return SectionMode == SectionHalf
+}
+
+// 厚度中心线所在的行，四分之一断面为第 0 行，半断面为中间一行
+func centerRow() int {
+	if isHalfSection() {
+		return Width / YStep / 2
+	}
+	return 0
+}
+
+// 厚度中心线到内弧宽面的行数
+func quarterRows() int {
+	return Width/YStep - centerRow()
+}
+
+// 外弧宽面第 x 列在热流密度和综合换热系数中的位置
+func outerArcIndex(x int) int {
+	return Length/XStep + Width/YStep + x
+}
+
+// 半断面时由内弧一侧的窄面数据得到外弧一侧的窄面数据：窄面第 Nx+k 个元素对应第 Ny-1-k 行，第 Nx+Ny-1-k 个元素对应第 k 行
+func mirrorNarrowFace(arr *[model.WL]float32) {
+	for k := 0; k < quarterRows(); k++ {
+		arr[Length/XStep+Width/YStep-1-k] = arr[Length/XStep+k]
+	}
+}
+
+// 外弧宽面第 x 列对温度变化的贡献，与内弧宽面的 GetQ(x, y, z)/(2*stdYStep) 一项相对应，四分之一断面时第 0 行为对称面，没有热流
+func outerArcQ(parameter *Parameter, x, z int) float32 {
+	if !isHalfSection() {
+		return 0
+	}
+	return parameter.GetQ(x, -1, z) / (2 * stdYStep)
+}
+
+// 外弧宽面第 x 列对时间步长的影响，与内弧宽面的 GetHeff(x, y, z)/stdYStep 一项相对应
+func outerArcHeff(parameter *Parameter, x, z int) float32 {
+	if !isHalfSection() {
+		return 0
+	}
+	return parameter.GetHeff(x, -1, z) / stdYStep
+}
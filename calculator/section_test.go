@@ -0,0 +1,143 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+	"testing"
+)
+
+func TestSetSection(t *testing.T) {
+	defer func() {
+		SectionMode = SectionQuarter
+	}()
+	if err := SetSection(SectionQuarter, 1260, 230); err != nil || Length != 630 || Width != 115 {
+		t.Fatal("四分之一断面尺寸错误", err, Length, Width)
+	}
+	if err := SetSection(SectionHalf, 1260, 230); err != nil || Length != 630 || Width != 230 || !isHalfSection() {
+		t.Fatal("半断面尺寸错误", err, Length, Width)
+	}
+	if centerRow() != 23 || quarterRows() != 23 {
+		t.Fatal("厚度中心线位置错误", centerRow(), quarterRows())
+	}
+	cases := map[string][3]interface{}{
+		"未知断面":   {"full", 1260, 230},
+		"厚度不是偶数": {SectionHalf, 1260, 225},
+		"超过最大尺寸": {SectionHalf, 1260, model.Width + 2*YStep},
+	}
+	for name, args := range cases {
+		if SetSection(args[0].(string), args[1].(int), args[2].(int)) == nil {
+			t.Fatal(name, "未返回错误")
+		}
+	}
+}
+
+// 半断面中关于厚度中心线对称的切片，四个面的热流密度相同
+func newHalfSectionTestSlice(t *testing.T) (*model.ItemType, *Steel) {
+	ZLength = 200
+	if err := SetSection(SectionHalf, 100, 40); err != nil {
+		t.Fatal(err)
+	}
+	steel, err := NewSteel(3, &CastingMachine{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := range steel.Parameter.Q[0] {
+		steel.Parameter.Q[0][j] = 2e5
+	}
+	var slice model.ItemType
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			slice[y][x] = 1500 - 10*abs(float32(2*y-(Width/YStep-1))) - float32(x)
+		}
+	}
+	return &slice, steel
+}
+
+func checkSymmetric(t *testing.T, slice, target *model.ItemType) {
+	ny := Width / YStep
+	for y := 0; y < ny; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			if math.Abs(float64(target[y][x]-target[ny-1-y][x])) > 1e-2 {
+				t.Fatal("内外弧冷却相同时温度场应关于厚度中心线对称", y, x, target[y][x], target[ny-1-y][x])
+			}
+		}
+	}
+	for x := 0; x < Length/XStep; x++ {
+		if target[0][x] >= slice[0][x] {
+			t.Fatal("外弧宽面未被冷却", x, slice[0][x], target[0][x])
+		}
+	}
+}
+
+func TestHalfSectionExplicit(t *testing.T) {
+	defer func() {
+		SectionMode = SectionQuarter
+	}()
+	slice, steel := newHalfSectionTestSlice(t)
+	c := NewCalculatorWithArrDeque(nil)
+	c.steel1 = steel
+	steel.CastingMachine = c.castingMachine
+	c.addFirstSlice(0)
+	*c.thermalField.GetSlice(0) = *slice
+	c.runningState = stateRunning
+	c.alternating = true
+	c.calculateSliceSpirally(0.05, 0, c.thermalField.GetSlice(0))
+	checkSymmetric(t, slice, c.thermalField1.GetSlice(0))
+}
+
+func TestHalfSectionADI(t *testing.T) {
+	defer func() {
+		SectionMode = SectionQuarter
+	}()
+	slice, steel := newHalfSectionTestSlice(t)
+	var target model.ItemType
+	adiSlice(1, 0, slice, &target, steel.Parameter, 1, 1)
+	checkSymmetric(t, slice, &target)
+}
+
+func TestHalfSectionNarrowSurfaceQ(t *testing.T) {
+	defer func() {
+		SectionMode = SectionQuarter
+	}()
+	_, steel := newHalfSectionTestSlice(t)
+	c := NewCalculatorWithArrDeque(nil)
+	c.steel1 = steel
+	steel.CastingMachine = c.castingMachine
+	c.castingMachine.Coordinate.MdLength = ZStep
+	c.castingMachine.CoolerConfig.NarrowSurfaceIn = 30
+	c.castingMachine.CoolerConfig.NarrowSurfaceOut = 30
+	c.addFirstSlice(1600)
+	// 外弧角部已经冷却，结晶器窄面的初始热流密度应按厚度中心处的温度计算
+	c.thermalField.GetSlice(0)[0][Length/XStep-1] = 900
+	c.calculateNarrowSurfaceEnergy(1000)
+	want := 1 / (ROfWater(3000.0, 0.005, 30) + ROfCu() + 1.0/1000) * (1600 - 30)
+	if got := steel.Parameter.Q[0][Length/XStep+Width/YStep-1-centerRow()]; math.Abs(float64(got-want)) > 1e-3*float64(want) {
+		t.Fatal("窄面初始热流密度错误", got, want)
+	}
+}
+
+func TestCheckEnv(t *testing.T) {
+	outer := float32(80)
+	negative := float32(-1)
+	env := model.Env{
+		SecondaryCoolingWaterCfg: []model.SecondaryCoolingWaterSection{
+			{InnerArcWaterVolume: 100, NarrowSideWaterVolume: 20},
+			{InnerArcWaterVolume: 100, OuterArcWaterVolume: &outer, NarrowSideWaterVolume: 20},
+		},
+		CoolingZoneCfg: make([]model.CoolingZone, 2),
+	}
+	if err := CheckEnv(env); err != nil {
+		t.Fatal(err)
+	}
+	if env.SecondaryCoolingWaterCfg[0].OuterArcVolume() != 100 || env.SecondaryCoolingWaterCfg[1].OuterArcVolume() != 80 {
+		t.Fatal("外弧水量错误")
+	}
+	env.SecondaryCoolingWaterCfg[1].OuterArcWaterVolume = &negative
+	if CheckEnv(env) == nil {
+		t.Fatal("外弧水量为负数时未返回错误")
+	}
+	env.SecondaryCoolingWaterCfg = env.SecondaryCoolingWaterCfg[:1]
+	if CheckEnv(env) == nil {
+		t.Fatal("分区数不一致时未返回错误")
+	}
+}
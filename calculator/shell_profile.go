@@ -0,0 +1,67 @@
+package calculator
+
+// 沿拉坯方向的坯壳厚度分布
+//
+// 在结晶器出口和二冷区每个辊子处取该位置之前的一个切片（与 calculateSolidThickness 相同），
+// 按固相线温度计算宽面中心、窄面中心和角部的坯壳厚度。结晶器出口坯壳厚度与安全下限之差为漏钢裕量。
+
+const defaultMinMoldExitShell = 8.0 // 默认的结晶器出口坯壳厚度安全下限 mm
+
+type ShellProfile struct {
+	Time           float64                `json:"time"`            // 模拟时间 s
+	MoldExit       *ShellThicknessSample  `json:"mold_exit"`       // 结晶器出口坯壳厚度，铸坯还未到达时为空
+	MinShell       float32                `json:"min_shell"`       // 结晶器出口坯壳厚度的安全下限 mm
+	BreakoutMargin float32                `json:"breakout_margin"` // 漏钢裕量 mm，结晶器出口宽面、窄面、角部中最薄处与安全下限之差，小于 0 时有漏钢危险
+	Rollers        []ShellThicknessSample `json:"rollers"`         // 每个辊子处的坯壳厚度，只包括铸坯已经到达的辊子
+}
+
+// 计算当前温度场沿拉坯方向的坯壳厚度
+func (c *calculatorWithArrDeque) ShellProfile() *ShellProfile {
+	profile := &ShellProfile{
+		Time:     c.clock.Seconds(),
+		MinShell: minMoldExitShell(),
+		Rollers:  make([]ShellThicknessSample, 0),
+	}
+	moldExit := float32(c.castingMachine.Coordinate.MdLength) - c.castingMachine.Coordinate.LevelHeight
+	steels := c.steels()
+	if sample, ok := c.shellThicknessAt(steels, moldExit); ok {
+		profile.MoldExit = &sample
+		profile.BreakoutMargin = sample.Thinnest() - profile.MinShell
+	}
+	for _, item := range c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.NozzleCfg.WideItems {
+		sample, ok := c.shellThicknessAt(steels, item.Distance)
+		if !ok {
+			break
+		}
+		profile.Rollers = append(profile.Rollers, sample)
+	}
+	return profile
+}
+
+// 距弯月面 distance 处的坯壳厚度，该位置之前的切片还不存在时返回 false
+func (c *calculatorWithArrDeque) shellThicknessAt(steels steelSnapshot, distance float32) (ShellThicknessSample, bool) {
+	z := int(distance/float32(ZStep)) - 1
+	if z < 0 || z >= c.Field.Size() {
+		return ShellThicknessSample{}, false
+	}
+	slice := c.Field.GetSlice(z)
+	// 跳过为空的切片， 即值为-1
+	if slice[0][0] == -1 {
+		return ShellThicknessSample{}, false
+	}
+	sample := shellThicknessOfSlice(z, slice, steels.at(z).SolidPhaseTemperature)
+	sample.Distance = distance
+	return sample, true
+}
+
+func minMoldExitShell() float32 {
+	if calCfg.MinMoldExitShell > 0 {
+		return calCfg.MinMoldExitShell
+	}
+	return defaultMinMoldExitShell
+}
+
+// 漏钢裕量是否不足
+func (p *ShellProfile) BreakoutRisk() bool {
+	return p.MoldExit != nil && p.BreakoutMargin < 0
+}
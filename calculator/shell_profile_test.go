@@ -0,0 +1,50 @@
+package calculator
+
+import (
+	"lz/model"
+	"testing"
+)
+
+func TestShellProfile(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	c.castingMachine.Coordinate.MdLength, c.castingMachine.Coordinate.LevelHeight = 60, 10
+	c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.NozzleCfg.WideItems = []model.WideItem{{Distance: 100}, {Distance: 150}, {Distance: 300}}
+	profile := c.ShellProfile()
+	if profile.MoldExit != nil || len(profile.Rollers) != 0 || profile.BreakoutRisk() {
+		t.Fatal("铸坯未到达时不应有坯壳厚度", profile)
+	}
+
+	// 第 z 个切片宽面有 z/5 层节点低于固相线，窄面和角部没有
+	solid := c.steel1.SolidPhaseTemperature
+	for z := 0; z < ZLength/ZStep; z++ {
+		c.addLastSlice(solid + 10)
+		slice := c.thermalField.GetSlice(z)
+		for j := 0; j < z/5; j++ {
+			for i := 0; i < Length/XStep-1; i++ {
+				slice[Width/YStep-1-j][i] = solid - 10
+			}
+		}
+	}
+	profile = c.ShellProfile()
+	// 结晶器出口距弯月面 50mm，取第 4 个切片
+	if profile.MoldExit == nil || profile.MoldExit.Distance != 50 || profile.MoldExit.Wide != 0 {
+		t.Fatal("结晶器出口坯壳厚度错误", profile.MoldExit)
+	}
+	if profile.MinShell != defaultMinMoldExitShell || profile.BreakoutMargin != -defaultMinMoldExitShell || !profile.BreakoutRisk() {
+		t.Fatal("漏钢裕量错误", profile.BreakoutMargin)
+	}
+	// 超出铸机的辊子不计算
+	if len(profile.Rollers) != 2 {
+		t.Fatal("辊子数量错误", len(profile.Rollers))
+	}
+	if profile.Rollers[0].Distance != 100 || profile.Rollers[0].Wide != float32(YStep) || profile.Rollers[1].Wide != float32(2*YStep) {
+		t.Fatal("辊子处坯壳厚度错误", profile.Rollers)
+	}
+	if profile.Rollers[1].Narrow != 0 || profile.Rollers[1].Corner != 0 {
+		t.Fatal("窄面和角部坯壳厚度错误", profile.Rollers[1])
+	}
+}
@@ -0,0 +1,67 @@
+package calculator
+
+import (
+	"time"
+)
+
+// 切片的生成时间和走过的距离
+//
+// 拉速变化或停浇时，切片在铸机内的位置和停留时间不能再由切片下标和当前拉速推算，
+// 因此每个切片记录自己完全进入弯月面的模拟时间 Birth 和之后走过的距离 Distance，每个时间步长按当时的拉速累加。
+
+// 推送给前端的切片跟踪信息
+type SliceTrack struct {
+	BirthTime     float64 `json:"birth_time"`     // 切片完全进入弯月面时的模拟时间 s
+	Distance      float64 `json:"distance"`       // 切片离开弯月面后走过的距离 mm
+	ResidenceTime float64 `json:"residence_time"` // 切片在铸机内的停留时间 s
+}
+
+// 模拟时间增加 duration，铸机内已有的切片以拉速 v(mm/s) 前进
+func (c *calculatorWithArrDeque) advanceSlices(duration time.Duration, v int64) {
+	c.clock += duration
+	if v == 0 {
+		return
+	}
+	d := float64(v) * duration.Seconds()
+	for z := 0; z < c.sliceMeta.Size(); z++ {
+		c.sliceMeta.Get(z).Distance += d
+	}
+}
+
+// 本次新加入的 add 个切片：第 j 个切片在累计距离达到 j 个切片厚度时完全进入弯月面，
+// reminder 为本次计算前的余数，distance 为本次结束时的累计距离，单位与 updateSliceInfo 相同
+func (c *calculatorWithArrDeque) trackNewSlices(add int, reminder, distance int64, duration time.Duration, v int64) {
+	if add > c.sliceMeta.Size() {
+		add = c.sliceMeta.Size()
+	}
+	start := c.clock - duration
+	for j := 1; j <= add; j++ {
+		meta := c.sliceMeta.Get(add - j) // 先加入的切片离弯月面更远
+		passed := int64(j)*1e7 - reminder
+		meta.Birth = start + time.Duration(passed/v)*time.Microsecond
+		meta.Distance = float64(distance-int64(j)*1e7) / 1e6
+	}
+}
+
+// 稳态温度场中切片以恒定拉速从弯月面走到当前位置
+func (c *calculatorWithArrDeque) trackSteadySlices() {
+	v := float64(c.castingMachine.CoolerConfig.V)
+	for z := 0; z < c.sliceMeta.Size(); z++ {
+		meta := c.sliceMeta.Get(z)
+		meta.Distance = float64(z * ZStep)
+		meta.Birth = c.clock - time.Duration(meta.Distance/v*1e9)
+	}
+}
+
+// 第 z 个切片的跟踪信息
+func (c *calculatorWithArrDeque) buildSliceTrack(z int) SliceTrack {
+	if z < 0 || z >= c.sliceMeta.Size() {
+		return SliceTrack{}
+	}
+	meta := c.sliceMeta.Get(z)
+	return SliceTrack{
+		BirthTime:     meta.Birth.Seconds(),
+		Distance:      meta.Distance,
+		ResidenceTime: (c.clock - meta.Birth).Seconds(),
+	}
+}
@@ -0,0 +1,50 @@
+package calculator
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func checkSliceTrack(t *testing.T, c *calculatorWithArrDeque, z int, birth, distance, residence float64) {
+	track := c.buildSliceTrack(z)
+	if math.Abs(track.BirthTime-birth) > 1e-6 || math.Abs(track.Distance-distance) > 1e-6 || math.Abs(track.ResidenceTime-residence) > 1e-6 {
+		t.Fatal("切片跟踪信息错误", z, track)
+	}
+}
+
+func TestUpdateSliceInfoTrack(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	c.castingMachine.CoolerConfig.V = 20
+	c.updateSliceInfo(700 * time.Millisecond)
+	if c.Field.Size() != 1 {
+		t.Fatal("切片数错误", c.Field.Size())
+	}
+	// 0.5s 时走过一个切片的厚度，之后又走了 0.2s
+	checkSliceTrack(t, c, 0, 0.5, 4, 0.2)
+	c.updateSliceInfo(300 * time.Millisecond)
+	checkSliceTrack(t, c, 0, 1, 0, 0)
+	checkSliceTrack(t, c, 1, 0.5, 10, 0.5)
+
+	// 停浇时切片位置不变，停留时间继续增加
+	c.castingMachine.CoolerConfig.V = 0
+	c.updateSliceInfo(5 * time.Second)
+	if c.Field.Size() != 2 {
+		t.Fatal("停浇时不应产生新切片", c.Field.Size())
+	}
+	checkSliceTrack(t, c, 1, 0.5, 10, 5.5)
+
+	// 降速后产生一个切片需要更长的时间
+	c.castingMachine.CoolerConfig.V = 10
+	c.updateSliceInfo(time.Second)
+	checkSliceTrack(t, c, 0, 7, 0, 0)
+	checkSliceTrack(t, c, 1, 1, 10, 6)
+	checkSliceTrack(t, c, 2, 0.5, 20, 6.5)
+	if c.BuildSliceData(2).Distance != 20 || c.GenerateSLiceInfo(2).ResidenceTime != 6.5 {
+		t.Fatal("切片查询中的跟踪信息错误")
+	}
+}
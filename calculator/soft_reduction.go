@@ -0,0 +1,134 @@
+package calculator
+
+import (
+	"errors"
+	"lz/model"
+)
+
+// 轻压下扇形段建议
+//
+// 按物性参数中固相率与温度的关系，由宽度中心厚度中心的温度得到沿拉坯方向的中心固相率，
+// 中心固相率处于窗口内的区间与扇形段（首末辊子之间）有重叠时，该扇形段应投入轻压下。
+// 温度场随拉速和冷却条件变化，建议随温度场一起周期性推送。
+
+const (
+	defaultSoftReductionStart = 0.3 // 默认的中心固相率窗口下限
+	defaultSoftReductionEnd   = 0.7 // 默认的中心固相率窗口上限
+)
+
+// 一个扇形段的中心固相率及是否应投入轻压下
+type SegmentReduction struct {
+	Seg         string  `json:"seg"`
+	Start       float32 `json:"start"`        // 扇形段第一个辊子距弯月面的距离 mm
+	End         float32 `json:"end"`          // 扇形段最后一个辊子距弯月面的距离 mm
+	MinFraction float32 `json:"min_fraction"` // 扇形段内中心固相率的最小值，铸坯还未到达时为 0
+	MaxFraction float32 `json:"max_fraction"` // 扇形段内中心固相率的最大值
+	Reduction   bool    `json:"reduction"`    // 是否应投入轻压下
+}
+
+type SoftReductionData struct {
+	Time        float64                   `json:"time"`        // 模拟时间 s
+	Speed       float32                   `json:"speed"`       // 拉速 m/min
+	Window      model.SoftReductionWindow `json:"window"`      // 中心固相率窗口
+	Start       float32                   `json:"start"`       // 中心固相率处于窗口内的区间起点 mm，铸机内还未到达窗口时为 0
+	End         float32                   `json:"end"`         // 中心固相率处于窗口内的区间终点 mm
+	Segments    []SegmentReduction        `json:"segments"`    // 所有扇形段
+	Recommended []string                  `json:"recommended"` // 应投入轻压下的扇形段
+}
+
+func defaultReductionWindow() model.SoftReductionWindow {
+	window := model.SoftReductionWindow{Start: calCfg.SoftReductionStart, End: calCfg.SoftReductionEnd}
+	if checkReductionWindow(window) != nil {
+		window = model.SoftReductionWindow{Start: defaultSoftReductionStart, End: defaultSoftReductionEnd}
+	}
+	return window
+}
+
+func checkReductionWindow(window model.SoftReductionWindow) error {
+	if window.Start < 0 || window.End > 1 || window.Start >= window.End {
+		return errors.New("中心固相率窗口需要满足 0 <= start < end <= 1")
+	}
+	return nil
+}
+
+// 设置轻压下的中心固相率窗口
+func (c *calculatorWithArrDeque) SetSoftReductionWindow(window model.SoftReductionWindow) error {
+	if err := checkReductionWindow(window); err != nil {
+		return err
+	}
+	c.reductionWindow = window
+	return nil
+}
+
+// 钢种为 steel 的切片在宽度中心的中心固相率
+func centerSolidFraction(steel *Steel, item *model.ItemType) float32 {
+	index := int(coreTemperature(item, 0))
+	if index < 0 {
+		index = 0
+	}
+	if index > ArrayLength {
+		index = ArrayLength
+	}
+	return steel.Parameter.SolidFraction[index]
+}
+
+// 按当前温度场计算应投入轻压下的扇形段
+func (c *calculatorWithArrDeque) SoftReduction() *SoftReductionData {
+	window := c.reductionWindow
+	res := &SoftReductionData{
+		Time:        c.clock.Seconds(),
+		Speed:       c.castingMachine.speed,
+		Window:      window,
+		Segments:    make([]SegmentReduction, 0, len(c.castingMachine.Segments)),
+		Recommended: make([]string, 0),
+	}
+	fractions := make([]float32, c.Field.Size())
+	steels := c.steels()
+	c.Field.Traverse(func(z int, item *model.ItemType) {
+		// 跳过为空的切片， 即值为-1
+		if item[0][0] == -1 {
+			fractions[z] = -1
+			return
+		}
+		fractions[z] = centerSolidFraction(steels.at(z), item)
+		if fractions[z] >= window.Start && fractions[z] <= window.End {
+			distance := float32((z + 1) * ZStep)
+			if res.Start == 0 {
+				res.Start = distance
+			}
+			res.End = distance
+		}
+	}, 0, c.Field.Size())
+
+	wideItems := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.NozzleCfg.WideItems
+	for _, segment := range c.castingMachine.Segments {
+		if segment.Start < 1 || segment.End < segment.Start || segment.End > len(wideItems) {
+			continue
+		}
+		reduction := SegmentReduction{
+			Seg:   segment.Seg,
+			Start: wideItems[segment.Start-1].Distance,
+			End:   wideItems[segment.End-1].Distance,
+		}
+		// 与 calculateSolidThickness 相同，辊子处取该位置之前的一个切片
+		first := true
+		for z := int(reduction.Start/float32(ZStep)) - 1; z <= int(reduction.End/float32(ZStep))-1 && z < len(fractions); z++ {
+			if z < 0 || fractions[z] == -1 {
+				continue
+			}
+			if first || fractions[z] < reduction.MinFraction {
+				reduction.MinFraction = fractions[z]
+			}
+			if first || fractions[z] > reduction.MaxFraction {
+				reduction.MaxFraction = fractions[z]
+			}
+			first = false
+		}
+		reduction.Reduction = res.Start != 0 && reduction.Start <= res.End && reduction.End >= res.Start
+		if reduction.Reduction {
+			res.Recommended = append(res.Recommended, segment.Seg)
+		}
+		res.Segments = append(res.Segments, reduction)
+	}
+	return res
+}
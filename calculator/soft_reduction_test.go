@@ -0,0 +1,78 @@
+package calculator
+
+import (
+	"lz/model"
+	"testing"
+)
+
+func TestSetSoftReductionWindow(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if c.reductionWindow.Start != defaultSoftReductionStart || c.reductionWindow.End != defaultSoftReductionEnd {
+		t.Fatal("默认固相率窗口错误", c.reductionWindow)
+	}
+	for _, window := range []model.SoftReductionWindow{{Start: -0.1, End: 0.5}, {Start: 0.5, End: 1.1}, {Start: 0.7, End: 0.3}} {
+		if c.SetSoftReductionWindow(window) == nil {
+			t.Fatal("固相率窗口错误时应返回错误", window)
+		}
+	}
+	if err := c.SetSoftReductionWindow(model.SoftReductionWindow{Start: 0.2, End: 0.9}); err != nil || c.reductionWindow.End != 0.9 {
+		t.Fatal("设置固相率窗口失败", err)
+	}
+}
+
+func TestSoftReduction(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.NozzleCfg.WideItems = []model.WideItem{
+		{Distance: 20}, {Distance: 50}, {Distance: 80}, {Distance: 110}, {Distance: 140}, {Distance: 170}, {Distance: 300},
+	}
+	c.castingMachine.Segments = []model.Segment{
+		{Seg: "Seg_0", Start: 1, End: 2}, {Seg: "Seg_1", Start: 3, End: 4}, {Seg: "Seg_2", Start: 5, End: 6},
+		{Seg: "Seg_3", Start: 7, End: 7}, {Seg: "Seg_4", Start: 7, End: 8},
+	}
+	// 中心温度在第 5 到 15 个切片之间从液相线线性下降到固相线
+	liquid, solid := c.steel1.LiquidPhaseTemperature, c.steel1.SolidPhaseTemperature
+	for z := 0; z < ZLength/ZStep; z++ {
+		temp := liquid + 10
+		if z >= 15 {
+			temp = solid - 10
+		} else if z >= 5 {
+			temp = liquid - (liquid-solid)*float32(z-5)/10
+		}
+		c.addLastSlice(temp)
+	}
+	res := c.SoftReduction()
+	var first, last int
+	for z := 0; z < ZLength/ZStep; z++ {
+		fs := centerSolidFraction(c.getSteel(z), c.Field.GetSlice(z))
+		if fs >= res.Window.Start && fs <= res.Window.End {
+			if first == 0 {
+				first = z + 1
+			}
+			last = z + 1
+		}
+	}
+	if first == 0 || res.Start != float32(first*ZStep) || res.End != float32(last*ZStep) {
+		t.Fatal("中心固相率窗口区间错误", res.Start, res.End, first, last)
+	}
+	// 超出辊子范围的扇形段忽略，铸坯未到达的扇形段固相率为 0
+	if len(res.Segments) != 4 || res.Segments[3].MaxFraction != 0 || res.Segments[3].Reduction {
+		t.Fatal("扇形段错误", res.Segments)
+	}
+	for _, segment := range res.Segments[:3] {
+		overlap := segment.Start <= res.End && segment.End >= res.Start
+		if segment.Reduction != overlap || segment.MinFraction > segment.MaxFraction {
+			t.Fatal("扇形段轻压下建议错误", segment, res.Start, res.End)
+		}
+	}
+	if res.Segments[0].MaxFraction != 0 || res.Segments[2].MinFraction <= res.Window.End {
+		t.Fatal("扇形段中心固相率错误", res.Segments)
+	}
+	if len(res.Recommended) == 0 || res.Recommended[0] != "Seg_1" {
+		t.Fatal("建议投入轻压下的扇形段错误", res.Recommended)
+	}
+}
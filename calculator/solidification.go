@@ -0,0 +1,51 @@
+package calculator
+
+import (
+	"lz/model"
+)
+
+// 液芯末端和凝固末端
+//
+// 沿拉坯方向，铸坯厚度中心的温度首次低于液相线温度的位置为液芯末端，首次低于固相线温度的位置为凝固末端，
+// 宽度中心处的凝固末端即冶金长度。与 GenerateVerticalSlice2Data 中的 LiquidJoin、SolidJoin 相同，
+// 但只统计宽度中心和 1/4 宽度两列，计算量很小，每次推送温度场时一并推送。
+
+// 一列上的液芯末端和凝固末端，单位 mm，为距弯月面的距离，铸机内还未到达时为 0
+type SolidificationPoint struct {
+	LiquidEnd float32 `json:"liquid_end"` // 液芯末端，中心温度低于液相线温度
+	SolidEnd  float32 `json:"solid_end"`  // 凝固末端，中心温度低于固相线温度
+}
+
+type SolidificationEndData struct {
+	Time    float64             `json:"time"`    // 模拟时间 s
+	Center  SolidificationPoint `json:"center"`  // 宽度中心
+	Quarter SolidificationPoint `json:"quarter"` // 1/4 宽度处，即宽度中心与窄面的中间
+}
+
+// 计算当前温度场的液芯末端和凝固末端
+func (c *calculatorWithArrDeque) SolidificationEnd() *SolidificationEndData {
+	res := &SolidificationEndData{Time: c.clock.Seconds()}
+	quarter := Length / XStep / 2
+	steels := c.steels()
+	c.Field.Traverse(func(z int, item *model.ItemType) {
+		// 跳过为空的切片， 即值为-1
+		if item[0][0] == -1 {
+			return
+		}
+		steel := steels.at(z)
+		distance := float32((z + 1) * ZStep)
+		res.Center.update(coreTemperature(item, 0), steel, distance)
+		res.Quarter.update(coreTemperature(item, quarter), steel, distance)
+	}, 0, c.Field.Size())
+	return res
+}
+
+// 按厚度中心温度 temp 更新位置 distance 处的液芯末端和凝固末端，只记录第一次到达的位置
+func (p *SolidificationPoint) update(temp float32, steel *Steel, distance float32) {
+	if p.LiquidEnd == 0 && temp <= steel.LiquidPhaseTemperature {
+		p.LiquidEnd = distance
+	}
+	if p.SolidEnd == 0 && temp <= steel.SolidPhaseTemperature {
+		p.SolidEnd = distance
+	}
+}
@@ -0,0 +1,50 @@
+package calculator
+
+import (
+	"testing"
+)
+
+func TestSolidificationEnd(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	liquid, solid := c.steel1.LiquidPhaseTemperature, c.steel1.SolidPhaseTemperature
+	// 宽度中心在第 10 个切片低于液相线、第 15 个切片低于固相线，1/4 宽度处分别提前 5 个切片
+	quarter := Length / XStep / 2
+	for z := 0; z < ZLength/ZStep; z++ {
+		c.addLastSlice(liquid + 10)
+		slice := c.thermalField.GetSlice(z)
+		switch {
+		case z >= 15:
+			slice[0][0] = solid - 1
+		case z >= 10:
+			slice[0][0] = (liquid + solid) / 2
+		}
+		switch {
+		case z >= 10:
+			slice[0][quarter] = solid - 1
+		case z >= 5:
+			slice[0][quarter] = liquid
+		}
+	}
+	res := c.SolidificationEnd()
+	if res.Center.LiquidEnd != float32(11*ZStep) || res.Center.SolidEnd != float32(16*ZStep) {
+		t.Fatal("宽度中心的液芯末端和凝固末端错误", res.Center)
+	}
+	if res.Quarter.LiquidEnd != float32(6*ZStep) || res.Quarter.SolidEnd != float32(11*ZStep) {
+		t.Fatal("1/4 宽度处的液芯末端和凝固末端错误", res.Quarter)
+	}
+	if res.Center.SolidEnd != c.BuildKPI().MetallurgicalLength {
+		t.Fatal("凝固末端与冶金长度不一致")
+	}
+
+	// 还未凝固时为 0
+	c.initSteadyStateField()
+	c.addLastSlice(liquid + 10)
+	res = c.SolidificationEnd()
+	if res.Center.LiquidEnd != 0 || res.Center.SolidEnd != 0 || res.Quarter.SolidEnd != 0 {
+		t.Fatal("未凝固时的液芯末端和凝固末端错误", res)
+	}
+}
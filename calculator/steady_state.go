@@ -0,0 +1,147 @@
+package calculator
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"lz/deque"
+	"lz/model"
+	"math"
+	"time"
+)
+
+// 稳态求解：拉速和冷却条件不变时，铸机内每个位置的温度不随时间变化，
+// 因此只需让一个切片从弯月面出发，以拉速走完整个铸机，切片经过第 z 个位置时的温度即为稳态温度场的第 z 个切片。
+//
+// 热流密度和综合换热系数依赖于温度场本身，所以先用上一次的温度场计算边界条件再推进切片，
+// 重复若干次直到两次之间温度的变化足够小。
+
+const (
+	steadyStateMaxPasses  = 5   // 外层迭代次数上限
+	steadyStateTolerance  = 1.0 // 两次迭代之间温度的最大变化小于该值时认为已收敛 ℃
+	steadyStateBCInterval = 10  // 第一次迭代时二冷区重新计算边界条件的间隔（切片数）
+	maxTimeStep           = 0.4 // 时间步长上限 s，与 calculateTimeStep 保持一致
+)
+
+// 求解当前拉速和冷却条件下的稳态温度场，求解结束后温度场充满铸机，可以继续从稳态开始进行非稳态计算
+func (c *calculatorWithArrDeque) SolveSteadyState() (*TemperatureFieldData, error) {
+	if c.runningState == stateRunning || c.runningState == stateRunningWithTwoSteel {
+		return nil, errors.New("正在进行非稳态计算，请先停止计算")
+	}
+	if c.steel1 == nil {
+		return nil, errors.New("钢种未设置")
+	}
+	if c.transition != nil {
+		return nil, errors.New("钢种切换过程中无法进行稳态计算")
+	}
+	if c.castingMachine.CoolerConfig.V <= 0 {
+		return nil, errors.New("拉速未设置")
+	}
+	c.applyOptionChange()
+	start := time.Now()
+	c.initSteadyStateField()
+	c.runningState = stateRunning
+	defer func() {
+		c.runningState = stateSuspended
+	}()
+
+	// 第一次迭代时切片逐个加入铸机末端，边界条件随切片的推进逐步计算，与非稳态计算中铸坯逐渐充满铸机的过程相同
+	c.marchSlice(true)
+	log.WithField("cost", time.Since(start)).Info("稳态计算初始温度场完成")
+	for pass := 2; pass <= steadyStateMaxPasses; pass++ {
+		c.calculateQAndHeffOnline()
+		maxDiff := c.marchSlice(false)
+		log.WithFields(log.Fields{"pass": pass, "max_diff": maxDiff, "cost": time.Since(start)}).Info("稳态计算迭代一次")
+		if maxDiff < steadyStateTolerance {
+			break
+		}
+	}
+	c.trackSteadySlices()
+	log.WithField("cost", time.Since(start)).Debug("稳态计算所需时间")
+	return c.BuildData(), nil
+}
+
+// 清空温度场，稳态计算时切片从铸机末端逐个加入
+func (c *calculatorWithArrDeque) initSteadyStateField() {
+	c.thermalField = deque.NewArrDeque(ZLength / ZStep)
+	c.thermalField1 = deque.NewArrDeque(ZLength / ZStep)
+	c.sliceMeta = newSliceMetaDeque(ZLength / ZStep)
+	c.Field = c.thermalField
+	c.alternating = true
+	c.isTail = false
+	c.reminder = 0
+}
+
+func (c *calculatorWithArrDeque) newSteadyStateSlice() model.ItemType {
+	var slice model.ItemType
+	for y := 0; y < Width/YStep; y++ {
+		for x := 0; x < Length/XStep; x++ {
+			slice[y][x] = c.castingMachine.CoolerConfig.StartTemperature
+		}
+	}
+	return slice
+}
+
+// 让一个切片从弯月面走到铸机末端，每经过一个位置就把切片的温度写入该位置，返回与上一次相比温度的最大变化
+//
+// grow 为 true 时温度场为空，切片每经过一个位置就在铸机末端加入一个切片，并按间隔重新计算边界条件
+func (c *calculatorWithArrDeque) marchSlice(grow bool) float32 {
+	dwell := float32(ZStep) / float32(c.castingMachine.CoolerConfig.V) // 切片经过一个位置所需的时间
+	mdEnd := (c.castingMachine.Coordinate.MdLength - int(c.castingMachine.Coordinate.LevelHeight)) / ZStep
+	cur := c.newSteadyStateSlice()
+	var maxDiff float32
+	for z := 0; z < ZLength/ZStep; z++ {
+		if grow {
+			c.addLastSlice(c.castingMachine.CoolerConfig.StartTemperature)
+			c.Field = c.thermalField
+			// 结晶器内每个切片都重新计算，二冷区按间隔计算
+			if z < mdEnd || z%steadyStateBCInterval == 0 {
+				*c.thermalField.GetSlice(z) = cur
+				c.calculateQAndHeffOnline()
+			}
+		}
+		pre := *c.thermalField.GetSlice(z)
+		*c.thermalField.GetSlice(z) = cur
+		*c.thermalField1.GetSlice(z) = cur
+		c.alternating = true
+
+		deltaT := c.timeStepOfSlice(z, &cur)
+		if c.solver == SolverExplicit && deltaT > maxTimeStep {
+			deltaT = maxTimeStep
+		}
+		steps := int(math.Ceil(float64(dwell / deltaT)))
+		deltaT = dwell / float32(steps)
+		for i := 0; i < steps; i++ {
+			// alternating 为 true 时读 thermalField 写 thermalField1，反之亦然
+			if c.alternating {
+				c.calculateSlice(deltaT, z, c.thermalField.GetSlice(z))
+			} else {
+				c.calculateSlice(deltaT, z, c.thermalField1.GetSlice(z))
+			}
+			if c.axialConduction {
+				c.conductAxially(deltaT, z, z+1, c.targetField())
+			}
+			c.alternating = !c.alternating
+		}
+		if c.alternating {
+			cur = *c.thermalField.GetSlice(z)
+		} else {
+			cur = *c.thermalField1.GetSlice(z)
+		}
+		*c.thermalField.GetSlice(z) = cur
+		*c.thermalField1.GetSlice(z) = cur
+
+		for y := 0; y < Width/YStep; y++ {
+			for x := 0; x < Length/XStep; x++ {
+				if d := abs(cur[y][x] - pre[y][x]); d > maxDiff {
+					maxDiff = d
+				}
+			}
+		}
+	}
+	c.Field = c.thermalField
+	c.alternating = true
+	c.isFull = c.Field.IsFull()
+	c.start = 0
+	c.end = c.Field.Size()
+	return maxDiff
+}
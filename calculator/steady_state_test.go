@@ -0,0 +1,127 @@
+package calculator
+
+import (
+	"io/ioutil"
+	"lz/config"
+	"testing"
+)
+
+func TestSolveSteadyStateCheck(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if _, err := c.SolveSteadyState(); err == nil {
+		t.Fatal("未设置钢种时应返回错误")
+	}
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	c.castingMachine.CoolerConfig.V = 0
+	if _, err := c.SolveSteadyState(); err == nil {
+		t.Fatal("未设置拉速时应返回错误")
+	}
+	c.castingMachine.CoolerConfig.V = 20
+	c.runningState = stateRunning
+	if _, err := c.SolveSteadyState(); err == nil {
+		t.Fatal("非稳态计算过程中应返回错误")
+	}
+}
+
+func TestInitSteadyStateField(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		c.addFirstSlice(1500)
+	}
+	c.initSteadyStateField()
+	if !c.Field.IsEmpty() || c.sliceMeta.Size() != 0 {
+		t.Fatal("稳态计算前温度场应为空")
+	}
+	// 切片从铸机末端逐个加入，下标与距弯月面的距离一致
+	for z := 0; z < ZLength/ZStep; z++ {
+		c.addLastSlice(float32(z))
+	}
+	if !c.thermalField.IsFull() || !c.thermalField1.IsFull() || c.sliceMeta.Size() != ZLength/ZStep {
+		t.Fatal("切片未充满铸机")
+	}
+	for z := 0; z < ZLength/ZStep; z++ {
+		if c.thermalField.GetSlice(z)[0][0] != float32(z) || c.thermalField1.GetSlice(z)[0][0] != float32(z) {
+			t.Fatal("切片顺序错误", z)
+		}
+	}
+	// 稳态温度场之后可以继续进行非稳态计算
+	c.removeLastSlice()
+	c.addFirstSlice(1500)
+	if c.Field.GetSlice(0)[0][0] != 1500 || c.Field.GetSlice(ZLength/ZStep - 1)[0][0] != float32(ZLength/ZStep-2) {
+		t.Fatal("稳态温度场移动后切片顺序错误")
+	}
+}
+
+// 按默认铸机的计算环境创建计算器。二冷区边界条件按铸机的所有辊子计算，计算长度不能短于铸机
+func newSteadyStateTestCalculator(t *testing.T) *calculatorWithArrDeque {
+	env, err := config.LoadEnv(config.CasterFile(config.DefaultCaster), "../conf/env.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nozzle, err := ioutil.ReadFile(config.NozzleFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = SetSection(env.SectionMode, env.Coordinate.Length, env.Coordinate.Width); err != nil {
+		t.Fatal(err)
+	}
+	ZLength = env.Coordinate.ZLength
+	c := NewCalculatorWithArrDeque(nil)
+	c.castingMachine.SetFromJson(env.Coordinate)
+	c.castingMachine.SetCoolerConfig(env, nozzle)
+	c.castingMachine.SetV(env.DragSpeed)
+	if err = c.InitSteel(env.SteelValue, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestSolveSteadyState(t *testing.T) {
+	if testing.Short() {
+		t.Skip("完整铸机的稳态计算耗时较长")
+	}
+	c := newSteadyStateTestCalculator(t)
+	mdEnd := (c.castingMachine.Coordinate.MdLength - int(c.castingMachine.Coordinate.LevelHeight)) / ZStep
+	data, err := c.SolveSteadyState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !data.IsFull || !c.Field.IsFull() || c.runningState != stateSuspended {
+		t.Fatal("稳态计算后温度场应充满铸机")
+	}
+
+	// 宽面中心的表面温度在结晶器内逐渐降低，始终低于厚度中心
+	surface := Width/YStep - 1
+	start := c.castingMachine.CoolerConfig.StartTemperature
+	pre := start
+	for z := 0; z < mdEnd; z++ {
+		temp := c.Field.Get(z, surface, 0)
+		if temp > pre+1 {
+			t.Fatal("结晶器内表面温度应逐渐降低", z, temp, pre)
+		}
+		if center := c.Field.Get(z, 0, 0); temp > center || center > start {
+			t.Fatal("表面温度应低于中心温度，中心温度不应高于浇注温度", z, temp, center)
+		}
+		pre = temp
+	}
+	if pre > start-100 {
+		t.Fatal("结晶器出口表面温度过高", pre)
+	}
+
+	// 从稳态温度场继续进行非稳态计算，温度场基本不变
+	steady := c.Field.Get(mdEnd, surface, 0)
+	c.runningState = stateRunning
+	for i := 0; i < 50; i++ {
+		c.step()
+	}
+	if temp := c.Field.Get(mdEnd, surface, 0); abs(temp-steady) > 20 {
+		t.Fatal("稳态温度场继续计算后结晶器出口表面温度变化过大", steady, temp)
+	}
+}
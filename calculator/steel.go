@@ -1,12 +1,9 @@
 package calculator
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"lz/model"
-	"sort"
 )
 
 const (
@@ -44,164 +41,107 @@ type Parameter struct {
 	TemperatureBottom float32                        // 温度下限
 }
 
-func NewSteel(number int, castingMachine *CastingMachine) *Steel {
-	// 根据钢种编号获取钢种信息
+// 根据钢种编号从钢种库中获取固液相线温度和物性参数，钢种不存在时返回错误
+func NewSteel(number int, castingMachine *CastingMachine) (*Steel, error) {
 	// todo 根据 参数中的 钢种从 jmatpro 接口获取对应的物性参数
-	// 1. 初始化网格划分的各个节点的初始温度
 	fmt.Println("钢种编号:", number)
-	// 获取固液相线温度
-	phaseTemperatureData, err := ioutil.ReadFile("E:/GoWorkPlace/src/lz/conf/phase_temperature.json")
+	grade, err := getSteelGrade(number)
 	if err != nil {
-		log.Println("err", err)
-		return nil
+		return nil, err
 	}
-
-	var phaseTemperature []model.PhaseTemperature
-	err = json.Unmarshal(phaseTemperatureData, &phaseTemperature)
-	if err != nil {
-		log.Println("err", err)
-		return nil
-	}
-	// 获取物性参数
-	physicalParameterData, err := ioutil.ReadFile("E:/GoWorkPlace/src/lz/conf/physical_parameter.json")
-	if err != nil {
-		log.Println("err", err)
-		return nil
-	}
-	var physicalParameter []model.PhysicalParameter
-	err = json.Unmarshal(physicalParameterData, &physicalParameter)
-	if err != nil {
-		log.Println("err", err)
-		return nil
-	}
-	sort.Slice(physicalParameter, func(i, j int) bool {
-		return physicalParameter[i].Temperature < physicalParameter[j].Temperature
-	})
+	physicalParameter := grade.physicalParameter
 	parameter := Parameter{
 		Q:    make([][model.WL]float32, ZLength/ZStep),
 		Heff: make([][model.WL]float32, ZLength/ZStep),
 	}
 	steel := Steel{
 		Number:                 number,
-		Name:                   phaseTemperature[0].SteelType.Name,
-		LiquidPhaseTemperature: phaseTemperature[0].LiquidPhaseTemperature,
-		SolidPhaseTemperature:  phaseTemperature[0].SolidPhaseTemperature,
+		Name:                   grade.grade.Name,
+		LiquidPhaseTemperature: grade.grade.LiquidPhaseTemperature,
+		SolidPhaseTemperature:  grade.grade.SolidPhaseTemperature,
 		Parameter:              &parameter,
 		CastingMachine:         castingMachine,
 	}
-	var t1, t2 int // 温度
-	var step float32
-	for i := 0; i < len(physicalParameter)-1; i++ {
-		t1 = int(physicalParameter[i].Temperature)
-		t2 = int(physicalParameter[i+1].Temperature)
-		// 1. 导热系数
-		steel.Parameter.Lambda[t1-1] = physicalParameter[i].ThermalConductivity
-		steel.Parameter.Lambda[t2-1] = physicalParameter[i+1].ThermalConductivity
-		step = (steel.Parameter.Lambda[t2-1] - steel.Parameter.Lambda[t1-1]) / 5
-		for j := 1; j < t2-t1; j++ {
-			steel.Parameter.Lambda[t1+j-1] = steel.Parameter.Lambda[t1-1] + step*float32(j)
-		}
-		// 2. 密度
-		steel.Parameter.Density[t1-1] = physicalParameter[i].Density
-		steel.Parameter.Density[t2-1] = physicalParameter[i+1].Density
-		step = (steel.Parameter.Density[t2-1] - steel.Parameter.Density[t1-1]) / 5
-		for j := 1; j < t2-t1; j++ {
-			steel.Parameter.Density[t1+j-1] = steel.Parameter.Density[t1-1] + step*float32(j)
-		}
-		// 3. 焓值
-		steel.Parameter.Enthalpy[t1-1] = physicalParameter[i].Enthalpy
-		steel.Parameter.Enthalpy[t2-1] = physicalParameter[i+1].Enthalpy
-		step = (steel.Parameter.Enthalpy[t2-1] - steel.Parameter.Enthalpy[t1-1]) / 5
-		for j := 1; j < t2-t1; j++ {
-			steel.Parameter.Enthalpy[t1+j-1] = steel.Parameter.Enthalpy[t1-1] + step*float32(j)
-		}
-		// 4. 比热容
-		steel.Parameter.C[t1-1] = physicalParameter[i].SpecficHeat
-		steel.Parameter.C[t2-1] = physicalParameter[i+1].SpecficHeat
-		step = (steel.Parameter.C[t2-1] - steel.Parameter.C[t1-1]) / 5
-		for j := 1; j < t2-t1; j++ {
-			steel.Parameter.C[t1+j-1] = steel.Parameter.C[t1-1] + step*float32(j)
-		}
-		// 5. 固相率
-		steel.Parameter.SolidFraction[t1] = 1 - physicalParameter[i].LiquidPhaseFraction
-		steel.Parameter.SolidFraction[t2] = 1 - physicalParameter[i+1].LiquidPhaseFraction
-		step = (steel.Parameter.SolidFraction[t2] - steel.Parameter.SolidFraction[t1]) / 5
-		for j := 1; j < t2-t1; j++ {
-			steel.Parameter.SolidFraction[t1+j] = steel.Parameter.SolidFraction[t1] + step*float32(j)
-		}
-		// 6. 发射率
-		steel.Parameter.Emissivity[t1] = physicalParameter[i].Emissivity
-		steel.Parameter.Emissivity[t2] = physicalParameter[i+1].Emissivity
-		step = (steel.Parameter.Emissivity[t2] - steel.Parameter.Emissivity[t1]) / 5
-		for j := 1; j < t2-t1; j++ {
-			steel.Parameter.Emissivity[t1+j] = steel.Parameter.Emissivity[t1] + step*float32(j)
-		}
+	// 1~6. 将物性参数表插值为按 1℃ 排列的数组
+	if err = fillPropertyTable(steel.Parameter, physicalParameter, calCfg.PropertyInterpolation); err != nil {
+		return nil, err
 	}
+	steel.initParameterFunctions()
+	return &steel, nil
+}
+
+// 根据物性参数数组设置焓温转换函数、导热修正系数K以及热流密度和综合换热系数的获取函数
+func (s *Steel) initParameterFunctions() {
 	// 6. 焓到温度的对应关系
-	steel.Parameter.Enthalpy2Temp = func(enthalpy float32) float32 {
-		left, right := 0, len(steel.Parameter.Enthalpy)-1
+	s.Parameter.Enthalpy2Temp = func(enthalpy float32) float32 {
+		left, right := 0, len(s.Parameter.Enthalpy)-1
 		for left < right {
 			m := left + (right-left+1)>>1
-			if steel.Parameter.Enthalpy[m] <= enthalpy {
+			if s.Parameter.Enthalpy[m] <= enthalpy {
 				left = m
 			} else {
 				right = m - 1
 			}
 		}
-		if enthalpy == steel.Parameter.Enthalpy[left] {
+		if enthalpy == s.Parameter.Enthalpy[left] {
 			return float32(left + 1)
 		}
 		if left+1 >= 1600 {
 			left = 1598
 		}
-		//fmt.Println(steel.Parameter.Enthalpy, enthalpy)
-		//fmt.Println(left, steel.Parameter.Enthalpy[left+1]-steel.Parameter.Enthalpy[left], enthalpy-steel.Parameter.Enthalpy[left])
-		return float32(left+1) + 1/(steel.Parameter.Enthalpy[left+1]-steel.Parameter.Enthalpy[left])*(enthalpy-steel.Parameter.Enthalpy[left])
+		//fmt.Println(s.Parameter.Enthalpy, enthalpy)
+		//fmt.Println(left, s.Parameter.Enthalpy[left+1]-s.Parameter.Enthalpy[left], enthalpy-s.Parameter.Enthalpy[left])
+		return float32(left+1) + 1/(s.Parameter.Enthalpy[left+1]-s.Parameter.Enthalpy[left])*(enthalpy-s.Parameter.Enthalpy[left])
 	}
 	// 7. 温度到焓的对应关系
-	steel.Parameter.Temp2Enthalpy = func(temp float32) float32 {
+	s.Parameter.Temp2Enthalpy = func(temp float32) float32 {
 		t := int(temp) - 1
 		if temp-1 == float32(t) {
-			return steel.Parameter.Enthalpy[t]
+			return s.Parameter.Enthalpy[t]
 		}
-		return steel.Parameter.Enthalpy[t] + (steel.Parameter.Enthalpy[t+1]-steel.Parameter.Enthalpy[t])*(temp-float32(t)-1)
+		return s.Parameter.Enthalpy[t] + (s.Parameter.Enthalpy[t+1]-s.Parameter.Enthalpy[t])*(temp-float32(t)-1)
 	}
 
 	// 8. 根据温度计算固相率
 	//for i := minTemp; i <= maxTemp; i++ {
-	//	steel.Parameter.SolidFraction[i] = calculateSolidFraction(float32(i), steel.SolidPhaseTemperature, steel.LiquidPhaseTemperature)
+	//	s.Parameter.SolidFraction[i] = calculateSolidFraction(float32(i), s.SolidPhaseTemperature, s.LiquidPhaseTemperature)
 	//}
 
 	// 8. 根据温度计算对应的 导热修正系数K
 	var initialK float32
 	for i := minTemp; i <= maxTemp; i++ {
-		if float32(i) >= steel.LiquidPhaseTemperature+minSuperheat {
+		if float32(i) >= s.LiquidPhaseTemperature+minSuperheat {
 			initialK = float32(3.0)
-			steel.Parameter.K[i] = 1.0 + initialK
-		} else if float32(i) >= steel.LiquidPhaseTemperature && float32(i) < steel.LiquidPhaseTemperature+minSuperheat {
-			steel.Parameter.K[i] = 1.0 + 3.0 - 2.0*(steel.LiquidPhaseTemperature+minSuperheat-float32(i))/minSuperheat
-		} else if float32(i) < steel.LiquidPhaseTemperature && float32(i) >= steel.SolidPhaseTemperature {
-			steel.Parameter.K[i] = 1.0 + 1.0 - 1.0*steel.Parameter.SolidFraction[i]
+			s.Parameter.K[i] = 1.0 + initialK
+		} else if float32(i) >= s.LiquidPhaseTemperature && float32(i) < s.LiquidPhaseTemperature+minSuperheat {
+			s.Parameter.K[i] = 1.0 + 3.0 - 2.0*(s.LiquidPhaseTemperature+minSuperheat-float32(i))/minSuperheat
+		} else if float32(i) < s.LiquidPhaseTemperature && float32(i) >= s.SolidPhaseTemperature {
+			s.Parameter.K[i] = 1.0 + 1.0 - 1.0*s.Parameter.SolidFraction[i]
 		} else {
-			steel.Parameter.K[i] = 1.0
+			s.Parameter.K[i] = 1.0
 		}
 	}
-	// 设置获取热流密度和综合换热系数函数
-	steel.Parameter.GetHeff = func(x, y, z int) float32 {
+	// 设置获取热流密度和综合换热系数函数，y 为 -1 时获取外弧宽面的值
+	s.Parameter.GetHeff = func(x, y, z int) float32 {
+		if y < 0 {
+			return s.Parameter.Heff[z][outerArcIndex(x)]
+		}
 		if x == Length/XStep-1 {
-			return steel.Parameter.Heff[z][x+Width/YStep-y]
+			return s.Parameter.Heff[z][x+Width/YStep-y]
 		} else {
-			return steel.Parameter.Heff[z][x]
+			return s.Parameter.Heff[z][x]
 		}
 	}
-	steel.Parameter.GetQ = func(x, y, z int) float32 {
+	s.Parameter.GetQ = func(x, y, z int) float32 {
+		if y < 0 {
+			return s.Parameter.Q[z][outerArcIndex(x)]
+		}
 		if x == Length/XStep-1 {
-			return steel.Parameter.Q[z][x+Width/YStep-y]
+			return s.Parameter.Q[z][x+Width/YStep-y]
 		} else {
-			return steel.Parameter.Q[z][x]
+			return s.Parameter.Q[z][x]
 		}
 	}
-	return &steel
 }
 
 // 获取不同冷却区对应的参数
@@ -0,0 +1,143 @@
+package calculator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"lz/model"
+	"sort"
+	"sync"
+)
+
+// 钢种库：从 phase_temperature.json 和 physical_parameter.json 中加载全部钢种，按 SteelType.Id 分组
+
+type SteelGrade struct {
+	Id                     int     `json:"id"`
+	Name                   string  `json:"name"`
+	Category               string  `json:"category"`
+	LiquidPhaseTemperature float32 `json:"liquid_phase_temperature"`
+	SolidPhaseTemperature  float32 `json:"solid_phase_temperature"`
+}
+
+type steelGradeData struct {
+	grade             SteelGrade
+	physicalParameter []model.PhysicalParameter // 按温度升序排列
+}
+
+var (
+	steelLibraryMu sync.RWMutex
+	steelLibrary   map[int]*steelGradeData
+)
+
+// 加载钢种库，需在 config.Init 之后调用
+func LoadSteelLibrary(phaseTemperatureFile, physicalParameterFile string) error {
+	data, err := ioutil.ReadFile(phaseTemperatureFile)
+	if err != nil {
+		return err
+	}
+	var phaseTemperature []model.PhaseTemperature
+	if err = json.Unmarshal(data, &phaseTemperature); err != nil {
+		return err
+	}
+	data, err = ioutil.ReadFile(physicalParameterFile)
+	if err != nil {
+		return err
+	}
+	var physicalParameter []model.PhysicalParameter
+	if err = json.Unmarshal(data, &physicalParameter); err != nil {
+		return err
+	}
+	library, err := buildSteelLibrary(phaseTemperature, physicalParameter)
+	if err != nil {
+		return err
+	}
+	steelLibraryMu.Lock()
+	steelLibrary = library
+	steelLibraryMu.Unlock()
+	log.WithField("count", len(library)).Info("钢种库加载完成")
+	return nil
+}
+
+func buildSteelLibrary(phaseTemperature []model.PhaseTemperature, physicalParameter []model.PhysicalParameter) (map[int]*steelGradeData, error) {
+	library := make(map[int]*steelGradeData)
+	for _, p := range phaseTemperature {
+		id := p.SteelType.Id
+		if _, ok := library[id]; ok {
+			return nil, fmt.Errorf("钢种 %d 的固液相线温度重复配置", id)
+		}
+		if p.SolidPhaseTemperature >= p.LiquidPhaseTemperature {
+			return nil, fmt.Errorf("钢种 %d 的固相线温度 %v 不低于液相线温度 %v", id, p.SolidPhaseTemperature, p.LiquidPhaseTemperature)
+		}
+		library[id] = &steelGradeData{
+			grade: SteelGrade{
+				Id:                     id,
+				Name:                   p.SteelType.Name,
+				Category:               p.SteelType.SteelTypeCategory.Name,
+				LiquidPhaseTemperature: p.LiquidPhaseTemperature,
+				SolidPhaseTemperature:  p.SolidPhaseTemperature,
+			},
+		}
+	}
+	for _, p := range physicalParameter {
+		g, ok := library[p.SteelType.Id]
+		if !ok {
+			log.WithField("steel_id", p.SteelType.Id).Warn("物性参数对应的钢种没有固液相线温度，已忽略")
+			continue
+		}
+		if p.Temperature < 1 || p.Temperature > ArrayLength {
+			return nil, fmt.Errorf("钢种 %d 的物性参数温度 %v 超出范围 [1, %d]", p.SteelType.Id, p.Temperature, ArrayLength)
+		}
+		g.physicalParameter = append(g.physicalParameter, p)
+	}
+	for id, g := range library {
+		if len(g.physicalParameter) < 2 {
+			log.WithField("steel_id", id).Warn("钢种缺少物性参数，已从钢种库中移除")
+			delete(library, id)
+			continue
+		}
+		sort.Slice(g.physicalParameter, func(i, j int) bool {
+			return g.physicalParameter[i].Temperature < g.physicalParameter[j].Temperature
+		})
+		if err := checkPropertyTable(g.physicalParameter); err != nil {
+			return nil, fmt.Errorf("钢种 %d 的物性参数表不合法: %v", id, err)
+		}
+		first, last := g.physicalParameter[0].Temperature, g.physicalParameter[len(g.physicalParameter)-1].Temperature
+		if first > g.grade.SolidPhaseTemperature || last < g.grade.LiquidPhaseTemperature {
+			return nil, fmt.Errorf("钢种 %d 的物性参数表温度范围 %v ~ %v 未覆盖固液两相区", id, first, last)
+		}
+	}
+	if len(library) == 0 {
+		return nil, errors.New("钢种库为空")
+	}
+	return library, nil
+}
+
+// 根据钢种编号获取钢种数据，钢种不存在时返回错误
+func getSteelGrade(id int) (*steelGradeData, error) {
+	steelLibraryMu.RLock()
+	defer steelLibraryMu.RUnlock()
+	if steelLibrary == nil {
+		return nil, errors.New("钢种库未加载")
+	}
+	g, ok := steelLibrary[id]
+	if !ok {
+		return nil, fmt.Errorf("钢种 %d 不存在", id)
+	}
+	return g, nil
+}
+
+// 钢种列表，按编号升序排列
+func ListSteels() []SteelGrade {
+	steelLibraryMu.RLock()
+	defer steelLibraryMu.RUnlock()
+	list := make([]SteelGrade, 0, len(steelLibrary))
+	for _, g := range steelLibrary {
+		list = append(list, g.grade)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
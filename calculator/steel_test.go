@@ -2,14 +2,77 @@ package calculator
 
 import (
 	"fmt"
+	"lz/model"
 	"testing"
 )
 
 func TestNewSteel(t *testing.T) {
-	steel := NewSteel(1, &CastingMachine{})
+	steel, err := NewSteel(3, &CastingMachine{})
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(steel.Parameter.Enthalpy2Temp(1.3246079e+06))
 	fmt.Println(steel.Parameter.Temp2Enthalpy(1599.9827))
 	fmt.Println(steel.Parameter.Emissivity[1153])
 
 	fmt.Println(calculateHbr(1153, 70, steel.Parameter))
-}
\ No newline at end of file
+}
+
+func TestNewSteelNotExist(t *testing.T) {
+	if _, err := NewSteel(1, &CastingMachine{}); err == nil {
+		t.Fatal("不存在的钢种应返回错误")
+	}
+}
+
+func TestBuildSteelLibrary(t *testing.T) {
+	steelType := func(id int) model.SteelType {
+		return model.SteelType{Id: id, Name: fmt.Sprint("steel", id)}
+	}
+	phaseTemperature := []model.PhaseTemperature{
+		{LiquidPhaseTemperature: 1500, SolidPhaseTemperature: 1430, SteelType: steelType(5)},
+		{LiquidPhaseTemperature: 1510, SolidPhaseTemperature: 1440, SteelType: steelType(2)},
+	}
+	var physicalParameter []model.PhysicalParameter
+	for temp := float32(1520); temp >= 1420; temp -= 20 {
+		physicalParameter = append(physicalParameter,
+			model.PhysicalParameter{Temperature: temp, Enthalpy: temp * 1000, SteelType: steelType(5)},
+			model.PhysicalParameter{Temperature: temp, Enthalpy: temp * 1000, SteelType: steelType(2)},
+			model.PhysicalParameter{Temperature: temp, Enthalpy: temp * 1000, SteelType: steelType(7)}, // 没有固液相线温度的钢种会被忽略
+		)
+	}
+	library, err := buildSteelLibrary(phaseTemperature, physicalParameter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(library) != 2 {
+		t.Fatal("钢种数量错误:", len(library))
+	}
+	if library[5].physicalParameter[0].Temperature != 1420 {
+		t.Fatal("物性参数未按温度排序")
+	}
+
+	phaseTemperature = append(phaseTemperature, model.PhaseTemperature{LiquidPhaseTemperature: 1400, SolidPhaseTemperature: 1450, SteelType: steelType(8)})
+	if _, err = buildSteelLibrary(phaseTemperature, physicalParameter); err == nil {
+		t.Fatal("固相线温度高于液相线温度时应返回错误")
+	}
+}
+
+func TestListSteels(t *testing.T) {
+	list := ListSteels()
+	if len(list) != 1 || list[0].Id != 3 || list[0].Name != "Q345B" {
+		t.Fatal("钢种列表错误:", list)
+	}
+}
+
+func TestBuildSteelLibraryRange(t *testing.T) {
+	phaseTemperature := []model.PhaseTemperature{
+		{LiquidPhaseTemperature: 1500, SolidPhaseTemperature: 1430, SteelType: model.SteelType{Id: 1}},
+	}
+	physicalParameter := []model.PhysicalParameter{
+		{Temperature: 1440, Enthalpy: 1, SteelType: model.SteelType{Id: 1}},
+		{Temperature: 1460, Enthalpy: 2, SteelType: model.SteelType{Id: 1}},
+	}
+	if _, err := buildSteelLibrary(phaseTemperature, physicalParameter); err == nil {
+		t.Fatal("物性参数表未覆盖固液两相区时应返回错误")
+	}
+}
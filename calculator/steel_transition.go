@@ -0,0 +1,313 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// 钢种切换（异钢种连浇）
+//
+// 切换开始后，新进入铸机的切片按照混浇长度线性地从旧钢种（steel1）过渡到新钢种（steel2），
+// 每个切片记录自己的混合比例，计算时按混合比例选取对应的物性参数。
+// 当铸机内所有切片都变为新钢种后，切换结束，steel2 成为 steel1。
+
+const (
+	DefaultMixingLength = float32(5000) // 默认混浇长度 mm
+	mixLevels           = 10            // 混合比例的离散级数，每一级缓存一份混合后的物性参数
+)
+
+// 每个切片的附加信息，与温度场中的切片一一对应
+type sliceMeta struct {
+	Steel int     // 切片所属的钢种编号，混浇区取占比较大的钢种
+	Mix   float32 // 新钢种所占比例，0 为旧钢种，1 为新钢种
+
+	Birth    time.Duration // 切片完全进入弯月面时的模拟时间
+	Distance float64       // 切片离开弯月面后走过的距离 mm
+}
+
+// 切片附加信息的环形队列，下标 0 为弯月面处的切片，与 ArrDeque 的 AddFirst、RemoveLast 同步移动
+type sliceMetaDeque struct {
+	arr  []sliceMeta
+	head int // 下标 0 对应的位置
+	size int
+}
+
+func newSliceMetaDeque(capacity int) *sliceMetaDeque {
+	return &sliceMetaDeque{arr: make([]sliceMeta, capacity)}
+}
+
+func (d *sliceMetaDeque) Size() int {
+	return d.size
+}
+
+func (d *sliceMetaDeque) AddFirst(m sliceMeta) {
+	if d.size == len(d.arr) {
+		panic("slice meta deque is full")
+	}
+	d.head = (d.head - 1 + len(d.arr)) % len(d.arr)
+	d.arr[d.head] = m
+	d.size++
+}
+
+func (d *sliceMetaDeque) AddLast(m sliceMeta) {
+	if d.size == len(d.arr) {
+		panic("slice meta deque is full")
+	}
+	d.arr[(d.head+d.size)%len(d.arr)] = m
+	d.size++
+}
+
+func (d *sliceMetaDeque) RemoveLast() {
+	if d.size == 0 {
+		return
+	}
+	d.size--
+}
+
+func (d *sliceMetaDeque) Get(z int) *sliceMeta {
+	if z < 0 || z >= d.size {
+		panic("index out of length")
+	}
+	return &d.arr[(d.head+z)%len(d.arr)]
+}
+
+// 等待在 Run 协程中生效的钢种更换
+type steelChange struct {
+	steel        *Steel
+	mixingLength float32
+}
+
+// 钢种切换的进度
+type steelTransition struct {
+	mixingLength float32               // 混浇长度 mm
+	cast         float32               // 切换开始后进入铸机的铸坯长度 mm
+	oldSlices    int                   // 切换开始时铸机内旧钢种的切片数
+	blends       [mixLevels + 1]*Steel // 各级混合比例对应的钢种，0 为 steel1，mixLevels 为 steel2
+}
+
+// 推送给前端的钢种切换信息，距离均为距弯月面的距离 mm
+type SteelTransitionData struct {
+	From         SteelGrade `json:"from"`
+	To           SteelGrade `json:"to"`
+	MixingLength float32    `json:"mixing_length"`
+	Start        float32    `json:"start"`    // 混浇区靠近弯月面的一端，其上游均为新钢种
+	End          float32    `json:"end"`      // 混浇区远离弯月面的一端，其下游均为旧钢种
+	Progress     float32    `json:"progress"` // 旧钢种已离开铸机的比例
+}
+
+// 混合两种钢种的物性参数，热流密度和综合换热系数与 s1 共用
+func blendSteel(s1, s2 *Steel, mix float32) *Steel {
+	parameter := Parameter{
+		Q:    s1.Parameter.Q,
+		Heff: s1.Parameter.Heff,
+	}
+	lerp := func(a, b float32) float32 {
+		return a + (b-a)*mix
+	}
+	for i := 0; i < ArrayLength; i++ {
+		parameter.Density[i] = lerp(s1.Parameter.Density[i], s2.Parameter.Density[i])
+		parameter.Enthalpy[i] = lerp(s1.Parameter.Enthalpy[i], s2.Parameter.Enthalpy[i])
+		parameter.Lambda[i] = lerp(s1.Parameter.Lambda[i], s2.Parameter.Lambda[i])
+		parameter.C[i] = lerp(s1.Parameter.C[i], s2.Parameter.C[i])
+	}
+	for i := 0; i <= ArrayLength; i++ {
+		parameter.SolidFraction[i] = lerp(s1.Parameter.SolidFraction[i], s2.Parameter.SolidFraction[i])
+		parameter.Emissivity[i] = lerp(s1.Parameter.Emissivity[i], s2.Parameter.Emissivity[i])
+	}
+	steel := &Steel{
+		Number:                 s2.Number,
+		Name:                   fmt.Sprintf("%s/%s %.0f%%", s1.Name, s2.Name, mix*100),
+		LiquidPhaseTemperature: lerp(s1.LiquidPhaseTemperature, s2.LiquidPhaseTemperature),
+		SolidPhaseTemperature:  lerp(s1.SolidPhaseTemperature, s2.SolidPhaseTemperature),
+		Parameter:              &parameter,
+		CastingMachine:         s1.CastingMachine,
+	}
+	if mix < 0.5 {
+		steel.Number = s1.Number
+	}
+	steel.initParameterFunctions()
+	return steel
+}
+
+func newSteelTransition(s1, s2 *Steel, mixingLength float32) *steelTransition {
+	t := &steelTransition{mixingLength: mixingLength}
+	t.blends[0] = s1
+	t.blends[mixLevels] = s2
+	for level := 1; level < mixLevels; level++ {
+		t.blends[level] = blendSteel(s1, s2, float32(level)/mixLevels)
+	}
+	return t
+}
+
+// 更换钢种：在调用者的协程中校验并准备好新钢种，由 Run 协程在下一个时间步长开始时生效，
+// 计算中途不会看到只设置了一半的钢种切换
+func (c *calculatorWithArrDeque) ChangeSteel(steelValue int, mixingLength float32) error {
+	c.steelMu.Lock()
+	defer c.steelMu.Unlock()
+	if p := c.pendingSteel; p != nil {
+		if p.steel.Number == steelValue {
+			return nil
+		}
+		return errors.New("上一次钢种更换尚未生效")
+	}
+	if c.steel1 != nil && c.steel1.Number == steelValue && c.transition == nil {
+		return nil
+	}
+	if c.transition != nil {
+		if c.steel2.Number == steelValue {
+			return nil
+		}
+		return errors.New("上一次钢种切换尚未完成")
+	}
+	if mixingLength <= 0 {
+		mixingLength = DefaultMixingLength
+	}
+	steel, err := NewSteel(steelValue, c.castingMachine)
+	if err != nil {
+		return err
+	}
+	if c.steel1 == nil {
+		// 还没有钢种时计算器还没有开始计算，直接设置
+		c.steel1 = steel
+		return nil
+	}
+	c.pendingSteel = &steelChange{steel: steel, mixingLength: mixingLength}
+	log.WithFields(log.Fields{"from": c.steel1.Number, "to": steelValue}).Info("钢种更换等待下一个时间步长生效")
+	return nil
+}
+
+// 在 Run 协程中应用等待生效的钢种更换：铸机内没有铸坯时直接更换，否则开始钢种切换。每个时间步长开始时调用
+func (c *calculatorWithArrDeque) applySteelChange() {
+	c.steelMu.Lock()
+	defer c.steelMu.Unlock()
+	p := c.pendingSteel
+	if p == nil {
+		return
+	}
+	c.pendingSteel = nil
+	steel, mixingLength := p.steel, p.mixingLength
+	if c.Field.IsEmpty() {
+		c.steel1 = steel
+		return
+	}
+	// 新钢种与旧钢种共用热流密度和综合换热系数
+	steel.Parameter.Q = c.steel1.Parameter.Q
+	steel.Parameter.Heff = c.steel1.Parameter.Heff
+	c.steel2 = steel
+	c.transition = newSteelTransition(c.steel1, c.steel2, mixingLength)
+	c.transition.oldSlices = c.Field.Size()
+	if c.runningState == stateRunning {
+		c.runningState = stateRunningWithTwoSteel
+	}
+	log.WithFields(log.Fields{"from": c.steel1.Number, "to": c.steel2.Number, "mixing_length": mixingLength}).Info("开始钢种切换")
+}
+
+// 新进入铸机的切片的附加信息
+func (c *calculatorWithArrDeque) newSliceMeta() sliceMeta {
+	if c.transition == nil {
+		if c.steel1 == nil {
+			return sliceMeta{Birth: c.clock}
+		}
+		return sliceMeta{Steel: c.steel1.Number, Birth: c.clock}
+	}
+	c.transition.cast += float32(ZStep)
+	mix := c.transition.cast / c.transition.mixingLength
+	if mix > 1 {
+		mix = 1
+	}
+	meta := sliceMeta{Steel: c.steel1.Number, Mix: mix, Birth: c.clock}
+	if mix >= 0.5 {
+		meta.Steel = c.steel2.Number
+	}
+	return meta
+}
+
+// 铸机内最远处的切片也变为新钢种后，结束钢种切换
+func (c *calculatorWithArrDeque) checkTransition() {
+	if c.transition == nil || c.sliceMeta.Size() == 0 {
+		return
+	}
+	if c.sliceMeta.Get(c.sliceMeta.Size()-1).Mix < 1 {
+		return
+	}
+	log.WithFields(log.Fields{"from": c.steel1.Number, "to": c.steel2.Number}).Info("钢种切换完成")
+	c.steelMu.Lock()
+	defer c.steelMu.Unlock()
+	c.steel1, c.steel2 = c.steel2, nil
+	c.transition = nil
+	for z := 0; z < c.sliceMeta.Size(); z++ {
+		c.sliceMeta.Get(z).Mix = 0
+	}
+	if c.runningState == stateRunningWithTwoSteel {
+		c.runningState = stateRunning
+	}
+}
+
+// 钢种及切换进度的快照。Run 协程结束钢种切换时会把 transition 和 steel2 置空，
+// 其他协程在持有 steelMu 时获取快照，之后只通过快照读取切片的钢种
+type steelSnapshot struct {
+	steel1, steel2 *Steel
+	transition     *steelTransition
+	meta           *sliceMetaDeque
+}
+
+// 持有 steelMu 获取钢种的快照，在 Run 协程之外读取切片钢种时使用
+func (c *calculatorWithArrDeque) steels() steelSnapshot {
+	c.steelMu.Lock()
+	defer c.steelMu.Unlock()
+	return steelSnapshot{steel1: c.steel1, steel2: c.steel2, transition: c.transition, meta: c.sliceMeta}
+}
+
+// 第 z 个切片对应的钢种，钢种切换时返回按混合比例混合后的钢种
+func (s steelSnapshot) at(z int) *Steel {
+	if s.transition == nil || z >= s.meta.Size() {
+		return s.steel1
+	}
+	level := int(s.meta.Get(z).Mix*mixLevels + 0.5)
+	return s.transition.blends[level]
+}
+
+// 获取第 z 个切片对应的钢种，只在 Run 协程中调用，其他协程通过 steels 获取快照后读取
+func (c *calculatorWithArrDeque) getSteel(z int) *Steel {
+	return steelSnapshot{steel1: c.steel1, transition: c.transition, meta: c.sliceMeta}.at(z)
+}
+
+// 当前钢种切换的信息，未处于钢种切换时返回 nil
+func (c *calculatorWithArrDeque) buildTransitionData() *SteelTransitionData {
+	s := c.steels()
+	if s.transition == nil {
+		return nil
+	}
+	data := &SteelTransitionData{
+		From:         SteelGrade{Id: s.steel1.Number, Name: s.steel1.Name, LiquidPhaseTemperature: s.steel1.LiquidPhaseTemperature, SolidPhaseTemperature: s.steel1.SolidPhaseTemperature},
+		To:           SteelGrade{Id: s.steel2.Number, Name: s.steel2.Name, LiquidPhaseTemperature: s.steel2.LiquidPhaseTemperature, SolidPhaseTemperature: s.steel2.SolidPhaseTemperature},
+		MixingLength: s.transition.mixingLength,
+	}
+	size := s.meta.Size()
+	start, end := -1, -1
+	var oldSlices int
+	for z := 0; z < size; z++ {
+		mix := s.meta.Get(z).Mix
+		if mix < 1 && start == -1 {
+			start = z
+		}
+		if mix > 0 {
+			end = z
+		}
+		if mix == 0 {
+			oldSlices++
+		}
+	}
+	if start != -1 {
+		data.Start = float32(start * ZStep)
+	}
+	if end != -1 {
+		data.End = float32((end + 1) * ZStep)
+	}
+	if s.transition.oldSlices > 0 {
+		data.Progress = 1 - float32(oldSlices)/float32(s.transition.oldSlices)
+	}
+	return data
+}
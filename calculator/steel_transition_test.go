@@ -0,0 +1,173 @@
+package calculator
+
+import (
+	"testing"
+)
+
+func TestSliceMetaDeque(t *testing.T) {
+	d := newSliceMetaDeque(3)
+	for i := 1; i <= 3; i++ {
+		d.AddFirst(sliceMeta{Steel: i})
+	}
+	// 下标 0 为最后加入的切片
+	if d.Get(0).Steel != 3 || d.Get(2).Steel != 1 {
+		t.Fatal("切片顺序错误")
+	}
+	for i := 4; i <= 10; i++ {
+		d.RemoveLast()
+		d.AddFirst(sliceMeta{Steel: i})
+	}
+	if d.Size() != 3 || d.Get(0).Steel != 10 || d.Get(1).Steel != 9 || d.Get(2).Steel != 8 {
+		t.Fatal("环形队列移动后切片顺序错误")
+	}
+}
+
+// 向钢种库中加入一个液相线温度更低的测试钢种
+func addTestSteelGrade(t *testing.T, id int) {
+	g, err := getSteelGrade(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grade := *g
+	grade.grade.Id = id
+	grade.grade.Name = "test"
+	grade.grade.LiquidPhaseTemperature -= 20
+	grade.grade.SolidPhaseTemperature -= 20
+	steelLibraryMu.Lock()
+	steelLibrary[id] = &grade
+	steelLibraryMu.Unlock()
+}
+
+func removeTestSteelGrade(id int) {
+	steelLibraryMu.Lock()
+	delete(steelLibrary, id)
+	steelLibraryMu.Unlock()
+}
+
+func TestSteelTransition(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	addTestSteelGrade(t, 99)
+	defer removeTestSteelGrade(99)
+
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	for c.Field.Size() < ZLength/ZStep {
+		c.addFirstSlice(1500)
+	}
+	c.runningState = stateRunning
+	if err := c.ChangeSteel(99, 50); err != nil {
+		t.Fatal(err)
+	}
+	// 钢种更换在下一个时间步长开始时才生效
+	if c.transition != nil || c.pendingSteel == nil {
+		t.Fatal("钢种更换应等待 Run 协程生效")
+	}
+	if err := c.ChangeSteel(5, 0); err == nil {
+		t.Fatal("钢种更换生效前不能再次更换")
+	}
+	c.applySteelChange()
+	if c.runningState != stateRunningWithTwoSteel || c.steel2.Number != 99 {
+		t.Fatal("未开始钢种切换")
+	}
+	if err := c.ChangeSteel(5, 0); err == nil {
+		t.Fatal("钢种切换未完成时不能再次切换")
+	}
+	if &c.steel2.Parameter.Q[0] != &c.steel1.Parameter.Q[0] {
+		t.Fatal("新钢种应与旧钢种共用热流密度")
+	}
+
+	pushed := 0
+	for c.transition != nil {
+		c.removeLastSlice()
+		c.addFirstSlice(1500)
+		pushed++
+		if pushed == 3 {
+			// 混浇长度 50mm，即 5 个切片，第 3 个切片中新钢种占 60%
+			if c.sliceMeta.Get(0).Mix != 0.6 || c.getSteel(0) != c.transition.blends[6] {
+				t.Fatal("切片混合比例错误", c.sliceMeta.Get(0).Mix)
+			}
+			if c.getSteel(3) != c.steel1 {
+				t.Fatal("旧钢种切片应使用旧钢种物性参数")
+			}
+			data := c.buildTransitionData()
+			if data.Start != 0 || data.End != 30 || data.From.Id != 3 || data.To.Id != 99 {
+				t.Fatal("混浇区位置错误", data)
+			}
+			if c.getSteel(1) != c.transition.blends[4] {
+				t.Fatal("未按切片的混合比例返回物性参数")
+			}
+		}
+		c.checkTransition()
+		if pushed > 100 {
+			t.Fatal("钢种切换未结束")
+		}
+	}
+	// 20 个旧钢种切片全部移出，且混浇区的最后一个切片（第 5 个）到达铸机末端
+	if pushed != 24 {
+		t.Fatal("钢种切换结束的时机错误", pushed)
+	}
+	if c.steel1.Number != 99 || c.steel2 != nil || c.runningState != stateRunning || c.buildTransitionData() != nil {
+		t.Fatal("钢种切换结束后状态错误")
+	}
+}
+
+func TestBlendSteel(t *testing.T) {
+	ZLength = 200
+	addTestSteelGrade(t, 99)
+	defer removeTestSteelGrade(99)
+	s1, _ := NewSteel(3, &CastingMachine{})
+	s2, _ := NewSteel(99, &CastingMachine{})
+	s := blendSteel(s1, s2, 0.5)
+	if s.LiquidPhaseTemperature != s1.LiquidPhaseTemperature-10 || s.Number != 99 {
+		t.Fatal("混合钢种的液相线温度错误", s.LiquidPhaseTemperature)
+	}
+	if s.Parameter.Enthalpy[1000] != (s1.Parameter.Enthalpy[1000]+s2.Parameter.Enthalpy[1000])/2 {
+		t.Fatal("混合钢种的焓值错误")
+	}
+	temp := s.Parameter.Enthalpy2Temp(s.Parameter.Temp2Enthalpy(1450.5))
+	if temp < 1450.4 || temp > 1450.6 {
+		t.Fatal("混合钢种的焓温转换错误", temp)
+	}
+}
+
+func TestSteelSnapshotAfterTransition(t *testing.T) {
+	ZLength, Length, Width = 200, 50, 20
+	addTestSteelGrade(t, 99)
+	defer removeTestSteelGrade(99)
+
+	c := NewCalculatorWithArrDeque(nil)
+	if err := c.InitSteel(3, c.castingMachine); err != nil {
+		t.Fatal(err)
+	}
+	for c.Field.Size() < ZLength/ZStep {
+		c.addFirstSlice(1500)
+	}
+	c.runningState = stateRunning
+	if err := c.ChangeSteel(99, 50); err != nil {
+		t.Fatal(err)
+	}
+	c.applySteelChange()
+	for i := 0; i < 3; i++ {
+		c.removeLastSlice()
+		c.addFirstSlice(1500)
+	}
+	// 推送协程获取快照后，Run 协程结束钢种切换不影响快照的读取
+	s := c.steels()
+	blend := s.at(0)
+	for c.transition != nil {
+		c.removeLastSlice()
+		c.addFirstSlice(1500)
+		c.checkTransition()
+	}
+	if s.transition == nil || s.steel2 == nil || s.at(0) == nil {
+		t.Fatal("钢种切换结束后快照不应改变")
+	}
+	if blend != s.transition.blends[6] {
+		t.Fatal("快照中的切片钢种错误")
+	}
+	if c.steels().at(0) != c.steel1 || c.buildTransitionData() != nil {
+		t.Fatal("钢种切换结束后应使用新钢种")
+	}
+}
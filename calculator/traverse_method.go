@@ -9,99 +9,106 @@ import (
 func (e *executorBaseOnSlice) traverseSpirally(t task, c *calculatorWithArrDeque) {
 	start := time.Now()
 	count := 0
-	var parameter *Parameter
-	var zone int
-	var electromagneticStirringFactor float32
 	c.Field.TraverseSpirally(t.start, t.end, func(z int, item *model.ItemType) {
 		// 跳过为空的切片， 即值为-1
 		if item[0][0] == -1 {
 			return
 		}
-		left, right, top, bottom := 0, Length/XStep-1, 0, Width/YStep-1 // 每个切片迭代时需要重置
-		// parameter set
-		parameter = c.getParameter(z)
-		// 计算在哪一个区域
-		zone = c.castingMachine.WhichZone(z)
-		// 计算电子搅拌对传热系数的影响因子
-		electromagneticStirringFactor = c.castingMachine.GetElectromagneticStirringFactor(z)
-		// 计算最外层， 逆时针
-		{
-			// 1. 三个顶点，左下方顶点仅当其外一层温度不是初始温度时才开始计算
-			c.calculatePointRB(t.deltaT, z, item, parameter, zone, electromagneticStirringFactor)
-			c.calculatePointRT(t.deltaT, z, item, parameter, zone, electromagneticStirringFactor)
-			c.calculatePointLT(t.deltaT, z, item, parameter, zone, electromagneticStirringFactor)
-			count += 3
-			for row := top + 1; row < bottom; row++ {
-				// [row][right]
-				c.calculatePointRA(t.deltaT, row, z, item, parameter, zone, electromagneticStirringFactor)
-				count++
-			}
-			for column := right - 1; column > left; column-- {
-				// [bottom][column]
-				c.calculatePointTA(t.deltaT, column, z, item, parameter, zone, electromagneticStirringFactor)
-				count++
-			}
-			right--
-			bottom--
+		count += c.calculateSlice(t.deltaT, z, item)
+	})
+	fmt.Println("消耗时间: ", time.Since(start), "计算的点数: ", count, "实际需要遍历的点数: ", (t.end-t.start)*(Width/YStep*Length/XStep), t.end, t.start)
+}
+
+// 逆时针螺旋遍历计算一个切片经过 deltaT 后的温度，结果写入另一个温度场容器中，返回计算的点数
+func (c *calculatorWithArrDeque) calculateSliceSpirally(deltaT float32, z int, item *model.ItemType) int {
+	count := 0
+	left, right, top, bottom := 0, Length/XStep-1, 0, Width/YStep-1 // 每个切片迭代时需要重置
+	// parameter set
+	parameter := c.getParameter(z)
+	// 计算在哪一个区域
+	zone := c.castingMachine.WhichZone(z)
+	// 计算电子搅拌对传热系数的影响因子
+	electromagneticStirringFactor := c.castingMachine.GetElectromagneticStirringFactor(z)
+	// 计算最外层， 逆时针
+	{
+		// 1. 三个顶点，左下方顶点仅当其外一层温度不是初始温度时才开始计算
+		c.calculatePointRB(deltaT, z, item, parameter, zone, electromagneticStirringFactor)
+		c.calculatePointRT(deltaT, z, item, parameter, zone, electromagneticStirringFactor)
+		c.calculatePointLT(deltaT, z, item, parameter, zone, electromagneticStirringFactor)
+		count += 3
+		for row := top + 1; row < bottom; row++ {
+			// [row][right]
+			c.calculatePointRA(deltaT, row, z, item, parameter, zone, electromagneticStirringFactor)
+			count++
 		}
+		for column := right - 1; column > left; column-- {
+			// [bottom][column]
+			c.calculatePointTA(deltaT, column, z, item, parameter, zone, electromagneticStirringFactor)
+			count++
+		}
+		right--
+		bottom--
+	}
 
-		{
-			// 逆时针螺旋遍历
-			for left <= right && top <= bottom {
-				if item[0][right] != item[0][right+1] ||
-					item[0][right] != item[0][right-1] ||
-					item[0][right] != item[1][right] {
-					c.calculatePointBA(t.deltaT, right, z, item, parameter, zone, electromagneticStirringFactor)
+	{
+		// 逆时针螺旋遍历
+		for left <= right && top <= bottom {
+			// 半断面时第 0 行为外弧宽面，始终需要计算
+			if isHalfSection() ||
+				item[0][right] != item[0][right+1] ||
+				item[0][right] != item[0][right-1] ||
+				item[0][right] != item[1][right] {
+				c.calculatePointBA(deltaT, right, z, item, parameter, zone, electromagneticStirringFactor)
+				count++
+			}
+			for row := top + 1; row <= bottom; row++ {
+				// [row][right]
+				if item[row][right] != item[row][right+1] ||
+					item[row][right] != item[row][right-1] ||
+					item[row][right] != item[row+1][right] ||
+					item[row][right] != item[row-1][right] {
+					c.calculatePointIN(deltaT, right, row, z, item, parameter, zone, electromagneticStirringFactor)
 					count++
 				}
-				for row := top + 1; row <= bottom; row++ {
-					// [row][right]
-					if item[row][right] != item[row][right+1] ||
-						item[row][right] != item[row][right-1] ||
-						item[row][right] != item[row+1][right] ||
-						item[row][right] != item[row-1][right] {
-						c.calculatePointIN(t.deltaT, right, row, z, item, parameter, zone, electromagneticStirringFactor)
+			}
+			if left < right && top < bottom {
+				for column := right - 1; column > left; column-- {
+					// [bottom][column]
+					if item[bottom][column] != item[bottom][column+1] ||
+						item[bottom][column] != item[bottom][column-1] ||
+						item[bottom][column] != item[bottom+1][column] ||
+						item[bottom][column] != item[bottom-1][column] {
+						c.calculatePointIN(deltaT, column, bottom, z, item, parameter, zone, electromagneticStirringFactor)
 						count++
 					}
 				}
-				if left < right && top < bottom {
-					for column := right - 1; column > left; column-- {
-						// [bottom][column]
-						if item[bottom][column] != item[bottom][column+1] ||
-							item[bottom][column] != item[bottom][column-1] ||
-							item[bottom][column] != item[bottom+1][column] ||
-							item[bottom][column] != item[bottom-1][column] {
-							c.calculatePointIN(t.deltaT, column, bottom, z, item, parameter, zone, electromagneticStirringFactor)
-							count++
-						}
-					}
-					if item[bottom][0] != item[bottom+1][0] ||
-						item[bottom][0] != item[bottom-1][0] ||
-						item[bottom][0] != item[bottom][1] {
-						c.calculatePointLA(t.deltaT, bottom, z, item, parameter, zone, electromagneticStirringFactor)
-						count++
-					}
+				if item[bottom][0] != item[bottom+1][0] ||
+					item[bottom][0] != item[bottom-1][0] ||
+					item[bottom][0] != item[bottom][1] {
+					c.calculatePointLA(deltaT, bottom, z, item, parameter, zone, electromagneticStirringFactor)
+					count++
+				}
+			}
+			if top == bottom {
+				if isHalfSection() || item[0][0] != item[0][1] || item[0][0] != item[1][0] {
+					c.calculatePointLB(deltaT, z, item, parameter, zone, electromagneticStirringFactor)
+					count++
 				}
-				if top == bottom {
-					if item[0][0] != item[0][1] || item[0][0] != item[1][0] {
-						c.calculatePointLB(t.deltaT, z, item, parameter, zone, electromagneticStirringFactor)
+				for column := right - 1; column > left; column-- {
+					if isHalfSection() ||
+						item[0][column] != item[0][column+1] ||
+						item[0][column] != item[0][column-1] ||
+						item[0][column] != item[1][column] {
+						c.calculatePointBA(deltaT, column, z, item, parameter, zone, electromagneticStirringFactor)
 						count++
 					}
-					for column := right - 1; column > left; column-- {
-						if item[0][column] != item[0][column+1] ||
-							item[0][column] != item[0][column-1] ||
-							item[0][column] != item[1][column] {
-							c.calculatePointBA(t.deltaT, column, z, item, parameter, zone, electromagneticStirringFactor)
-							count++
-						}
-					}
 				}
-				right--
-				bottom--
 			}
+			right--
+			bottom--
 		}
-	})
-	fmt.Println("消耗时间: ", time.Since(start), "计算的点数: ", count, "实际需要遍历的点数: ", (t.end-t.start)*(Width/YStep*Length/XStep), t.end, t.start)
+	}
+	return count
 }
 
 // 分块遍历
@@ -3,8 +3,10 @@ package calculator
 import (
 	"encoding/json"
 	"io/ioutil"
+	"lz/config"
 	"lz/model"
 	"math"
+	"path/filepath"
 )
 
 // 标准单位为m 将mm 转化为m * 1000
@@ -60,21 +62,22 @@ func getLambda(index1, index2, x1, y1, x2, y2 int, parameter *Parameter, zone in
 
 // 计算时间步长 ------------------------------------------------------------------------------------------------------------------
 // 计算时间步长 case1 -> 左下角
-func getDeltaTCase1(x, y int, slice *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) float32 {
+func getDeltaTCase1(x, y, z int, slice *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) float32 {
 	var t = slice[y][x]
 	var index = int(t) - 1
 	var index1, index2 int
 	index1 = int(slice[y][x+1]) - 1
 	index2 = int(slice[y+1][x]) - 1
 	denominator := 2*getLambda(index, index1, x, y, x+1, y, parameter, zone, electromagneticStirringFactor)/(stdXStep*(getEx(x)+getEx(x+1))) +
-		2*getLambda(index, index2, x, y, x, y+1, parameter, zone, electromagneticStirringFactor)/(stdYStep*(getEy(y)+getEy(y+1)))
+		2*getLambda(index, index2, x, y, x, y+1, parameter, zone, electromagneticStirringFactor)/(stdYStep*(getEy(y)+getEy(y+1))) +
+		outerArcHeff(parameter, x, z)
 	//fmt.Println(getLambda(index, index1, x, y, x+1, y, parameter), stdXStep*(getEx(x)+getEx(x+1)), getLambda(index, index2, x, y, x, y+1, parameter), stdYStep*(getEy(y)+getEy(y+1)))
 	//fmt.Println("denominator", denominator, parameter.Density[index]*parameter.Enthalpy[index], "t: ", t)
 	return (parameter.Density[index] * parameter.Enthalpy[index]) / (t * denominator)
 }
 
 // 计算时间步长 case2 -> 下面边
-func getDeltaTCase2(x, y int, slice *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) float32 {
+func getDeltaTCase2(x, y, z int, slice *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) float32 {
 	var t = slice[y][x]
 	var index = int(t) - 1
 	var index1, index2, index3 int
@@ -83,7 +86,8 @@ func getDeltaTCase2(x, y int, slice *model.ItemType, parameter *Parameter, zone
 	index3 = int(slice[y+1][x]) - 1
 	denominator := 2*getLambda(index, index1, x, y, x-1, y, parameter, zone, electromagneticStirringFactor )/(stdXStep*(getEx(x)+getEx(x-1))) +
 		2*getLambda(index, index2, x, y, x+1, y, parameter, zone, electromagneticStirringFactor)/(stdXStep*(getEx(x)+getEx(x+1))) +
-		2*getLambda(index, index3, x, y, x, y+1, parameter, zone, electromagneticStirringFactor)/(stdYStep*(getEy(y)+getEy(y+1)))
+		2*getLambda(index, index3, x, y, x, y+1, parameter, zone, electromagneticStirringFactor)/(stdYStep*(getEy(y)+getEy(y+1))) +
+		outerArcHeff(parameter, x, z)
 	//fmt.Println("denominator", denominator, parameter.Density[index]*parameter.Enthalpy[index], "t: ", t)
 	return (parameter.Density[index] * parameter.Enthalpy[index]) / (t * denominator)
 }
@@ -97,7 +101,8 @@ func getDeltaTCase3(x, y, z int, slice *model.ItemType, parameter *Parameter, zo
 	index2 = int(slice[y+1][x]) - 1
 	denominator := 2*getLambda(index, index1, x, y, x-1, y, parameter, zone, electromagneticStirringFactor)/(stdXStep*(getEx(x)+getEx(x-1))) +
 		2*getLambda(index, index2, x, y, x, y+1, parameter, zone, electromagneticStirringFactor)/(stdYStep*(getEy(y)+getEy(y+1))) +
-		parameter.GetHeff(x, y, z)/(stdXStep)
+		parameter.GetHeff(x, y, z)/(stdXStep) +
+		outerArcHeff(parameter, x, z)
 	//fmt.Println("denominator", denominator, parameter.Density[index]*parameter.Enthalpy[index], "t: ", t)
 	return (parameter.Density[index] * parameter.Enthalpy[index]) / (t * denominator)
 }
@@ -200,8 +205,8 @@ const bigNum = float32(3.0)
 func calculateTimeStepOfOneSlice(z int, slice *model.ItemType, parameter *Parameter, zone int, electromagneticStirringFactor float32) float32 {
 	// 计算时间步长 - start
 	var deltaTArr = [9]float32{}
-	deltaTArr[0] = getDeltaTCase1(0, 0, slice, parameter, zone, electromagneticStirringFactor)
-	deltaTArr[1] = getDeltaTCase2(Length/XStep-2, 0, slice, parameter, zone, electromagneticStirringFactor)
+	deltaTArr[0] = getDeltaTCase1(0, 0, z, slice, parameter, zone, electromagneticStirringFactor)
+	deltaTArr[1] = getDeltaTCase2(Length/XStep-2, 0, z, slice, parameter, zone, electromagneticStirringFactor)
 	deltaTArr[2] = getDeltaTCase3(Length/XStep-1, 0, z, slice, parameter, zone, electromagneticStirringFactor)
 	deltaTArr[3] = getDeltaTCase4(Length/XStep-1, Width/YStep-2, z, slice, parameter, zone, electromagneticStirringFactor)
 	deltaTArr[4] = getDeltaTCase5(Length/XStep-1, Width/YStep-1, z, slice, parameter, zone, electromagneticStirringFactor)
@@ -815,7 +820,7 @@ func handleData(data []byte) {
 	if err != nil {
 		return
 	}
-	err = ioutil.WriteFile("E:/GoWorkPlace/src/lz/conf/generate.json", data, 0644)
+	err = ioutil.WriteFile(filepath.Join(config.Dir(), "generate.json"), data, 0644)
 	if err != nil {
 		return
 	}
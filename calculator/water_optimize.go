@@ -0,0 +1,416 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"lz/model"
+	"math"
+	"sort"
+)
+
+// 离线二冷水量优化
+//
+// 在当前钢种和拉速下反复求解稳态温度场，调节各冷却区的内弧水量，使内弧宽面中心的表面温度接近目标曲线。
+// 每个冷却区的偏差为区内表面温度与目标温度之差的平均值，回温速率超过上限时超出的部分计入该区的偏差，使该区增加水量。
+// 各冷却区同时按割线法调节：Δw = -E/s，s 为前两次迭代中偏差对水量的变化率，还没有有效的变化率时按偏差比例调节。
+// 外弧水量和窄面水量按优化前与内弧水量的比例同步调节。迭代结束后保留目标函数最小的一组水量。
+
+const (
+	defaultOptimizeIterations = 20   // 默认最大迭代次数
+	defaultOptimizeTolerance  = 5.0  // 默认收敛偏差 ℃
+	minWaterChange            = 0.01 // 所有冷却区水量的变化都小于该值时认为无法继续优化
+)
+
+var reheatWindow = 1000 / ZStep // 计算回温速率的窗口（切片数），即 1m
+
+// 沿拉坯方向某一位置的表面温度
+type SurfaceSample struct {
+	Distance    float32 `json:"distance"`    // 距弯月面的距离 mm
+	Temperature float32 `json:"temperature"` // 内弧宽面中心的表面温度 ℃
+	Target      float32 `json:"target"`      // 目标表面温度 ℃
+}
+
+// 一个拉速下的水量优化结果
+type WaterOptimizeResult struct {
+	Speed         float32                              `json:"speed"`           // 拉速 m/min
+	Water         []model.SecondaryCoolingWaterSection `json:"water"`           // 优化后的各冷却区水量
+	Deviation     []float32                            `json:"deviation"`       // 各冷却区表面温度与目标温度的平均偏差 ℃
+	ReheatRate    []float32                            `json:"reheat_rate"`     // 各冷却区内的最大回温速率 ℃/m
+	RMS           float32                              `json:"rms"`             // 参与优化的冷却区内表面温度偏差的均方根 ℃
+	MaxReheatRate float32                              `json:"max_reheat_rate"` // 二冷区的最大回温速率 ℃/m
+	Iterations    int                                  `json:"iterations"`      // 迭代次数，即稳态计算的次数
+	Converged     bool                                 `json:"converged"`       // 是否满足收敛条件和回温速率限制
+	Profile       []SurfaceSample                      `json:"profile"`         // 每 1m 采样的表面温度
+}
+
+// 一次稳态计算后的表面温度统计
+type surfaceEvaluation struct {
+	deviation  []float32
+	reheatRate []float32
+	rms        float32
+	maxReheat  float32
+	profile    []SurfaceSample
+}
+
+// 参与优化的冷却区的迭代状态
+type zoneOptimizeState struct {
+	limit     model.ZoneWaterLimit
+	water     float32
+	preWater  float32
+	preError  float32
+	slope     float32 // 偏差对水量的变化率，小于 0 时有效
+	hasPre    bool
+	outer     float32 // 外弧水量与内弧水量的比例，小于 0 表示外弧水量与内弧相同
+	narrow    float32 // 窄面水量与内弧水量的比例，小于 0 表示窄面水量不变
+	zoneIndex int
+}
+
+// 检查水量优化配置，zones 为二冷区的分区数
+func checkWaterOptimization(cfg model.WaterOptimization, zones int) error {
+	if len(cfg.Target) < 2 {
+		return errors.New("目标表面温度曲线至少需要两个点")
+	}
+	for i := 1; i < len(cfg.Target); i++ {
+		if cfg.Target[i][0] <= cfg.Target[i-1][0] {
+			return errors.New("目标表面温度曲线的距离需要严格递增")
+		}
+	}
+	if cfg.MaxReheatRate < 0 || cfg.MaxIterations < 0 || cfg.Tolerance < 0 {
+		return errors.New("回温速率上限、最大迭代次数和收敛偏差不能为负数")
+	}
+	if len(cfg.Zones) == 0 {
+		return errors.New("没有参与优化的冷却区")
+	}
+	seen := make(map[int]bool)
+	for _, zone := range cfg.Zones {
+		if zone.Zone < 1 || zone.Zone > zones {
+			return fmt.Errorf("水量优化的冷却区编号 %d 超出范围 1-%d", zone.Zone, zones)
+		}
+		if seen[zone.Zone] {
+			return fmt.Errorf("冷却区 %d 的水量范围重复", zone.Zone)
+		}
+		seen[zone.Zone] = true
+		if zone.MinWater < 0 || zone.MaxWater < zone.MinWater {
+			return fmt.Errorf("冷却区 %d 的水量范围错误", zone.Zone)
+		}
+	}
+	return nil
+}
+
+// 在当前钢种和拉速下优化二冷水量，结束后水量设置为优化结果，温度场为该水量下的稳态温度场
+func (c *calculatorWithArrDeque) OptimizeWater(cfg model.WaterOptimization) (*WaterOptimizeResult, error) {
+	waterCfg := c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg
+	if err := checkWaterOptimization(cfg, len(waterCfg)); err != nil {
+		return nil, err
+	}
+	if cfg.MaxIterations == 0 {
+		cfg.MaxIterations = defaultOptimizeIterations
+	}
+	if cfg.Tolerance == 0 {
+		cfg.Tolerance = defaultOptimizeTolerance
+	}
+	// 水表会在设置拉速时覆盖水量，优化过程中不使用水表，返回前恢复
+	tables := c.castingMachine.WaterTables
+	c.castingMachine.WaterTables = nil
+	defer func() {
+		c.castingMachine.WaterTables = tables
+	}()
+
+	states := make([]*zoneOptimizeState, 0, len(cfg.Zones))
+	for _, limit := range cfg.Zones {
+		section := waterCfg[limit.Zone-1]
+		state := &zoneOptimizeState{limit: limit, water: section.InnerArcWaterVolume, outer: -1, narrow: -1, zoneIndex: limit.Zone - 1}
+		if section.InnerArcWaterVolume > 0 {
+			if section.OuterArcWaterVolume != nil {
+				state.outer = *section.OuterArcWaterVolume / section.InnerArcWaterVolume
+			}
+			state.narrow = section.NarrowSideWaterVolume / section.InnerArcWaterVolume
+		}
+		state.water = clampWater(state.water, limit)
+		states = append(states, state)
+	}
+
+	var best *WaterOptimizeResult
+	bestObjective := float32(math.MaxFloat32)
+	var last *WaterOptimizeResult
+	converged := false
+	for iteration := 1; ; iteration++ {
+		for _, state := range states {
+			setZoneWater(&waterCfg[state.zoneIndex], state)
+		}
+		if _, err := c.SolveSteadyState(); err != nil {
+			return nil, err
+		}
+		eval := c.evaluateSurface(cfg)
+		last = c.buildOptimizeResult(eval, iteration)
+
+		// 目标函数为偏差的均方根加上回温速率超出上限的部分
+		objective := eval.rms
+		converged = true
+		errs := make([]float32, len(states))
+		for i, state := range states {
+			excess := reheatExcess(eval.reheatRate[state.zoneIndex], cfg.MaxReheatRate)
+			objective += excess
+			errs[i] = eval.deviation[state.zoneIndex] + excess
+			if abs(errs[i]) >= cfg.Tolerance {
+				converged = false
+			}
+		}
+		// 收敛时直接使用本次的水量
+		if converged || objective < bestObjective {
+			best, bestObjective = last, objective
+		}
+		log.WithFields(log.Fields{
+			"iteration": iteration,
+			"rms":       eval.rms,
+			"reheat":    eval.maxReheat,
+			"deviation": eval.deviation,
+		}).Info("二冷水量优化迭代一次")
+		if converged || iteration >= cfg.MaxIterations {
+			break
+		}
+
+		changed := false
+		for i, state := range states {
+			water := state.next(errs[i])
+			if abs(water-state.water) >= minWaterChange {
+				changed = true
+			}
+			state.preWater, state.preError, state.hasPre = state.water, errs[i], true
+			state.water = water
+		}
+		if !changed {
+			break
+		}
+	}
+
+	if best != last {
+		// 最后一次的水量不是最优的，按最优水量重新计算稳态温度场
+		c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg = copyWaterSections(best.Water)
+		if _, err := c.SolveSteadyState(); err != nil {
+			return nil, err
+		}
+	}
+	best.Iterations = last.Iterations
+	best.Converged = converged
+	log.WithFields(log.Fields{
+		"speed":      best.Speed,
+		"rms":        best.RMS,
+		"reheat":     best.MaxReheatRate,
+		"iterations": best.Iterations,
+		"converged":  best.Converged,
+	}).Info("二冷水量优化完成")
+	return best, nil
+}
+
+// 按割线法计算下一次的水量，偏差为正（温度偏高）时增加水量
+func (s *zoneOptimizeState) next(e float32) float32 {
+	if s.hasPre && abs(s.water-s.preWater) >= minWaterChange {
+		if slope := (e - s.preError) / (s.water - s.preWater); slope < 0 {
+			s.slope = slope
+		}
+	}
+	span := s.limit.MaxWater - s.limit.MinWater
+	var delta float32
+	if s.slope < 0 {
+		delta = -e / s.slope
+	} else {
+		// 还没有有效的变化率，每 1℃ 的偏差调节 1% 的水量
+		base := s.water
+		if base < span*0.1 {
+			base = span * 0.1
+		}
+		delta = base * e / 100
+	}
+	// 单次调节不超过水量范围的一半，避免割线法在非线性较强时发散
+	if delta > span/2 {
+		delta = span / 2
+	}
+	if delta < -span/2 {
+		delta = -span / 2
+	}
+	return clampWater(s.water+delta, s.limit)
+}
+
+func clampWater(water float32, limit model.ZoneWaterLimit) float32 {
+	if water < limit.MinWater {
+		return limit.MinWater
+	}
+	if water > limit.MaxWater {
+		return limit.MaxWater
+	}
+	return water
+}
+
+func reheatExcess(rate, limit float32) float32 {
+	if limit <= 0 || rate <= limit {
+		return 0
+	}
+	return rate - limit
+}
+
+// 设置冷却区的内弧水量，外弧和窄面水量按比例同步调节
+func setZoneWater(section *model.SecondaryCoolingWaterSection, state *zoneOptimizeState) {
+	section.InnerArcWaterVolume = state.water
+	if state.outer >= 0 {
+		outer := state.water * state.outer
+		section.OuterArcWaterVolume = &outer
+	}
+	if state.narrow >= 0 {
+		section.NarrowSideWaterVolume = state.water * state.narrow
+	}
+}
+
+func copyWaterSections(sections []model.SecondaryCoolingWaterSection) []model.SecondaryCoolingWaterSection {
+	res := make([]model.SecondaryCoolingWaterSection, len(sections))
+	copy(res, sections)
+	for i := range res {
+		if res[i].OuterArcWaterVolume != nil {
+			outer := *res[i].OuterArcWaterVolume
+			res[i].OuterArcWaterVolume = &outer
+		}
+	}
+	return res
+}
+
+// 统计稳态温度场中各冷却区内弧宽面中心的表面温度与目标温度的偏差，以及回温速率
+func (c *calculatorWithArrDeque) evaluateSurface(cfg model.WaterOptimization) surfaceEvaluation {
+	zones := len(c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg)
+	optimized := make(map[int]bool)
+	for _, zone := range cfg.Zones {
+		optimized[zone.Zone] = true
+	}
+	eval := surfaceEvaluation{
+		deviation:  make([]float32, zones),
+		reheatRate: make([]float32, zones),
+		profile:    make([]SurfaceSample, 0),
+	}
+	count := make([]int, zones)
+	var reheat reheatTracker
+	var sum float64
+	var total int
+	row := Width/YStep - 1
+	c.Field.Traverse(func(z int, item *model.ItemType) {
+		if item[0][0] == -1 {
+			return
+		}
+		temp := item[row][0]
+		distance := float32((z + 1) * ZStep)
+		target := interpolate(cfg.Target, distance)
+		if (z+1)%kpiSampleStep == 0 {
+			eval.profile = append(eval.profile, SurfaceSample{Distance: distance, Temperature: temp, Target: target})
+		}
+		zone := c.castingMachine.SliceZone(z)
+		if zone <= Zone0 || zone > zones {
+			reheat.reset()
+			return
+		}
+		eval.deviation[zone-1] += temp - target
+		count[zone-1]++
+		if optimized[zone] {
+			sum += float64((temp - target) * (temp - target))
+			total++
+		}
+		if rate := reheat.add(temp); rate > eval.reheatRate[zone-1] {
+			eval.reheatRate[zone-1] = rate
+		}
+	}, 0, c.Field.Size())
+	for i := range eval.deviation {
+		if count[i] > 0 {
+			eval.deviation[i] /= float32(count[i])
+		}
+		if eval.reheatRate[i] > eval.maxReheat {
+			eval.maxReheat = eval.reheatRate[i]
+		}
+	}
+	if total > 0 {
+		eval.rms = float32(math.Sqrt(sum / float64(total)))
+	}
+	return eval
+}
+
+// 沿拉坯方向逐个切片计算表面回温速率，取 1m 内表面温度的最大升高
+type reheatTracker struct {
+	temps []float32 // 最近 1m 内各切片的表面温度
+}
+
+func (r *reheatTracker) reset() {
+	r.temps = r.temps[:0]
+}
+
+// 加入下一个切片的表面温度，返回该切片处的回温速率 ℃/m
+func (r *reheatTracker) add(temp float32) float32 {
+	r.temps = append(r.temps, temp)
+	if len(r.temps) > reheatWindow {
+		r.temps = r.temps[1:]
+	}
+	min := temp
+	for _, t := range r.temps {
+		if t < min {
+			min = t
+		}
+	}
+	return (temp - min) * 1000 / float32(reheatWindow*ZStep)
+}
+
+func (c *calculatorWithArrDeque) buildOptimizeResult(eval surfaceEvaluation, iteration int) *WaterOptimizeResult {
+	return &WaterOptimizeResult{
+		Speed:         c.castingMachine.speed,
+		Water:         copyWaterSections(c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg),
+		Deviation:     eval.deviation,
+		ReheatRate:    eval.reheatRate,
+		RMS:           eval.rms,
+		MaxReheatRate: eval.maxReheat,
+		Iterations:    iteration,
+		Profile:       eval.profile,
+	}
+}
+
+// 由若干拉速下的优化结果生成 zones 中各冷却区的水表，只有一个拉速时水量为常数
+func BuildWaterTables(results []*WaterOptimizeResult, zones []int) []model.ZoneWaterTable {
+	if len(results) == 0 {
+		return nil
+	}
+	sorted := make([]*WaterOptimizeResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Speed < sorted[j].Speed
+	})
+	tables := make([]model.ZoneWaterTable, 0, len(zones))
+	for _, zone := range zones {
+		var inner, outer, narrow [][2]float32
+		for _, result := range sorted {
+			section := result.Water[zone-1]
+			inner = append(inner, [2]float32{result.Speed, section.InnerArcWaterVolume})
+			if section.OuterArcWaterVolume != nil {
+				outer = append(outer, [2]float32{result.Speed, *section.OuterArcWaterVolume})
+			}
+			narrow = append(narrow, [2]float32{result.Speed, section.NarrowSideWaterVolume})
+		}
+		table := model.ZoneWaterTable{
+			Zone: zone,
+			Speed: model.Speed2Water{
+				Bottom: sorted[0].Speed,
+				Top:    sorted[len(sorted)-1].Speed,
+			},
+			InnerArc: waterCurveOfPoints(inner),
+		}
+		narrowCurve := waterCurveOfPoints(narrow)
+		table.NarrowSide = &narrowCurve
+		if len(outer) == len(inner) {
+			outerCurve := waterCurveOfPoints(outer)
+			table.OuterArc = &outerCurve
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// 拉速严格递增的 (拉速, 水量) 点对应的水量曲线，只有一个点时为常数
+func waterCurveOfPoints(points [][2]float32) model.WaterCurve {
+	if len(points) == 1 {
+		return model.WaterCurve{Type: WaterCurveQuadratic, Coef: [3]float32{0, 0, points[0][1]}}
+	}
+	return model.WaterCurve{Type: WaterCurvePiecewiseLinear, Points: points}
+}
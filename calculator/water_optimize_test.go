@@ -0,0 +1,168 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+	"testing"
+)
+
+func TestCheckWaterOptimization(t *testing.T) {
+	target := [][2]float32{{0, 1000}, {1000, 900}}
+	zones := []model.ZoneWaterLimit{{Zone: 1, MaxWater: 100}}
+	cases := map[string]model.WaterOptimization{
+		"目标曲线点数不足":   {Target: target[:1], Zones: zones},
+		"目标曲线距离未递增":  {Target: [][2]float32{{0, 1000}, {0, 900}}, Zones: zones},
+		"回温速率上限为负数":  {Target: target, Zones: zones, MaxReheatRate: -1},
+		"没有参与优化的冷却区": {Target: target},
+		"冷却区编号超出范围":  {Target: target, Zones: []model.ZoneWaterLimit{{Zone: 3, MaxWater: 100}}},
+		"冷却区重复":      {Target: target, Zones: append(zones, zones...)},
+		"水量范围错误":     {Target: target, Zones: []model.ZoneWaterLimit{{Zone: 1, MinWater: 100, MaxWater: 10}}},
+	}
+	for name, cfg := range cases {
+		if checkWaterOptimization(cfg, 2) == nil {
+			t.Fatal(name, "未返回错误")
+		}
+	}
+	if err := checkWaterOptimization(model.WaterOptimization{Target: target, Zones: zones}, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestZoneOptimizeStateNext(t *testing.T) {
+	s := &zoneOptimizeState{limit: model.ZoneWaterLimit{Zone: 1, MinWater: 10, MaxWater: 210}, water: 100}
+	// 还没有变化率时每 1℃ 调节 1% 的水量
+	if water := s.next(10); water != 110 {
+		t.Fatal("按比例调节的水量错误", water)
+	}
+	// 水量增加 10 偏差减小 20，变化率为 -2，偏差为 5 时再增加 2.5
+	s.preWater, s.preError, s.hasPre, s.water = 100, 30, true, 110
+	if water := s.next(10); math.Abs(float64(water-115)) > 1e-4 || s.slope != -2 {
+		t.Fatal("割线法调节的水量错误", water, s.slope)
+	}
+	// 变化率为正数时使用上一次有效的变化率
+	s.preWater, s.preError, s.water = 110, 10, 115
+	if water := s.next(20); math.Abs(float64(water-125)) > 1e-4 || s.slope != -2 {
+		t.Fatal("变化率无效时调节的水量错误", water, s.slope)
+	}
+	// 单次调节不超过水量范围的一半，且不超出水量范围
+	s.hasPre = false
+	if water := s.next(1000); water != 210 {
+		t.Fatal("水量超出上限", water)
+	}
+	s.water = 20
+	if water := s.next(-1000); water != 10 {
+		t.Fatal("水量低于下限", water)
+	}
+}
+
+func TestEvaluateSurface(t *testing.T) {
+	c := newControlTestCalculator(t, 1000)
+	c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg = []model.SecondaryCoolingWaterSection{{}}
+	// 二冷区内表面温度先以 1℃/切片 下降 10 个切片，再以 2℃/切片 回升
+	c.initSteadyStateField()
+	var first = -1
+	for z := 0; z < ZLength/ZStep; z++ {
+		temp := float32(1000)
+		if c.castingMachine.SliceZone(z) == 1 {
+			if first == -1 {
+				first = z
+			}
+			if i := z - first; i < 10 {
+				temp -= float32(i)
+			} else {
+				temp += float32(2*(i-10)) - 10
+			}
+		}
+		c.addLastSlice(1500)
+		c.thermalField.GetSlice(z)[Width/YStep-1][0] = temp
+	}
+	if first == -1 {
+		t.Fatal("没有处于二冷区的切片")
+	}
+	cfg := model.WaterOptimization{Target: [][2]float32{{0, 990}, {10000, 990}}, Zones: []model.ZoneWaterLimit{{Zone: 1}}}
+	eval := c.evaluateSurface(cfg)
+	n := ZLength/ZStep - first
+	var sum, sq float64
+	for i := 0; i < n; i++ {
+		temp := float64(1000 - i)
+		if i >= 10 {
+			temp = float64(1000 + 2*(i-10) - 10)
+		}
+		sum += temp - 990
+		sq += (temp - 990) * (temp - 990)
+	}
+	if math.Abs(float64(eval.deviation[0])-sum/float64(n)) > 1e-3 {
+		t.Fatal("平均偏差错误", eval.deviation[0], sum/float64(n))
+	}
+	if math.Abs(float64(eval.rms)-math.Sqrt(sq/float64(n))) > 1e-3 {
+		t.Fatal("均方根偏差错误", eval.rms)
+	}
+	// 1m 内最多回升 2*(n-11) ℃
+	rise := float32(2 * (n - 11))
+	if reheatWindow < n-10 {
+		rise = float32(2 * (reheatWindow - 1))
+	}
+	if eval.maxReheat != rise*1000/float32(reheatWindow*ZStep) || eval.reheatRate[0] != eval.maxReheat {
+		t.Fatal("回温速率错误", eval.reheatRate, rise)
+	}
+	if len(eval.profile) != ZLength/ZStep/kpiSampleStep {
+		t.Fatal("表面温度采样数量错误", len(eval.profile))
+	}
+}
+
+func TestOptimizeWaterKeepsWaterTables(t *testing.T) {
+	c := newControlTestCalculator(t, 1000)
+	c.castingMachine.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg = []model.SecondaryCoolingWaterSection{{InnerArcWaterVolume: 100}}
+	tables := []model.ZoneWaterTable{{Zone: 1}}
+	c.castingMachine.WaterTables = tables
+	// 正在进行非稳态计算时稳态计算失败，优化中途返回
+	c.runningState = stateRunning
+	cfg := model.WaterOptimization{Target: [][2]float32{{0, 990}, {10000, 990}}, Zones: []model.ZoneWaterLimit{{Zone: 1, MaxWater: 200}}}
+	if _, err := c.OptimizeWater(cfg); err == nil {
+		t.Fatal("正在计算时水量优化应失败")
+	}
+	if len(c.castingMachine.WaterTables) != 1 || &c.castingMachine.WaterTables[0] != &tables[0] {
+		t.Fatal("水量优化后应恢复原来的水表", c.castingMachine.WaterTables)
+	}
+}
+
+func TestBuildWaterTables(t *testing.T) {
+	outer := float32(60)
+	newResult := func(v, inner float32) *WaterOptimizeResult {
+		return &WaterOptimizeResult{Speed: v, Water: []model.SecondaryCoolingWaterSection{
+			{InnerArcWaterVolume: 50},
+			{InnerArcWaterVolume: inner, NarrowSideWaterVolume: inner / 2, OuterArcWaterVolume: &outer},
+		}}
+	}
+	// 只有一个拉速时水量为常数
+	tables := BuildWaterTables([]*WaterOptimizeResult{newResult(1.2, 100)}, []int{2})
+	if len(tables) != 1 || tables[0].Zone != 2 || CheckWaterTables(tables, 2) != nil {
+		t.Fatal("水表错误", tables)
+	}
+	if waterOfCurve(tables[0].InnerArc, 2.0) != 100 || waterOfCurve(*tables[0].NarrowSide, 0.5) != 50 || waterOfCurve(*tables[0].OuterArc, 1.2) != 60 {
+		t.Fatal("常数水表的水量错误", tables[0])
+	}
+	// 多个拉速时按拉速排列为分段线性曲线
+	tables = BuildWaterTables([]*WaterOptimizeResult{newResult(1.5, 200), newResult(1.0, 100)}, []int{1, 2})
+	if len(tables) != 2 || CheckWaterTables(tables, 2) != nil {
+		t.Fatal("水表错误", tables)
+	}
+	if tables[1].Speed.Bottom != 1.0 || tables[1].Speed.Top != 1.5 || tables[1].InnerArc.Type != WaterCurvePiecewiseLinear {
+		t.Fatal("水表的拉速范围错误", tables[1])
+	}
+	if math.Abs(float64(waterOfCurve(tables[1].InnerArc, 1.25)-150)) > 1e-3 || waterOfCurve(tables[0].InnerArc, 1.25) != 50 {
+		t.Fatal("分段线性水表的水量错误", tables)
+	}
+}
+
+func TestSliceZone(t *testing.T) {
+	m := NewCastingMachine()
+	m.Coordinate.MdLength, m.Coordinate.LevelHeight = 950, 100
+	m.CoolerConfig.SecondaryCoolingZoneCfg.CoolingZoneCfg = []model.CoolingZone{{EndDistance: 1243}, {EndDistance: 2063}}
+	cases := map[int]int{0: Zone0, 84: Zone0, 85: 1, 124: 1, 125: 2, 206: 2, 207: -1}
+	for z, zone := range cases {
+		if m.SliceZone(z) != zone {
+			t.Fatal("切片所在的冷却区错误", z, m.SliceZone(z), zone)
+		}
+	}
+}
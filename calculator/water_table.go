@@ -0,0 +1,151 @@
+package calculator
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"lz/model"
+	"math"
+)
+
+// 二冷区水表
+//
+// 实际铸机的二冷水量随拉速变化，每个冷却区的内弧、外弧和窄面水量分别由一条水量-拉速曲线给出，
+// 曲线可以是二次曲线或分段线性曲线。设置拉速时按水表重新设置对应冷却区的水量，没有水表的冷却区保持不变。
+
+const (
+	WaterCurveQuadratic       = "quadratic"        // 二次曲线
+	WaterCurvePiecewiseLinear = "piecewise_linear" // 分段线性
+)
+
+// 检查水表，zones 为二冷区的分区数
+func CheckWaterTables(tables []model.ZoneWaterTable, zones int) error {
+	seen := make(map[int]bool)
+	for _, table := range tables {
+		if table.Zone < 1 || table.Zone > zones {
+			return fmt.Errorf("水表的冷却区编号 %d 超出范围 1-%d", table.Zone, zones)
+		}
+		if seen[table.Zone] {
+			return fmt.Errorf("冷却区 %d 的水表重复", table.Zone)
+		}
+		seen[table.Zone] = true
+		if table.Speed.Bottom < 0 || table.Speed.Top < table.Speed.Bottom || table.Speed.Step < 0 {
+			return fmt.Errorf("冷却区 %d 水表的拉速范围错误", table.Zone)
+		}
+		if err := checkWaterCurve(table.InnerArc); err != nil {
+			return fmt.Errorf("冷却区 %d 内弧水表错误: %v", table.Zone, err)
+		}
+		if table.OuterArc != nil {
+			if err := checkWaterCurve(*table.OuterArc); err != nil {
+				return fmt.Errorf("冷却区 %d 外弧水表错误: %v", table.Zone, err)
+			}
+		}
+		if table.NarrowSide != nil {
+			if err := checkWaterCurve(*table.NarrowSide); err != nil {
+				return fmt.Errorf("冷却区 %d 窄面水表错误: %v", table.Zone, err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkWaterCurve(curve model.WaterCurve) error {
+	switch curve.Type {
+	case WaterCurveQuadratic:
+		return nil
+	case WaterCurvePiecewiseLinear:
+		if len(curve.Points) < 2 {
+			return errors.New("分段线性曲线至少需要两个拐点")
+		}
+		for i, point := range curve.Points {
+			if point[1] < 0 {
+				return fmt.Errorf("第 %d 个拐点的水量为负数", i+1)
+			}
+			if i > 0 && point[0] <= curve.Points[i-1][0] {
+				return errors.New("分段线性曲线的拉速需要严格递增")
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("不支持的曲线类型 %s，可选 %s、%s", curve.Type, WaterCurveQuadratic, WaterCurvePiecewiseLinear)
+}
+
+// 拉速 v(m/min) 对应的水量，分段线性曲线超出拐点范围时取两端的水量，水量不小于 0
+func waterOfCurve(curve model.WaterCurve, v float32) float32 {
+	var water float32
+	if curve.Type == WaterCurveQuadratic {
+		water = curve.Coef[0]*v*v + curve.Coef[1]*v + curve.Coef[2]
+	} else {
+		water = interpolate(curve.Points, v)
+	}
+	if water < 0 {
+		water = 0
+	}
+	return water
+}
+
+// 按横坐标严格递增的点 points 线性插值，超出范围时取两端的值
+func interpolate(points [][2]float32, x float32) float32 {
+	if x <= points[0][0] {
+		return points[0][1]
+	}
+	for i := 1; i < len(points); i++ {
+		if x <= points[i][0] {
+			ratio := (x - points[i-1][0]) / (points[i][0] - points[i-1][0])
+			return points[i-1][1] + (points[i][1]-points[i-1][1])*ratio
+		}
+	}
+	return points[len(points)-1][1]
+}
+
+// 按水表的拉速范围和量化步长处理拉速
+func tableSpeed(speed model.Speed2Water, v float32) float32 {
+	if speed.Step > 0 {
+		v = float32(math.Round(float64(v/speed.Step))) * speed.Step
+	}
+	if speed.Top > 0 {
+		if v < speed.Bottom {
+			v = speed.Bottom
+		}
+		if v > speed.Top {
+			v = speed.Top
+		}
+	}
+	return v
+}
+
+// 设置水表并按当前拉速设置二冷水量
+func (c *CastingMachine) SetWaterTables(tables []model.ZoneWaterTable) error {
+	if err := CheckWaterTables(tables, len(c.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg)); err != nil {
+		return err
+	}
+	c.WaterTables = tables
+	c.applyWaterTables()
+	return nil
+}
+
+// 按当前拉速和水表设置二冷水量
+func (c *CastingMachine) applyWaterTables() {
+	if len(c.WaterTables) == 0 {
+		return
+	}
+	v := c.speed
+	waterCfg := c.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg
+	for _, table := range c.WaterTables {
+		if table.Zone > len(waterCfg) {
+			continue
+		}
+		speed := tableSpeed(table.Speed, v)
+		cfg := &waterCfg[table.Zone-1]
+		cfg.InnerArcWaterVolume = waterOfCurve(table.InnerArc, speed)
+		cfg.OuterArcWaterVolume = nil
+		if table.OuterArc != nil {
+			outer := waterOfCurve(*table.OuterArc, speed)
+			cfg.OuterArcWaterVolume = &outer
+		}
+		if table.NarrowSide != nil {
+			cfg.NarrowSideWaterVolume = waterOfCurve(*table.NarrowSide, speed)
+		}
+	}
+	log.WithFields(log.Fields{"v": v, "SecondaryCoolingWaterCfg": waterCfg}).Info("按水表设置二冷水量")
+}
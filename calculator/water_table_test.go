@@ -0,0 +1,88 @@
+package calculator
+
+import (
+	"lz/model"
+	"math"
+	"testing"
+)
+
+func TestWaterOfCurve(t *testing.T) {
+	quadratic := model.WaterCurve{Type: WaterCurveQuadratic, Coef: [3]float32{10, 20, 30}}
+	if water := waterOfCurve(quadratic, 1.5); math.Abs(float64(water-82.5)) > 1e-4 {
+		t.Fatal("二次曲线水量错误", water)
+	}
+	linear := model.WaterCurve{Type: WaterCurvePiecewiseLinear, Points: [][2]float32{{1, 100}, {1.5, 150}, {2, 160}}}
+	cases := map[float32]float32{0.5: 100, 1: 100, 1.25: 125, 1.75: 155, 2.5: 160}
+	for v, expected := range cases {
+		if water := waterOfCurve(linear, v); math.Abs(float64(water-expected)) > 1e-4 {
+			t.Fatal("分段线性曲线水量错误", v, water)
+		}
+	}
+	if water := waterOfCurve(model.WaterCurve{Type: WaterCurveQuadratic, Coef: [3]float32{0, -100, 10}}, 1); water != 0 {
+		t.Fatal("水量不应小于 0", water)
+	}
+}
+
+func TestTableSpeed(t *testing.T) {
+	speed := model.Speed2Water{Bottom: 0.8, Top: 2, Step: 0.1}
+	cases := map[float32]float32{0.5: 0.8, 1.23: 1.2, 1.27: 1.3, 2.4: 2}
+	for v, expected := range cases {
+		if s := tableSpeed(speed, v); math.Abs(float64(s-expected)) > 1e-4 {
+			t.Fatal("水表拉速错误", v, s)
+		}
+	}
+	if tableSpeed(model.Speed2Water{}, 1.23) != 1.23 {
+		t.Fatal("未设置拉速范围时不应改变拉速")
+	}
+}
+
+func TestCheckWaterTables(t *testing.T) {
+	inner := model.WaterCurve{Type: WaterCurveQuadratic}
+	cases := map[string][]model.ZoneWaterTable{
+		"冷却区编号超出范围": {{Zone: 3, InnerArc: inner}},
+		"冷却区重复":     {{Zone: 1, InnerArc: inner}, {Zone: 1, InnerArc: inner}},
+		"拉速范围错误":    {{Zone: 1, InnerArc: inner, Speed: model.Speed2Water{Bottom: 2, Top: 1}}},
+		"曲线类型错误":    {{Zone: 1, InnerArc: model.WaterCurve{Type: "cubic"}}},
+		"拐点数量不足":    {{Zone: 1, InnerArc: model.WaterCurve{Type: WaterCurvePiecewiseLinear, Points: [][2]float32{{1, 100}}}}},
+		"拉速不递增":     {{Zone: 1, InnerArc: model.WaterCurve{Type: WaterCurvePiecewiseLinear, Points: [][2]float32{{1, 100}, {1, 120}}}}},
+		"窄面水量为负数":   {{Zone: 1, InnerArc: inner, NarrowSide: &model.WaterCurve{Type: WaterCurvePiecewiseLinear, Points: [][2]float32{{1, -1}, {2, 10}}}}},
+	}
+	for name, tables := range cases {
+		if CheckWaterTables(tables, 2) == nil {
+			t.Fatal(name, "未返回错误")
+		}
+	}
+	if err := CheckWaterTables([]model.ZoneWaterTable{{Zone: 2, InnerArc: inner}}, 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetVWithWaterTables(t *testing.T) {
+	c := NewCastingMachine()
+	c.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg = []model.SecondaryCoolingWaterSection{
+		{InnerArcWaterVolume: 100, NarrowSideWaterVolume: 50},
+		{InnerArcWaterVolume: 200, NarrowSideWaterVolume: 60},
+	}
+	c.SetV(1.5)
+	err := c.SetWaterTables([]model.ZoneWaterTable{{
+		Zone:       2,
+		InnerArc:   model.WaterCurve{Type: WaterCurvePiecewiseLinear, Points: [][2]float32{{1, 100}, {2, 300}}},
+		OuterArc:   &model.WaterCurve{Type: WaterCurveQuadratic, Coef: [3]float32{0, 100, 0}},
+		NarrowSide: &model.WaterCurve{Type: WaterCurveQuadratic, Coef: [3]float32{0, 0, 40}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waterCfg := c.CoolerConfig.SecondaryCoolingZoneCfg.SecondaryCoolingWaterCfg
+	if waterCfg[1].InnerArcWaterVolume != 200 || waterCfg[1].OuterArcVolume() != 150 || waterCfg[1].NarrowSideWaterVolume != 40 {
+		t.Fatal("设置水表后水量错误", waterCfg[1])
+	}
+	c.SetV(1.8)
+	if math.Abs(float64(waterCfg[1].InnerArcWaterVolume-260)) > 1e-3 || math.Abs(float64(waterCfg[1].OuterArcVolume()-180)) > 1e-3 {
+		t.Fatal("拉速变化后水量错误", waterCfg[1])
+	}
+	// 没有水表的冷却区保持不变
+	if waterCfg[0].InnerArcWaterVolume != 100 || waterCfg[0].NarrowSideWaterVolume != 50 {
+		t.Fatal("没有水表的冷却区水量不应改变", waterCfg[0])
+	}
+}
@@ -0,0 +1,170 @@
+// batch 脱离 websocket 前端，离线运行一次完整的温度场计算
+//
+// 用法:
+//
+//	batch -conf conf -env conf/env.json -duration 30m -out output
+//
+// 计算结束后在输出目录中写入:
+//   - field.json 最终温度场（与 data_push 推送的数据结构相同）
+//   - kpi.json   坯壳厚度、冶金长度等关键指标
+//   - control.json 二冷动态控制的控制动作（指定 -control 时）
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"lz/calculator"
+	"lz/config"
+	"lz/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var (
+	confDir    = flag.String("conf", "", "配置文件目录，默认读取环境变量 "+config.EnvConfDir+"，未设置时为 ./"+config.DefaultConfDir)
+	casterFile = flag.String("caster", "", "铸机配置文件，默认为配置目录下的 caster.json")
+	envFile    = flag.String("env", "", "计算环境参数文件（model.Env），默认为配置目录下的 env.json")
+	nozzleFile = flag.String("nozzle", "", "喷嘴布置配置文件，默认为配置目录下的 nozzle.json")
+	duration   = flag.Duration("duration", 30*time.Minute, "模拟时间")
+	steady     = flag.Bool("steady", false, "直接求解稳态温度场，忽略 -duration")
+	solver     = flag.String("solver", "", "求解器 explicit 或 adi，默认使用 config.ini 中的配置")
+	section    = flag.String("section", "", "计算断面 quarter 或 half，默认使用 env 文件或 config.ini 中的配置")
+	axial      = flag.String("axial", "", "是否计算拉坯方向的导热 true 或 false，默认使用 config.ini 中的配置")
+	control    = flag.String("control", "", "二冷动态控制配置文件（model.DynamicControl），设置后输出 control.json")
+	outDir     = flag.String("out", "output", "结果输出目录")
+	debug      = flag.Bool("debug", false, "输出计算过程日志")
+)
+
+func main() {
+	flag.Parse()
+	if !*debug {
+		log.SetLevel(log.WarnLevel)
+	}
+	if err := config.Init(config.ResolveDir(*confDir)); err != nil {
+		log.Fatal("配置校验失败: ", err)
+	}
+	if err := calculator.LoadCfg(config.CalculatorFile()); err != nil {
+		log.Fatal("计算器参数读取失败: ", err)
+	}
+	if err := calculator.LoadSteelLibrary(config.PhaseTemperatureFile(), config.PhysicalParameterFile()); err != nil {
+		log.Fatal("钢种库加载失败: ", err)
+	}
+	if *casterFile == "" {
+		*casterFile = config.CasterFile(config.DefaultCaster)
+	}
+	if *nozzleFile == "" {
+		*nozzleFile = config.NozzleFile()
+	}
+	if *envFile == "" {
+		*envFile = config.EnvFile()
+	}
+
+	env, err := config.LoadEnv(*casterFile, *envFile)
+	if err != nil {
+		log.Fatal("读取计算环境失败: ", err)
+	}
+	nozzleCfgData, err := ioutil.ReadFile(*nozzleFile)
+	if err != nil {
+		log.Fatal("读取喷嘴配置失败: ", err)
+	}
+
+	// 初始化计算断面和铸坯尺寸，与 websocket 中 env 消息的处理保持一致
+	if *section != "" {
+		env.SectionMode = *section
+	}
+	if err = calculator.SetSection(env.SectionMode, env.Coordinate.Length, env.Coordinate.Width); err != nil {
+		log.Fatal("设置计算断面失败: ", err)
+	}
+	if err = calculator.CheckEnv(env); err != nil {
+		log.Fatal("计算环境配置错误: ", err)
+	}
+	calculator.ZLength = env.Coordinate.ZLength
+	c := calculator.NewCalculatorWithArrDeque(nil)
+	c.GetCastingMachine().SetFromJson(env.Coordinate)
+	c.GetCastingMachine().SetCoolerConfig(env, nozzleCfgData)
+	c.GetCastingMachine().SetV(env.DragSpeed)
+	if err = c.InitSteel(env.SteelValue, c.GetCastingMachine()); err != nil {
+		log.Fatal("初始化钢种失败: ", err)
+	}
+	c.InitPushData(env.Coordinate)
+	if *solver != "" {
+		if err = c.ChangeSolver(*solver); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *axial != "" {
+		on, err := strconv.ParseBool(*axial)
+		if err != nil {
+			log.Fatal("-axial 参数错误: ", err)
+		}
+		c.SetAxialConduction(on)
+	}
+	if *control != "" {
+		var cfg model.DynamicControl
+		data, err := ioutil.ReadFile(*control)
+		if err == nil {
+			err = json.Unmarshal(data, &cfg)
+		}
+		if err == nil {
+			err = c.SetDynamicControl(cfg)
+		}
+		if err != nil {
+			log.Fatal("设置二冷动态控制失败: ", err)
+		}
+	}
+
+	start := time.Now()
+	var simulated time.Duration
+	if *steady {
+		log.Warn("开始稳态计算")
+		if _, err = c.SolveSteadyState(); err != nil {
+			log.Fatal("稳态计算失败: ", err)
+		}
+		// 稳态温度场对应铸坯从弯月面走到铸机末端的时间
+		simulated = calculator.OneSliceDuration * time.Duration(calculator.ZLength/calculator.ZStep)
+	} else {
+		log.WithField("duration", *duration).Warn("开始离线计算")
+		simulated = c.RunFor(*duration)
+	}
+	log.WithFields(log.Fields{
+		"simulated": simulated,
+		"cost":      time.Since(start),
+	}).Warn("离线计算完成")
+
+	kpi := c.BuildKPI()
+	kpi.SimulatedTime = simulated.Seconds()
+	if err = writeResult(*outDir, c.BuildData(), kpi); err != nil {
+		log.Fatal("写入计算结果失败: ", err)
+	}
+	if *control != "" {
+		data, err := json.MarshalIndent(c.ControlHistory(), "", "  ")
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(*outDir, "control.json"), data, 0644)
+		}
+		if err != nil {
+			log.Fatal("写入控制动作失败: ", err)
+		}
+	}
+}
+
+func writeResult(dir string, field *calculator.TemperatureFieldData, kpi *calculator.KPI) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(field)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "field.json"), data, 0644); err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(kpi, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "kpi.json"), data, 0644)
+}
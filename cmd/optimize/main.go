@@ -0,0 +1,206 @@
+// optimize 离线优化二冷水量，使内弧宽面中心的表面温度接近目标曲线
+//
+// 用法:
+//
+//	optimize -conf conf -env conf/env.json -target target.json -speed 1.0,1.2,1.5 -out output
+//
+// target.json 为 model.WaterOptimization，包括目标表面温度曲线、回温速率上限和各冷却区的水量范围。
+// 每个拉速分别以稳态温度场进行优化，计算结束后在输出目录中写入:
+//   - water_table.json 各冷却区的水表（[]model.ZoneWaterTable），可以直接用于 set_water_tables 消息或 caster.json
+//   - optimize.json    每个拉速的优化结果，包括水量、各冷却区的偏差、回温速率和表面温度曲线
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"lz/calculator"
+	"lz/config"
+	"lz/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	confDir    = flag.String("conf", "", "配置文件目录，默认读取环境变量 "+config.EnvConfDir+"，未设置时为 ./"+config.DefaultConfDir)
+	casterFile = flag.String("caster", "", "铸机配置文件，默认为配置目录下的 caster.json")
+	envFile    = flag.String("env", "", "计算环境参数文件（model.Env），默认为配置目录下的 env.json")
+	nozzleFile = flag.String("nozzle", "", "喷嘴布置配置文件，默认为配置目录下的 nozzle.json")
+	targetFile = flag.String("target", "", "优化目标文件（model.WaterOptimization）")
+	steel      = flag.Int("steel", 0, "钢种编号，默认使用 env 文件中的钢种")
+	speeds     = flag.String("speed", "", "拉速 m/min，多个拉速用逗号分隔，默认使用 env 文件中的拉速")
+	solver     = flag.String("solver", "", "求解器 explicit 或 adi，默认使用 config.ini 中的配置")
+	section    = flag.String("section", "", "计算断面 quarter 或 half，默认使用 env 文件或 config.ini 中的配置")
+	outDir     = flag.String("out", "output", "结果输出目录")
+	debug      = flag.Bool("debug", false, "输出计算过程日志")
+)
+
+func main() {
+	flag.Parse()
+	if !*debug {
+		log.SetLevel(log.WarnLevel)
+	}
+	if *targetFile == "" {
+		log.Fatal("需要使用 -target 指定优化目标文件")
+	}
+	if err := config.Init(config.ResolveDir(*confDir)); err != nil {
+		log.Fatal("配置校验失败: ", err)
+	}
+	if err := calculator.LoadCfg(config.CalculatorFile()); err != nil {
+		log.Fatal("计算器参数读取失败: ", err)
+	}
+	if err := calculator.LoadSteelLibrary(config.PhaseTemperatureFile(), config.PhysicalParameterFile()); err != nil {
+		log.Fatal("钢种库加载失败: ", err)
+	}
+	if *casterFile == "" {
+		*casterFile = config.CasterFile(config.DefaultCaster)
+	}
+	if *nozzleFile == "" {
+		*nozzleFile = config.NozzleFile()
+	}
+	if *envFile == "" {
+		*envFile = config.EnvFile()
+	}
+
+	env, err := config.LoadEnv(*casterFile, *envFile)
+	if err != nil {
+		log.Fatal("读取计算环境失败: ", err)
+	}
+	nozzleCfgData, err := ioutil.ReadFile(*nozzleFile)
+	if err != nil {
+		log.Fatal("读取喷嘴配置失败: ", err)
+	}
+	var target model.WaterOptimization
+	data, err := ioutil.ReadFile(*targetFile)
+	if err == nil {
+		err = json.Unmarshal(data, &target)
+	}
+	if err != nil {
+		log.Fatal("读取优化目标失败: ", err)
+	}
+	speedList, err := parseSpeeds(*speeds, env.DragSpeed)
+	if err != nil {
+		log.Fatal("-speed 参数错误: ", err)
+	}
+	if *steel != 0 {
+		env.SteelValue = *steel
+	}
+
+	// 初始化计算断面和铸坯尺寸，与 batch 保持一致
+	if *section != "" {
+		env.SectionMode = *section
+	}
+	if err = calculator.SetSection(env.SectionMode, env.Coordinate.Length, env.Coordinate.Width); err != nil {
+		log.Fatal("设置计算断面失败: ", err)
+	}
+	if err = calculator.CheckEnv(env); err != nil {
+		log.Fatal("计算环境配置错误: ", err)
+	}
+	calculator.ZLength = env.Coordinate.ZLength
+	c := calculator.NewCalculatorWithArrDeque(nil)
+	c.GetCastingMachine().SetFromJson(env.Coordinate)
+	c.GetCastingMachine().SetCoolerConfig(env, nozzleCfgData)
+	c.GetCastingMachine().SetV(speedList[0])
+	if err = c.InitSteel(env.SteelValue, c.GetCastingMachine()); err != nil {
+		log.Fatal("初始化钢种失败: ", err)
+	}
+	c.InitPushData(env.Coordinate)
+	if *solver != "" {
+		if err = c.ChangeSolver(*solver); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// 每个拉速从上一个拉速的优化结果开始迭代。第一个拉速的初始水量已按计算环境中的水表设置，
+	// 之后清除水表，避免 SetV 按水表重新设置水量
+	if err = c.GetCastingMachine().SetWaterTables(nil); err != nil {
+		log.Fatal(err)
+	}
+	results := make([]*calculator.WaterOptimizeResult, 0, len(speedList))
+	for _, v := range speedList {
+		start := time.Now()
+		c.GetCastingMachine().SetV(v)
+		result, err := c.OptimizeWater(target)
+		if err != nil {
+			log.Fatal("水量优化失败: ", err)
+		}
+		fields := log.Fields{
+			"speed":           v,
+			"rms":             result.RMS,
+			"max_reheat_rate": result.MaxReheatRate,
+			"iterations":      result.Iterations,
+			"cost":            time.Since(start),
+		}
+		if result.Converged {
+			log.WithFields(fields).Warn("水量优化完成")
+		} else {
+			log.WithFields(fields).Warn("水量优化未收敛，使用偏差最小的水量")
+		}
+		results = append(results, result)
+	}
+
+	zones := make([]int, 0, len(target.Zones))
+	for _, zone := range target.Zones {
+		zones = append(zones, zone.Zone)
+	}
+	sort.Ints(zones)
+	tables := calculator.BuildWaterTables(results, zones)
+	if err = writeResult(*outDir, tables, results); err != nil {
+		log.Fatal("写入优化结果失败: ", err)
+	}
+}
+
+// 解析逗号分隔的拉速，按从小到大排列并去掉重复的拉速，为空时使用 defaultSpeed
+func parseSpeeds(s string, defaultSpeed float32) ([]float32, error) {
+	if strings.TrimSpace(s) == "" {
+		if defaultSpeed <= 0 {
+			return nil, errors.New("env 文件中未设置拉速")
+		}
+		return []float32{defaultSpeed}, nil
+	}
+	var res []float32
+	for _, item := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(item), 32)
+		if err != nil {
+			return nil, err
+		}
+		if v <= 0 {
+			return nil, errors.New("拉速需要大于 0")
+		}
+		res = append(res, float32(v))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	unique := res[:1]
+	for _, v := range res[1:] {
+		if v != unique[len(unique)-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique, nil
+}
+
+func writeResult(dir string, tables []model.ZoneWaterTable, results []*calculator.WaterOptimizeResult) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(tables, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "water_table.json"), data, 0644); err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "optimize.json"), data, 0644)
+}
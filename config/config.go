@@ -0,0 +1,144 @@
+// config 负责定位并校验配置文件目录
+//
+// 配置目录的优先级：命令行参数 -conf > 环境变量 LZ_CONF_DIR > 默认目录 ./conf。
+// 目录中需要包含以下文件：
+//   - caster.json              默认铸机配置，select_caster 消息会读取同目录下的 <name>.json
+//   - nozzle.json              喷嘴布置配置
+//   - phase_temperature.json   固液相线温度
+//   - physical_parameter.json  物性参数
+//   - config.ini               计算器参数
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/ini.v1"
+	"io/ioutil"
+	"lz/model"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	EnvConfDir     = "LZ_CONF_DIR" // 指定配置目录的环境变量
+	DefaultConfDir = "conf"
+
+	DefaultCaster         = "caster"
+	envFile               = "env.json"
+	nozzleFile            = "nozzle.json"
+	phaseTemperatureFile  = "phase_temperature.json"
+	physicalParameterFile = "physical_parameter.json"
+	calculatorFile        = "config.ini"
+)
+
+var confDir = ResolveDir("")
+
+// 根据命令行参数和环境变量确定配置目录
+func ResolveDir(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if dir := os.Getenv(EnvConfDir); dir != "" {
+		return dir
+	}
+	return DefaultConfDir
+}
+
+// 设置配置目录并校验其中的配置文件，任何一个文件缺失或解析失败都会返回错误
+func Init(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("配置目录 %s 无法解析: %v", dir, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return fmt.Errorf("配置目录 %s 不存在，请通过 -conf 参数或环境变量 %s 指定: %v", abs, EnvConfDir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("配置路径 %s 不是目录", abs)
+	}
+	confDir = abs
+	return Validate()
+}
+
+// 校验当前配置目录下的所有配置文件
+func Validate() error {
+	var caster model.Caster
+	if err := loadJson(CasterFile(DefaultCaster), &caster); err != nil {
+		return err
+	}
+	var nozzleCfg model.NozzleCfg
+	if err := loadJson(NozzleFile(), &nozzleCfg); err != nil {
+		return err
+	}
+	var phaseTemperature []model.PhaseTemperature
+	if err := loadJson(PhaseTemperatureFile(), &phaseTemperature); err != nil {
+		return err
+	}
+	if len(phaseTemperature) == 0 {
+		return fmt.Errorf("配置文件 %s 中没有固液相线温度数据", PhaseTemperatureFile())
+	}
+	var physicalParameter []model.PhysicalParameter
+	if err := loadJson(PhysicalParameterFile(), &physicalParameter); err != nil {
+		return err
+	}
+	if len(physicalParameter) == 0 {
+		return fmt.Errorf("配置文件 %s 中没有物性参数数据", PhysicalParameterFile())
+	}
+	if _, err := ini.Load(CalculatorFile()); err != nil {
+		return fmt.Errorf("配置文件 %s 读取失败: %v", CalculatorFile(), err)
+	}
+	return nil
+}
+
+func loadJson(fileName string, v interface{}) error {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("配置文件 %s 读取失败: %v", fileName, err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("配置文件 %s 解析失败: %v", fileName, err)
+	}
+	return nil
+}
+
+// 配置目录
+func Dir() string {
+	return confDir
+}
+
+// 铸机配置文件，name 为不带扩展名的铸机名称
+func CasterFile(name string) string {
+	return filepath.Join(confDir, name+".json")
+}
+
+// 校验铸机名称，防止通过名称访问配置目录以外的文件
+func CheckCasterName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.Contains(name, "..") {
+		return errors.New("非法的铸机名称: " + name)
+	}
+	return nil
+}
+
+// 离线计算默认使用的计算环境参数文件
+func EnvFile() string {
+	return filepath.Join(confDir, envFile)
+}
+
+func NozzleFile() string {
+	return filepath.Join(confDir, nozzleFile)
+}
+
+func PhaseTemperatureFile() string {
+	return filepath.Join(confDir, phaseTemperatureFile)
+}
+
+func PhysicalParameterFile() string {
+	return filepath.Join(confDir, physicalParameterFile)
+}
+
+func CalculatorFile() string {
+	return filepath.Join(confDir, calculatorFile)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	if err := Init("../conf"); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(Dir()) != "conf" || !filepath.IsAbs(Dir()) {
+		t.Fatal("配置目录错误:", Dir())
+	}
+	if NozzleFile() != filepath.Join(Dir(), "nozzle.json") {
+		t.Fatal(NozzleFile())
+	}
+	if EnvFile() != filepath.Join(Dir(), "env.json") {
+		t.Fatal(EnvFile())
+	}
+}
+
+func TestInitMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = Init(filepath.Join(dir, "not_exist")); err == nil {
+		t.Fatal("配置目录不存在时应返回错误")
+	}
+	// 只有铸机配置，缺少其它配置文件
+	data, _ := ioutil.ReadFile("../conf/caster.json")
+	_ = ioutil.WriteFile(filepath.Join(dir, "caster.json"), data, 0644)
+	err = Init(dir)
+	if err == nil || !strings.Contains(err.Error(), "nozzle.json") {
+		t.Fatal("缺少 nozzle.json 时应返回错误:", err)
+	}
+	// 文件存在但无法解析
+	_ = ioutil.WriteFile(filepath.Join(dir, "nozzle.json"), []byte("{"), 0644)
+	err = Init(dir)
+	if err == nil || !strings.Contains(err.Error(), "解析失败") {
+		t.Fatal("nozzle.json 解析失败时应返回错误:", err)
+	}
+}
+
+func TestResolveDir(t *testing.T) {
+	_ = os.Setenv(EnvConfDir, "/opt/lz/conf")
+	defer os.Unsetenv(EnvConfDir)
+	if ResolveDir("flag_dir") != "flag_dir" {
+		t.Fatal("命令行参数优先")
+	}
+	if ResolveDir("") != "/opt/lz/conf" {
+		t.Fatal("其次使用环境变量")
+	}
+	_ = os.Unsetenv(EnvConfDir)
+	if ResolveDir("") != DefaultConfDir {
+		t.Fatal("默认目录")
+	}
+}
+
+func TestCheckCasterName(t *testing.T) {
+	if err := CheckCasterName("caster"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "../caster", "a/b", ".."} {
+		if CheckCasterName(name) == nil {
+			t.Fatal("非法名称未被拒绝:", name)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"lz/model"
+)
+
+// 读取离线计算的环境参数，以 caster.json 中的铸机尺寸和冷却分区为准，env 文件中未配置的冷却参数使用铸机配置中的默认水量
+func LoadEnv(casterFile, envFile string) (model.Env, error) {
+	var env model.Env
+	data, err := ioutil.ReadFile(envFile)
+	if err != nil {
+		return env, err
+	}
+	if err = json.Unmarshal(data, &env); err != nil {
+		return env, err
+	}
+
+	data, err = ioutil.ReadFile(casterFile)
+	if err != nil {
+		return env, err
+	}
+	var caster model.Caster
+	if err = json.Unmarshal(data, &caster); err != nil {
+		return env, err
+	}
+	env.Coordinate = caster.Coordinate.ToCoordinate()
+	if env.LevelHeight == 0 {
+		env.LevelHeight = caster.Coordinate.LevelHeight
+	}
+	if len(env.CoolingZoneCfg) == 0 {
+		for _, zone := range caster.CoolingZone {
+			env.CoolingZoneCfg = append(env.CoolingZoneCfg, model.CoolingZone{
+				ZoneName: zone.ZoneName,
+				Start:    zone.Start,
+				End:      zone.End,
+				Medium:   zone.Medium,
+			})
+		}
+	}
+	if len(env.SecondaryCoolingWaterCfg) == 0 {
+		for _, zone := range caster.CoolingZone {
+			env.SecondaryCoolingWaterCfg = append(env.SecondaryCoolingWaterCfg, model.SecondaryCoolingWaterSection{
+				SprayWaterTemperature: zone.SprayWaterTemperature,
+				InnerArcWaterVolume:   zone.InnerArcVolume,
+				OuterArcWaterVolume:   zone.OuterArcVolume,
+				NarrowSideWaterVolume: zone.NarrowSideVolume,
+				Fuqie1Volume:          zone.Fuqie1Volume,
+				Fuqie2Volume:          zone.Fuqie2Volume,
+			})
+		}
+	}
+	if len(env.WaterTables) == 0 {
+		env.WaterTables = caster.WaterTables
+	}
+	if len(env.Segments) == 0 {
+		env.Segments = caster.Segments
+	}
+	return env, nil
+}
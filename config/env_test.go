@@ -0,0 +1,36 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, "env.json")
+	if err = ioutil.WriteFile(envFile, []byte(`{"steel_value": 3, "drag_speed": 1.2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env, err := LoadEnv("../conf/caster.json", envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Coordinate.ZLength != 31860 || env.Coordinate.MdLength != 950 || env.LevelHeight != 100 {
+		t.Fatal("铸机尺寸未从 caster.json 读取:", env.Coordinate)
+	}
+	if len(env.CoolingZoneCfg) != 11 || len(env.SecondaryCoolingWaterCfg) != 11 {
+		t.Fatal("冷却分区数量错误:", len(env.CoolingZoneCfg), len(env.SecondaryCoolingWaterCfg))
+	}
+	if len(env.Segments) == 0 || env.Segments[1].Seg != "Seg_0" {
+		t.Fatal("扇形段未从 caster.json 读取:", env.Segments)
+	}
+	if env.SecondaryCoolingWaterCfg[0].InnerArcWaterVolume != 111.5 {
+		t.Fatal("默认水量错误:", env.SecondaryCoolingWaterCfg[0])
+	}
+}
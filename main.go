@@ -1,7 +1,11 @@
 package main
 
 import (
+	"flag"
 	"github.com/gorilla/websocket"
+	"log"
+	"lz/calculator"
+	"lz/config"
 	"lz/server"
 	"net/http"
 )
@@ -11,7 +15,24 @@ var upgrader = websocket.Upgrader{
 	WriteBufferSize: 1024,
 }
 
+var resumeTimeout = flag.Duration("resume-timeout", server.ResumeTimeout, "连接断开后保留计算等待恢复的时间")
+
+var confDir = flag.String("conf", "", "配置文件目录，默认读取环境变量 "+config.EnvConfDir+"，未设置时为 ./"+config.DefaultConfDir)
+
 func main() {
+	flag.Parse()
+	if err := config.Init(config.ResolveDir(*confDir)); err != nil {
+		log.Fatal("配置校验失败: ", err)
+	}
+	if err := calculator.LoadCfg(config.CalculatorFile()); err != nil {
+		log.Fatal("计算器参数读取失败: ", err)
+	}
+	if err := calculator.LoadSteelLibrary(config.PhaseTemperatureFile(), config.PhysicalParameterFile()); err != nil {
+		log.Fatal("钢种库加载失败: ", err)
+	}
+	log.Println("配置目录: ", config.Dir())
+
+	server.ResumeTimeout = *resumeTimeout
 	upgrader.CheckOrigin = func(r *http.Request) bool {
 		return true
 	}
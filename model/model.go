@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type Env struct {
 	LevelHeight              float32                        `json:"level_height"`
 	SteelValue               int                            `json:"steel_value"`
@@ -9,6 +11,9 @@ type Env struct {
 	Coordinate               Coordinate                     `json:"coordinate"`
 	SecondaryCoolingWaterCfg []SecondaryCoolingWaterSection `json:"secondary_cooling_water_cfg"`
 	CoolingZoneCfg           []CoolingZone                  `json:"cooling_zone_cfg"`
+	SectionMode              string                         `json:"section_mode"`           // 计算断面：quarter 或 half，为空时使用 config.ini 中的配置
+	WaterTables              []ZoneWaterTable               `json:"water_tables,omitempty"` // 二冷区水表，拉速变化时自动设置二冷水量
+	Segments                 []Segment                      `json:"segments,omitempty"`     // 扇形段，用于轻压下建议
 }
 
 // 铸机尺寸配置
@@ -28,6 +33,106 @@ type Coordinate struct {
 	YScale              int     `json:"y_scale"`
 }
 
+// 铸机配置文件结构，对应 conf/caster.json
+type Caster struct {
+	Coordinate  CasterCoordinate    `json:"coordinate"`
+	CoolingZone []CasterCoolingZone `json:"cooling_zone"`
+	Segments    []Segment           `json:"segments"`
+	WaterTables []ZoneWaterTable    `json:"water_tables,omitempty"` // 二冷区水表
+}
+
+// caster.json 中的铸机尺寸，数值均为浮点数
+type CasterCoordinate struct {
+	R                   float32 `json:"r"`
+	LevelHeight         float32 `json:"level_height"`
+	ArcStartDistance    float32 `json:"arc_start_distance"`
+	ArcEndDistance      float32 `json:"arc_end_distance"`
+	CenterStartDistance float32 `json:"center_start_distance"`
+	CenterEndDistance   float32 `json:"center_end_distance"`
+	MdLength            float32 `json:"md_length"`
+	Width               float32 `json:"width"`
+	Length              float32 `json:"length"`
+	ZLength             float32 `json:"z_length"`
+	ZScale              float32 `json:"z_scale"`
+	XScale              float32 `json:"x_scale"`
+	YScale              float32 `json:"y_scale"`
+}
+
+// 转换为计算使用的铸机尺寸配置
+func (c CasterCoordinate) ToCoordinate() Coordinate {
+	return Coordinate{
+		R:                   c.R,
+		LevelHeight:         c.LevelHeight,
+		ArcStartDistance:    c.ArcStartDistance,
+		ArcEndDistance:      c.ArcEndDistance,
+		CenterStartDistance: c.CenterStartDistance,
+		CenterEndDistance:   c.CenterEndDistance,
+		MdLength:            int(c.MdLength),
+		Width:               int(c.Width),
+		Length:              int(c.Length),
+		ZLength:             int(c.ZLength),
+		ZScale:              int(c.ZScale),
+		XScale:              int(c.XScale),
+		YScale:              int(c.YScale),
+	}
+}
+
+// caster.json 中的冷却区配置，包含分区及默认水量
+type CasterCoolingZone struct {
+	ZoneName              string   `json:"zone_name"`
+	Start                 int      `json:"start"`
+	End                   int      `json:"end"`
+	Medium                int      `json:"medium"`
+	InnerArcVolume        float32  `json:"inner_arc_volume"`
+	OuterArcVolume        *float32 `json:"outer_arc_volume,omitempty"` // 未设置时与内弧水量相同
+	NarrowSideVolume      float32  `json:"narrow_side_volume"`
+	SprayWaterTemperature float32  `json:"spray_water_temperature"`
+	Fuqie1Volume          float32  `json:"fuqie_1_volume"`
+	Fuqie2Volume          float32  `json:"fuqie_2_volume"`
+}
+
+// 扇形段，Start、End 为辊子编号
+type Segment struct {
+	Seg   string `json:"seg"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// 轻压下的中心固相率窗口，中心固相率处于 [Start, End] 内的扇形段应投入轻压下
+type SoftReductionWindow struct {
+	Start float32 `json:"start"`
+	End   float32 `json:"end"`
+}
+
+// 冷却区表面温度的报警上下限，为 0 时不检查
+type ZoneTemperatureLimit struct {
+	Zone int     `json:"zone"` // 冷却区编号，从 1 开始
+	Min  float32 `json:"min"`  // 表面温度下限 ℃
+	Max  float32 `json:"max"`  // 表面温度上限 ℃
+}
+
+// 报警规则，数值为 0 的规则不检查
+type AlarmRules struct {
+	ZoneTemperature      []ZoneTemperatureLimit `json:"zone_temperature"`      // 各冷却区内弧宽面中心的表面温度上下限
+	MaxReheatRate        float32                `json:"max_reheat_rate"`       // 二冷区表面回温速率上限 ℃/m
+	MinMoldExitShell     float32                `json:"min_mold_exit_shell"`   // 结晶器出口坯壳厚度下限 mm
+	StraightenerDistance float32                `json:"straightener_distance"` // 矫直点距弯月面的距离 mm，凝固末端超过该位置时报警
+	CutoffDistance       float32                `json:"cutoff_distance"`       // 切割点距弯月面的距离 mm，凝固末端超过该位置时报警
+}
+
+// 报警事件，同一报警的产生和恢复各对应一个事件
+type Alarm struct {
+	Key     string    `json:"key"`            // 报警标识，规则名称加冷却区编号，同一报警产生和恢复时相同
+	Rule    string    `json:"rule"`           // 规则名称
+	Zone    int       `json:"zone,omitempty"` // 冷却区编号，与冷却区无关的规则为 0
+	State   string    `json:"state"`          // raise 产生，clear 恢复
+	Value   float32   `json:"value"`          // 触发或恢复时的实际值
+	Limit   float32   `json:"limit"`          // 规则的限值
+	Message string    `json:"message"`
+	Time    float64   `json:"time"` // 模拟时间 s
+	At      time.Time `json:"at"`   // 发生时刻
+}
+
 // 冷却区分区配置
 type CoolingZone struct {
 	ZoneName    string  `json:"zone_name"`
@@ -61,18 +166,85 @@ type WideSurface struct {
 	Volume float32 `json:"volume"`
 }
 
+// 水表适用的拉速范围 m/min，Top、Bottom 均为 0 时不限制；Step 为拉速的量化步长，拉速按该步长取整后再查水表，为 0 时不取整
 type Speed2Water struct {
 	Top    float32 `json:"top"`
 	Bottom float32 `json:"bottom"`
 	Step   float32 `json:"step"`
 }
 
+// 水量随拉速变化的曲线，水量单位与 SecondaryCoolingWaterSection 相同
+type WaterCurve struct {
+	Type   string       `json:"type"`             // quadratic 或 piecewise_linear
+	Coef   [3]float32   `json:"coef,omitempty"`   // 二次曲线 a*v^2 + b*v + c 的系数 [a, b, c]
+	Points [][2]float32 `json:"points,omitempty"` // 分段线性曲线的拐点 [拉速, 水量]，拉速升序
+}
+
+// 一个冷却区的水表，拉速变化时按水表重新设置该区的二冷水量
+type ZoneWaterTable struct {
+	Zone       int         `json:"zone"` // 冷却区编号，从 1 开始
+	Speed      Speed2Water `json:"speed"`
+	InnerArc   WaterCurve  `json:"inner_arc"`
+	OuterArc   *WaterCurve `json:"outer_arc,omitempty"`   // 未设置时外弧水量与内弧相同
+	NarrowSide *WaterCurve `json:"narrow_side,omitempty"` // 未设置时窄面水量不随拉速变化
+}
+
+// 二冷动态控制中一个冷却区的目标表面温度和内弧水量的调节范围
+type ZoneControl struct {
+	Zone     int     `json:"zone"`      // 冷却区编号，从 1 开始
+	Target   float32 `json:"target"`    // 目标表面温度 ℃
+	MinWater float32 `json:"min_water"` // 水量下限
+	MaxWater float32 `json:"max_water"` // 水量上限
+}
+
+// 二冷动态控制配置，按 PID 调节各冷却区的水量使内弧宽面平均温度接近目标温度
+type DynamicControl struct {
+	Enabled bool          `json:"enabled"`
+	Kp      float32       `json:"kp"`     // 比例系数，水量/℃
+	Ki      float32       `json:"ki"`     // 积分系数，水量/(℃·s)
+	Kd      float32       `json:"kd"`     // 微分系数，水量·s/℃
+	Period  float32       `json:"period"` // 控制周期 s（模拟时间），为 0 时使用默认值
+	Zones   []ZoneControl `json:"zones"`
+}
+
+// 一次控制动作
+type ControlAction struct {
+	Time        float64 `json:"time"`        // 模拟时间 s
+	Zone        int     `json:"zone"`        // 冷却区编号
+	Temperature float32 `json:"temperature"` // 冷却区内弧宽面的平均温度 ℃
+	Target      float32 `json:"target"`      // 目标温度 ℃
+	PreWater    float32 `json:"pre_water"`   // 调节前的内弧水量
+	Water       float32 `json:"water"`       // 调节后的内弧水量
+}
+
+// 水量优化中单个冷却区的水量范围
+type ZoneWaterLimit struct {
+	Zone     int     `json:"zone"`      // 冷却区编号，从 1 开始
+	MinWater float32 `json:"min_water"` // 内弧水量下限
+	MaxWater float32 `json:"max_water"` // 内弧水量上限，必须大于 0
+}
+
+// 离线水量优化配置，寻找使内弧宽面中心的表面温度接近目标曲线的各冷却区水量
+type WaterOptimization struct {
+	Target        [][2]float32     `json:"target"`          // 目标表面温度曲线，每个点为 [距弯月面的距离 mm, 温度 ℃]，距离严格递增，点之间线性插值
+	MaxReheatRate float32          `json:"max_reheat_rate"` // 表面回温速率上限 ℃/m，为 0 时不限制
+	Zones         []ZoneWaterLimit `json:"zones"`           // 参与优化的冷却区及其水量范围，未列出的冷却区水量不变
+	MaxIterations int              `json:"max_iterations"`  // 最大迭代次数，为 0 时使用默认值
+	Tolerance     float32          `json:"tolerance"`       // 各冷却区的平均偏差都小于该值时结束 ℃，为 0 时使用默认值
+}
+
 // 纵切面云图请求结构体
 type VerticalReqData struct {
 	Index  int `json:"index"`
 	ZScale int `json:"z_scale"`
 }
 
+// 浇铸过程中更换钢种
+type ChangeSteel struct {
+	SteelValue   int     `json:"steel_value"`
+	MixingLength float32 `json:"mixing_length"` // 混浇长度 mm，为 0 时使用默认值
+}
+
 // 物性参数
 type PhysicalParameter struct {
 	Id                  int       `json:"id"`
@@ -121,8 +293,7 @@ type CoolerCfg struct {
 	WideWaterVolume float32 // 宽面水量
 	// 结晶器冷却参数配置 ---- end
 
-	// todo 暂时未用到
-	TargetTemperature map[string]float32 // 每个冷却区的目标温度
+	TargetTemperature map[string]float32 // 二冷动态控制时每个冷却区的目标表面温度，键为冷却区名称
 
 	V int64 // 拉速
 
@@ -137,11 +308,20 @@ type SecondaryCoolingZoneCfg struct {
 }
 
 type SecondaryCoolingWaterSection struct {
-	SprayWaterTemperature float32 `json:"spray_water_temperature"`
-	InnerArcWaterVolume   float32 `json:"inner_arc_water_volume"`
-	NarrowSideWaterVolume float32 `json:"narrow_side_water_volume"`
-	Fuqie1Volume          float32 `json:"fuqie_1_volume"`
-	Fuqie2Volume          float32 `json:"fuqie_2_volume"`
+	SprayWaterTemperature float32  `json:"spray_water_temperature"`
+	InnerArcWaterVolume   float32  `json:"inner_arc_water_volume"`
+	OuterArcWaterVolume   *float32 `json:"outer_arc_water_volume,omitempty"` // 未设置时与内弧水量相同
+	NarrowSideWaterVolume float32  `json:"narrow_side_water_volume"`
+	Fuqie1Volume          float32  `json:"fuqie_1_volume"`
+	Fuqie2Volume          float32  `json:"fuqie_2_volume"`
+}
+
+// 外弧水量，未设置时与内弧水量相同
+func (s SecondaryCoolingWaterSection) OuterArcVolume() float32 {
+	if s.OuterArcWaterVolume == nil {
+		return s.InnerArcWaterVolume
+	}
+	return *s.OuterArcWaterVolume
 }
 
 // 喷嘴布置配置
@@ -186,21 +366,50 @@ type NarrowSection struct {
 	Thickness float32 `json:"thickness"`
 }
 
+// 前后端通信协议版本，服务端发送的消息都带有版本号
+const ProtocolVersion = 1
+
 // 前后端通信消息结构
+//
+// 请求带有 request_id 时，对该请求的确认或错误回复带有相同的 request_id，周期性推送的消息不带 request_id。
+// 旧版本客户端只使用 type 和 content，新增字段都可以省略。
 type Msg struct {
-	Type    string `json:"type"`
-	Content string `json:"content"`
+	Version   int       `json:"version,omitempty"`    // 协议版本
+	RequestID string    `json:"request_id,omitempty"` // 请求编号，由客户端生成
+	Type      string    `json:"type"`
+	Content   string    `json:"content"`
+	Error     *MsgError `json:"error,omitempty"` // 仅 type 为 error 时有效
+
+	ResumeToken string `json:"resume_token,omitempty"` // env_set 和 started 回复中的恢复令牌，连接断开后用 resume 请求恢复会话
+}
+
+// 请求失败的原因
+type MsgError struct {
+	Type    string `json:"type"`    // 错误类型
+	Message string `json:"message"` // 错误信息
 }
 
+// 错误类型
+const (
+	ErrBadRequest         = "bad_request"         // 消息或请求内容无法解析，或参数超出范围
+	ErrUnknownType        = "unknown_type"        // 不支持的请求类型
+	ErrUnsupportedVersion = "unsupported_version" // 不支持的协议版本
+	ErrEnvNotSet          = "env_not_set"         // 计算环境未设置
+	ErrRejected           = "rejected"            // 请求内容合法，但计算器拒绝执行
+	ErrInternal           = "internal"            // 服务端内部错误
+	ErrForbidden          = "forbidden"           // 只读客户端没有会话控制权
+	ErrNotFound           = "not_found"           // 会话或 HTTP 接口不存在
+)
+
 const (
 	XStep  = 5
 	YStep  = 5
 	ZStep  = 10
 	Length = 2700 / 2 // 最大宽面长度
-	Width  = 420 / 2  // 最大窄面长度
+	Width  = 460 / 2  // 最大窄面长度，半断面计算时为最大铸坯厚度
 
-	// 存放热流密度和综合换热系数容器的元素最大长度
-	WL = Length/XStep + Width/YStep
+	// 存放热流密度和综合换热系数容器的元素最大长度：内弧宽面、窄面、外弧宽面
+	WL = Length/XStep*2 + Width/YStep
 )
 
 // 元素类型
@@ -1,17 +1,19 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"lz/calculator"
+	"lz/config"
 	"lz/model"
 	"os"
 	"strconv"
 	"sync"
-	"time"
 )
 
 func initLog() {
@@ -21,491 +23,939 @@ func initLog() {
 	log.SetLevel(log.DebugLevel)
 }
 
+// 解析后的请求，id 为客户端的请求编号，payload 为请求内容，回复时带上 id
+type request struct {
+	id      string
+	payload interface{}
+	session *Session // 发出请求时客户端所在的会话，请求作用于该会话的计算器
+}
+
+// 请求所在会话的计算器
+func (r request) c() calculator.Calculator {
+	return r.session.calculator()
+}
+
+// 需要先设置计算环境才能处理的请求
+var requireEnv = map[string]bool{
+	"change_initial_temp":       true,
+	"change_narrow_surface":     true,
+	"change_wide_surface":       true,
+	"change_v":                  true,
+	"start":                     true,
+	"stop":                      true,
+	"tail":                      true,
+	"start_push_slice_detail":   true,
+	"stop_push_slice_detail":    true,
+	"generate_slice":            true,
+	"generate_vertical_slice1":  true,
+	"generate_vertical_slice2":  true,
+	"change_steel":              true,
+	"steady_state":              true,
+	"change_solver":             true,
+	"change_axial_conduction":   true,
+	"set_water_tables":          true,
+	"get_water_tables":          true,
+	"set_dynamic_control":       true,
+	"get_solidification_end":    true,
+	"get_shell_profile":         true,
+	"set_soft_reduction_window": true,
+	"get_soft_reduction":        true,
+	"set_alarm_rules":           true,
+	"get_alarms":                true,
+}
+
+// 需要持有会话控制权才能执行的请求，其余请求只读客户端也可以执行
+var requireControl = map[string]bool{
+	"env":                       true,
+	"change_initial_temp":       true,
+	"change_narrow_surface":     true,
+	"change_wide_surface":       true,
+	"change_v":                  true,
+	"start":                     true,
+	"stop":                      true,
+	"tail":                      true,
+	"start_push_slice_detail":   true,
+	"stop_push_slice_detail":    true,
+	"generate":                  true,
+	"change_steel":              true,
+	"steady_state":              true,
+	"change_solver":             true,
+	"change_axial_conduction":   true,
+	"set_water_tables":          true,
+	"set_dynamic_control":       true,
+	"set_soft_reduction_window": true,
+	"set_alarm_rules":           true,
+	"close_session":             true,
+}
+
 // Hub maintains the set of active clients and broadcasts messages to the clients.
 type Hub struct {
-	c    calculator.Calculator
-	conn *websocket.Conn
+	// 当前所在的会话，连接建立时为私有会话，只在 handleRequest 协程和 close 中修改
+	session  *Session
+	sessions *SessionManager // 为空时不支持共享会话
+	conn     *websocket.Conn
+	// 温度场推送的二进制编码，为 0 时推送 json，由 set_push_format 请求协商，读写时持有 mu
+	pushEncoding calculator.FrameEncoding
 	// request
 	msg chan model.Msg
 	// response
-	selectCaster         chan string
-	envSet               chan model.Env
-	changeInitialTemp    chan float32
-	changeNarrowSurface  chan model.NarrowSurface
-	changeWideSurface    chan model.WideSurface
-	changeV              chan float32
-	started              chan struct{}
-	stopped              chan struct{}
-	tailStart            chan struct{} // 拉尾坯
-	startPushSliceDetail chan int
-	stopPushSliceDetail  chan struct{}
-
-	generate      chan struct{}
-	generateSlice chan int
-
-	generateVerticalSlice1 chan struct{}
-	generateVerticalSlice2 chan model.VerticalReqData
+	selectCaster         chan request
+	envSet               chan request
+	changeInitialTemp    chan request
+	changeNarrowSurface  chan request
+	changeWideSurface    chan request
+	changeV              chan request
+	started              chan request
+	stopped              chan request
+	tailStart            chan request // 拉尾坯
+	startPushSliceDetail chan request
+	stopPushSliceDetail  chan request
+
+	generate      chan request
+	generateSlice chan request
+
+	generateVerticalSlice1 chan request
+	generateVerticalSlice2 chan request
+
+	listSteels   chan request
+	changeSteel  chan request
+	steadyState  chan request
+	changeSolver chan request
+	changeAxial  chan request
+
+	setWaterTables chan request
+	getWaterTables chan request
+
+	setDynamicControl chan request
+
+	getSolidificationEnd chan request
+	getShellProfile      chan request
+
+	setReductionWindow chan request
+	getSoftReduction   chan request
+
+	setAlarmRules chan request
+	getAlarms     chan request
 
 	mu sync.Mutex
+
+	// 本连接开启的切片详情推送，离开会话或连接断开时停止，开启和停止时持有 sliceMu
+	sliceMu     sync.Mutex
+	sliceDetail *sliceDetailPush
+
+	// 连接断开时取消，handleRequest 和 handleResponse 随之退出
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 func NewHub() *Hub {
 	initLog()
-	return &Hub{
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &Hub{
+		ctx:     ctx,
+		cancel:  cancel,
+		session: newSession(""),
+
 		msg:                  make(chan model.Msg, 10),
-		selectCaster:         make(chan string, 10),
-		envSet:               make(chan model.Env, 10),
-		changeInitialTemp:    make(chan float32, 10),
-		changeNarrowSurface:  make(chan model.NarrowSurface, 10),
-		changeWideSurface:    make(chan model.WideSurface, 10),
-		changeV:              make(chan float32, 10),
-		started:              make(chan struct{}, 10),
-		stopped:              make(chan struct{}, 10),
-		tailStart:            make(chan struct{}, 10),
-		startPushSliceDetail: make(chan int, 10),
-		stopPushSliceDetail:  make(chan struct{}, 10),
-
-		generate:      make(chan struct{}, 10),
-		generateSlice: make(chan int, 10),
-
-		generateVerticalSlice1: make(chan struct{}, 10),
-		generateVerticalSlice2: make(chan model.VerticalReqData, 10),
+		selectCaster:         make(chan request, 10),
+		envSet:               make(chan request, 10),
+		changeInitialTemp:    make(chan request, 10),
+		changeNarrowSurface:  make(chan request, 10),
+		changeWideSurface:    make(chan request, 10),
+		changeV:              make(chan request, 10),
+		started:              make(chan request, 10),
+		stopped:              make(chan request, 10),
+		tailStart:            make(chan request, 10),
+		startPushSliceDetail: make(chan request, 10),
+		stopPushSliceDetail:  make(chan request, 10),
+
+		generate:      make(chan request, 10),
+		generateSlice: make(chan request, 10),
+
+		generateVerticalSlice1: make(chan request, 10),
+		generateVerticalSlice2: make(chan request, 10),
+
+		listSteels:   make(chan request, 10),
+		changeSteel:  make(chan request, 10),
+		steadyState:  make(chan request, 10),
+		changeSolver: make(chan request, 10),
+		changeAxial:  make(chan request, 10),
+
+		setWaterTables: make(chan request, 10),
+		getWaterTables: make(chan request, 10),
+
+		setDynamicControl: make(chan request, 10),
+
+		getSolidificationEnd: make(chan request, 10),
+		getShellProfile:      make(chan request, 10),
+
+		setReductionWindow: make(chan request, 10),
+		getSoftReduction:   make(chan request, 10),
+
+		setAlarmRules: make(chan request, 10),
+		getAlarms:     make(chan request, 10),
+	}
+	_ = h.session.join(h)
+	return h
+}
+
+// 启动请求处理协程
+func (h *Hub) start() {
+	h.wg.Add(2)
+	go h.handleRequest()
+	go h.handleResponse()
+}
+
+// 连接断开后关闭 hub：等待请求处理协程退出，再离开会话。私有会话的计算器随之关闭，命名会话继续计算
+func (h *Hub) close() {
+	h.cancel()
+	h.wg.Wait()
+	h.leaveSession()
+	log.Info("连接已关闭")
+}
+
+// 离开当前会话，私有会话可以恢复时保留等待恢复，否则直接关闭；命名会话通知其他客户端
+func (h *Hub) leaveSession() {
+	h.stopSliceDetail()
+	s := h.session
+	s.leave(h)
+	if s.name == "" {
+		if h.sessions != nil && s.resumable() {
+			h.sessions.park(s)
+			return
+		}
+		s.close()
+		return
+	}
+	log.WithField("session", s.name).Info("离开会话")
+	s.notify("session_info")
+}
+
+// 加入名为 name 的命名会话，先离开当前会话
+func (h *Hub) attachSession(name string) (*Session, error) {
+	if h.sessions == nil {
+		return nil, errors.New("服务端不支持共享会话")
+	}
+	if h.session.name == name {
+		return h.session, nil
+	}
+	s, err := h.sessions.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = h.switchSession(s); err != nil {
+		return nil, err
+	}
+	log.WithField("session", name).Info("加入会话")
+	return s, nil
+}
+
+// 用恢复令牌重新进入断开前的会话
+func (h *Hub) resumeSession(token string) (*Session, error) {
+	if h.sessions == nil {
+		return nil, errors.New("服务端不支持恢复连接")
+	}
+	s, err := h.sessions.lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	if s == h.session {
+		return s, nil
+	}
+	if err = h.switchSession(s); err != nil {
+		return nil, err
 	}
+	log.WithFields(log.Fields{"session": s.name, "token": token}).Info("恢复会话")
+	return s, nil
+}
+
+// 离开当前会话并加入 s
+func (h *Hub) switchSession(s *Session) error {
+	h.leaveSession()
+	if err := s.join(h); err != nil {
+		// 会话刚被关闭，回到私有会话
+		h.session = newSession("")
+		_ = h.session.join(h)
+		return err
+	}
+	h.session = s
+	if s.name != "" {
+		s.notify("session_info")
+	}
+	return nil
+}
+
+// 离开命名会话，回到一个新的私有会话
+func (h *Hub) detachSession() {
+	h.leaveSession()
+	h.session = newSession("")
+	_ = h.session.join(h)
 }
 
 func (h *Hub) handleResponse() {
 	defer func() {
 		log.Info("停止handleResponse")
+		h.wg.Done()
 	}()
-	for {
-		select {
-		case fileName := <-h.selectCaster:
-			data, err := ioutil.ReadFile(fileName)
-			if err != nil {
-				log.Println("err", err)
-				return
-			}
-			reply := model.Msg{
-				Type:    "caster_info",
-				Content: string(data),
-			}
-			h.mu.Lock()
-			err = h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case env := <-h.envSet: // 设置计算环境
-			if h.c == nil {
-				// 初始化铸坯尺寸
-				calculator.ZLength = env.Coordinate.ZLength
-				calculator.Length = env.Coordinate.Length / 2
-				calculator.Width = env.Coordinate.Width / 2
-				log.Info("ZLength:", calculator.ZLength, " ,Length:", calculator.Length, " ,Width:", calculator.Width)
-				h.c = calculator.NewCalculatorWithArrDeque(nil)
-			}
-			h.c.GetCastingMachine().SetFromJson(env.Coordinate) // 初始化铸机尺寸
-			data, err := ioutil.ReadFile("E:/GoWorkPlace/src/lz/conf/nozzle.json")
-			if err != nil {
-				log.Println("err", err)
-				return
-			}
-			h.c.GetCastingMachine().SetCoolerConfig(env, data)     // 设置冷却参数
-			h.c.GetCastingMachine().SetV(env.DragSpeed)            // 设置拉速
-			h.c.InitSteel(env.SteelValue, h.c.GetCastingMachine()) // 设置钢种物性参数
-			h.c.InitPushData(env.Coordinate)
-			reply := model.Msg{
-				Type:    "env_set",
-				Content: "env is set",
-			}
-			h.mu.Lock()
-			err = h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case temp := <-h.changeInitialTemp:
-			h.c.GetCastingMachine().SetStartTemperature(temp)
-			reply := model.Msg{
-				Type:    "initial_temp_set",
-				Content: "initial_temp_set",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case narrowSurface := <-h.changeNarrowSurface:
-			h.c.GetCastingMachine().SetNarrowSurfaceIn(narrowSurface.In)
-			h.c.GetCastingMachine().SetNarrowSurfaceOut(narrowSurface.Out)
-			reply := model.Msg{
-				Type:    "narrow_surface_temp_set",
-				Content: "narrow_surface_temp_set",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case wideSurface := <-h.changeWideSurface:
-			h.c.GetCastingMachine().SetWideSurfaceIn(wideSurface.In)
-			h.c.GetCastingMachine().SetWideSurfaceOut(wideSurface.Out)
-			reply := model.Msg{
-				Type:    "wide_surface_temp_set",
-				Content: "wide_surface_temp_set",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case v := <-h.changeV:
-			h.c.GetCastingMachine().SetV(v)
-			reply := model.Msg{
-				Type:    "v_set",
-				Content: "v_set",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case <-h.started: // 开始计算
-			// 从calculator里面的hub中获取是否有
-			h.c.GetCalcHub().StartSignal()
-			go h.c.Run()    // 不断计算
-			go h.pushData() // 获取推送的计算结果到前端
-			reply := model.Msg{
-				Type:    "started",
-				Content: "Started",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case <-h.stopped: // 停止计算
-			h.c.GetCalcHub().StopSignal()
-			reply := model.Msg{
-				Type:    "stopped",
-				Content: "stopped",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case <-h.tailStart: // 拉尾坯
-			h.c.SetStateTail()
-			reply := model.Msg{
-				Type:    "tail_start",
-				Content: "started to tail",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case index := <-h.startPushSliceDetail:
-			fmt.Println("startPushSliceDetail")
-			if h.c.GetCalcHub().PushSliceDetailRunning {
-				h.c.GetCalcHub().StopPushSliceDetail()
-			}
-			h.c.GetCalcHub().PushSliceDetailRunning = true
-			go h.c.GetCalcHub().SliceDetailRun()
-			go h.pushSliceDetail(index)
-			reply := model.Msg{
-				Type:    "start_push_slice_detail_success",
-				Content: "start_push_slice_detail_success",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case <-h.stopPushSliceDetail:
-			fmt.Println("stopPushSliceDetail")
-			if h.c.GetCalcHub().PushSliceDetailRunning {
-				h.c.GetCalcHub().StopPushSliceDetail()
-				h.c.GetCalcHub().PushSliceDetailRunning = false
-			}
-			reply := model.Msg{
-				Type:    "stop_push_slice_detail_success",
-				Content: "stop_push_slice_detail_success",
-			}
-			h.mu.Lock()
-			err := h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("回复消息失败")
-			}
-		case <-h.generate:
-			reply := model.Msg{
-				Type: "data_generate",
-			}
-			h.c = calculator.NewCalculatorForGenerate()
-			log.Info("初始化计算器")
-			temperatureData := h.c.GenerateResult()
-			log.Info("生成数据")
-			data, err := json.Marshal(temperatureData)
-			if err != nil {
-				log.WithField("err", err).Error("温度场推送数据json解析失败")
-				return
-			}
-			reply.Content = string(data)
-			h.mu.Lock()
-			err = h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("发送温度场推送消息失败")
-			}
-			fmt.Println("切片充满时传输100次需要的平均时间：", 4, "ms")
-			fmt.Println("切片充满时传输100次其中最长的一次传输时间：", 4.32, "ms")
-		case index := <-h.generateSlice:
-			reply := model.Msg{
-				Type: "slice_generated",
-			}
-			sliceData := h.c.GenerateSLiceInfo(index)
-			data, err := json.Marshal(sliceData)
-			if err != nil {
-				log.WithField("err", err).Error("温度场切片推送数据json解析失败")
-				return
-			}
-			reply.Content = string(data)
-			h.mu.Lock()
-			err = h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("发送温度场切片推送消息失败")
-			}
-		case <-h.generateVerticalSlice1:
-			reply := model.Msg{
-				Type: "vertical_slice1_generated",
-			}
-			verticalSliceData := h.c.GenerateVerticalSlice1Data()
-			data, err := json.Marshal(verticalSliceData)
-			if err != nil {
-				log.WithField("err", err).Error("纵向切片1推送数据json解析失败")
-				return
-			}
-			reply.Content = string(data)
-			h.mu.Lock()
-			err = h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("发送纵向切片1推送消息失败")
-			}
-		case reqData := <-h.generateVerticalSlice2:
-			reply := model.Msg{
-				Type: "vertical_slice2_generated",
-			}
-			verticalSliceData := h.c.GenerateVerticalSlice2Data(reqData)
-			data, err := json.Marshal(verticalSliceData)
-			if err != nil {
-				log.WithField("err", err).Error("纵向切片2推送数据json解析失败")
-				return
-			}
-			reply.Content = string(data)
-			h.mu.Lock()
-			err = h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("发送纵向切片2推送消息失败")
-			}
-		default:
-			time.Sleep(10 * time.Millisecond)
+	for h.respond() {
+	}
+}
+
+// 处理一个请求，处理过程中出现 panic 时回复错误，不影响后续请求。hub 关闭后返回 false
+func (h *Hub) respond() (open bool) {
+	open = true
+	var req request
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithField("panic", r).Error("处理请求失败")
+			h.replyError(req.id, model.ErrInternal, fmt.Errorf("处理请求失败: %v", r))
+		}
+	}()
+	select {
+	case req = <-h.selectCaster:
+		data, err := ioutil.ReadFile(req.payload.(string))
+		if err != nil {
+			h.replyError(req.id, model.ErrInternal, err)
+			break
+		}
+		h.reply(req.id, "caster_info", string(data))
+	case req = <-h.envSet: // 设置计算环境
+		if errType, err := req.session.setEnv(req.payload.(model.Env)); err != nil {
+			h.replyError(req.id, errType, err)
+			break
+		}
+		h.replyResumable(req, "env_set", "env is set")
+	case req = <-h.changeInitialTemp:
+		req.c().GetCastingMachine().SetStartTemperature(req.payload.(float32))
+		h.reply(req.id, "initial_temp_set", "initial_temp_set")
+	case req = <-h.changeNarrowSurface:
+		narrowSurface := req.payload.(model.NarrowSurface)
+		req.c().GetCastingMachine().SetNarrowSurfaceIn(narrowSurface.In)
+		req.c().GetCastingMachine().SetNarrowSurfaceOut(narrowSurface.Out)
+		h.reply(req.id, "narrow_surface_temp_set", "narrow_surface_temp_set")
+	case req = <-h.changeWideSurface:
+		wideSurface := req.payload.(model.WideSurface)
+		req.c().GetCastingMachine().SetWideSurfaceIn(wideSurface.In)
+		req.c().GetCastingMachine().SetWideSurfaceOut(wideSurface.Out)
+		h.reply(req.id, "wide_surface_temp_set", "wide_surface_temp_set")
+	case req = <-h.changeV:
+		if err := req.session.setSpeed(req.payload.(float32)); err != nil {
+			h.replyError(req.id, model.ErrEnvNotSet, err)
+			break
+		}
+		h.reply(req.id, "v_set", "v_set")
+	case req = <-h.started: // 开始计算
+		if err := req.session.start(); err != nil {
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.replyResumable(req, "started", "Started")
+	case req = <-h.stopped: // 停止计算
+		if err := req.session.stop(); err != nil {
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.reply(req.id, "stopped", "stopped")
+	case req = <-h.tailStart: // 拉尾坯
+		req.c().SetStateTail()
+		h.reply(req.id, "tail_start", "started to tail")
+	case req = <-h.startPushSliceDetail:
+		log.WithField("index", req.payload).Info("开始推送切片详情")
+		h.startSliceDetail(req.c(), req.payload.(int))
+		h.reply(req.id, "start_push_slice_detail_success", "start_push_slice_detail_success")
+	case req = <-h.stopPushSliceDetail:
+		log.Info("停止推送切片详情")
+		h.sliceMu.Lock()
+		if req.c().GetCalcHub().PushSliceDetailRunning {
+			req.c().GetCalcHub().StopPushSliceDetail()
+			req.c().GetCalcHub().PushSliceDetailRunning = false
+		}
+		h.sliceDetail = nil
+		h.sliceMu.Unlock()
+		h.reply(req.id, "stop_push_slice_detail_success", "stop_push_slice_detail_success")
+	case req = <-h.generate:
+		c, err := req.session.generate()
+		if err != nil {
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		log.Info("初始化计算器")
+		temperatureData := c.GenerateResult()
+		log.Info("生成数据")
+		h.replyJSON(req.id, "data_generate", temperatureData, "温度场推送数据")
+		log.WithFields(log.Fields{"avg_ms": 4, "max_ms": 4.32}).Debug("切片充满时传输100次的平均时间和最长时间")
+	case req = <-h.generateSlice:
+		sliceData := req.c().GenerateSLiceInfo(req.payload.(int))
+		h.replyJSON(req.id, "slice_generated", sliceData, "温度场切片推送数据")
+	case req = <-h.generateVerticalSlice1:
+		verticalSliceData := req.c().GenerateVerticalSlice1Data()
+		h.replyJSON(req.id, "vertical_slice1_generated", verticalSliceData, "纵向切片1推送数据")
+	case req = <-h.generateVerticalSlice2:
+		verticalSliceData := req.c().GenerateVerticalSlice2Data(req.payload.(model.VerticalReqData))
+		h.replyJSON(req.id, "vertical_slice2_generated", verticalSliceData, "纵向切片2推送数据")
+	case req = <-h.changeSteel:
+		changeSteel := req.payload.(model.ChangeSteel)
+		if err := req.c().ChangeSteel(changeSteel.SteelValue, changeSteel.MixingLength); err != nil {
+			log.WithField("err", err).Warn("更换钢种失败")
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.reply(req.id, "steel_changed", "steel_changed")
+	case req = <-h.steadyState:
+		fieldData, err := req.c().SolveSteadyState()
+		if err != nil {
+			log.WithField("err", err).Warn("稳态计算失败")
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.replyJSON(req.id, "steady_state", fieldData, "稳态温度场")
+	case req = <-h.changeSolver:
+		solver := req.payload.(string)
+		if err := req.c().ChangeSolver(solver); err != nil {
+			log.WithField("err", err).Warn("切换求解器失败")
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.reply(req.id, "solver_changed", solver)
+	case req = <-h.changeAxial:
+		on := req.payload.(bool)
+		req.c().SetAxialConduction(on)
+		h.reply(req.id, "axial_conduction_changed", strconv.FormatBool(on))
+	case req = <-h.setWaterTables:
+		if err := req.c().GetCastingMachine().SetWaterTables(req.payload.([]model.ZoneWaterTable)); err != nil {
+			log.WithField("err", err).Warn("设置水表失败")
+			h.replyError(req.id, model.ErrRejected, err)
+			break
 		}
+		h.reply(req.id, "water_tables_set", "water_tables_set")
+	case req = <-h.setDynamicControl:
+		if err := req.c().SetDynamicControl(req.payload.(model.DynamicControl)); err != nil {
+			log.WithField("err", err).Warn("设置二冷动态控制失败")
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.reply(req.id, "dynamic_control_set", "dynamic_control_set")
+	case req = <-h.getSolidificationEnd:
+		h.replyJSON(req.id, "solidification_end", req.c().SolidificationEnd(), "液芯末端和凝固末端")
+	case req = <-h.getShellProfile:
+		h.replyJSON(req.id, "shell_profile", req.c().ShellProfile(), "坯壳厚度分布")
+	case req = <-h.setReductionWindow:
+		if err := req.c().SetSoftReductionWindow(req.payload.(model.SoftReductionWindow)); err != nil {
+			log.WithField("err", err).Warn("设置轻压下固相率窗口失败")
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.reply(req.id, "soft_reduction_window_set", "soft_reduction_window_set")
+		req.session.pushSoftReduction(req.c())
+	case req = <-h.getSoftReduction:
+		h.replyJSON(req.id, "soft_reduction", req.c().SoftReduction(), "轻压下扇形段")
+	case req = <-h.setAlarmRules:
+		if err := req.c().SetAlarmRules(req.payload.(model.AlarmRules)); err != nil {
+			log.WithField("err", err).Warn("设置报警规则失败")
+			h.replyError(req.id, model.ErrRejected, err)
+			break
+		}
+		h.reply(req.id, "alarm_rules_set", "alarm_rules_set")
+	case req = <-h.getAlarms:
+		h.replyJSON(req.id, "alarms", req.c().Alarms(), "报警记录")
+	case req = <-h.getWaterTables:
+		h.replyJSON(req.id, "water_tables", req.c().GetCastingMachine().WaterTables, "水表")
+	case req = <-h.listSteels:
+		h.replyJSON(req.id, "steel_list", calculator.ListSteels(), "钢种列表")
+	case <-h.ctx.Done():
+		return false
 	}
+	return true
 }
 
 func (h *Hub) handleRequest() {
 	// 可以在此对请求进行预处理
 	defer func() {
-		fmt.Println("停止handleRequest")
+		log.Info("停止handleRequest")
+		h.wg.Done()
 	}()
 	for {
 		select {
 		case msg := <-h.msg:
-			switch msg.Type {
-			case "select_caster":
-				caster := msg.Content
-				fileName := "E:/GoWorkPlace/src/lz/conf/" + caster + ".json"
-				h.selectCaster <- fileName
-			case "env":
-				var env model.Env
-				err := json.Unmarshal([]byte(msg.Content), &env)
-				if err != nil {
-					log.Println("err", err)
-					return
-				}
-				log.WithField("env", env).Info("获取到计算环境参数")
-				h.envSet <- env
-			case "change_initial_temp":
-				temp, err := strconv.ParseFloat(msg.Content, 10)
-				if err != nil {
-					log.Println("err", err)
-					return
-				}
-				log.WithField("temp", temp).Info("获取到初始温度参数")
-				h.changeInitialTemp <- float32(temp)
-			case "change_narrow_surface":
-				var narrowSurface model.NarrowSurface
-				err := json.Unmarshal([]byte(msg.Content), &narrowSurface)
-				if err != nil {
-					log.Println("err", err)
-					return
-				}
-				log.WithField("narrowSurface", narrowSurface).Info("获取到窄面温度参数")
-				h.changeNarrowSurface <- narrowSurface
-			case "change_wide_surface":
-				var wideSurface model.WideSurface
-				err := json.Unmarshal([]byte(msg.Content), &wideSurface)
-				if err != nil {
-					log.Println("err", err)
-					return
-				}
-				log.WithField("wideSurface", wideSurface).Info("获取到宽面温度参数")
-				h.changeWideSurface <- wideSurface
-			case "change_v":
-				v, err := strconv.ParseFloat(msg.Content, 10)
-				if err != nil {
-					log.Println("err", err)
-					return
-				}
-				log.WithField("v", v).Info("获取到拉速参数")
-				h.changeV <- float32(v)
-			case "start":
-				log.Info("开始计算三维温度场")
-				h.started <- struct{}{}
-			case "stop":
-				log.Info("停止计算三维温度场")
-				h.stopped <- struct{}{}
-			case "tail":
-				h.tailStart <- struct{}{}
-			case "start_push_slice_detail":
-				log.Info("开始计算切片详情")
-				index, err := strconv.ParseInt(msg.Content, 10, 64)
-				if err != nil {
-					log.WithField("err", err).Error("切片下标不是整数")
-					return
-				}
-				if index < 0 || int(index) >= h.c.GetFieldSize() {
-					log.Warn("切片下标越界")
-					break
-				}
-				log.WithField("index", index).Info("获取到切片下标参数")
-				h.startPushSliceDetail <- int(index)
-				log.Info("开始计算切片详情信号发送完毕")
-			case "stop_push_slice_detail":
-				log.Info("获取到停止推送切片数据的信号")
-				h.stopPushSliceDetail <- struct{}{}
-			case "generate":
-				log.Info("获取到生成数据的信号")
-				h.generate <- struct{}{}
-			case "generate_slice":
-				log.Info("获取到生成切片数据的信号")
-				index, err := strconv.ParseInt(msg.Content, 10, 64)
-				log.Info("获取到切片下标：", index)
-				if err != nil {
-					log.WithField("err", err).Error("切片下标不是整数")
-					return
-				}
-				if index < 0 || int(index) >= h.c.GetFieldSize() {
-					log.Warn("切片下标越界")
-					break
-				}
-				h.generateSlice <- int(index)
-			case "generate_vertical_slice1":
-				log.Info("获取到生成纵向切片1数据的信号")
-				h.generateVerticalSlice1 <- struct{}{}
-			case "generate_vertical_slice2":
-				log.Info("获取到生成纵向切片2数据的信号")
-				reqData := model.VerticalReqData{}
-				err := json.Unmarshal([]byte(msg.Content), &reqData)
-				log.Info("获取到垂直切片云图请求数据：", reqData)
-				if err != nil {
-					log.Error("json 解析失败")
-					return
-				}
-				if reqData.Index < 0 || reqData.Index >= calculator.Length/calculator.XStep {
-					log.Warn("切片下标越界")
-					break
-				}
-				h.generateVerticalSlice2 <- reqData
-			default:
-				log.Warn("no such type")
+			h.dispatch(msg)
+		case <-h.ctx.Done():
+			return
+		}
+	}
+}
+
+// 解析一条请求并交给 handleResponse 处理，请求不合法时直接回复错误
+// 把请求交给 handleResponse 处理，连接断开时放弃，避免 handleResponse 已退出时阻塞
+func (h *Hub) enqueue(ch chan request, req request) {
+	select {
+	case ch <- req:
+	case <-h.ctx.Done():
+	}
+}
+
+func (h *Hub) dispatch(msg model.Msg) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithField("panic", r).Error("解析请求失败")
+			h.replyError(msg.RequestID, model.ErrInternal, fmt.Errorf("解析请求失败: %v", r))
+		}
+	}()
+	if msg.Version > model.ProtocolVersion {
+		h.replyError(msg.RequestID, model.ErrUnsupportedVersion, fmt.Errorf("不支持的协议版本 %d，服务端版本为 %d", msg.Version, model.ProtocolVersion))
+		return
+	}
+	if requireControl[msg.Type] && !h.session.isController(h) {
+		h.replyError(msg.RequestID, model.ErrForbidden, errors.New("没有会话控制权，只能查看"))
+		return
+	}
+	c := h.session.calculator()
+	if requireEnv[msg.Type] && c == nil {
+		log.Warn("计算环境未设置")
+		h.replyError(msg.RequestID, model.ErrEnvNotSet, errors.New("计算环境未设置"))
+		return
+	}
+	badRequest := func(err error) {
+		h.replyError(msg.RequestID, model.ErrBadRequest, err)
+	}
+	req := request{id: msg.RequestID, session: h.session}
+	switch msg.Type {
+	case "select_caster":
+		caster := msg.Content
+		if err := config.CheckCasterName(caster); err != nil {
+			log.WithField("err", err).Warn("铸机名称不合法")
+			badRequest(err)
+			break
+		}
+		req.payload = config.CasterFile(caster)
+		h.enqueue(h.selectCaster, req)
+	case "env":
+		var env model.Env
+		err := json.Unmarshal([]byte(msg.Content), &env)
+		if err != nil {
+			log.Println("err", err)
+			badRequest(err)
+			break
+		}
+		log.WithField("env", env).Info("获取到计算环境参数")
+		req.payload = env
+		h.enqueue(h.envSet, req)
+	case "change_initial_temp":
+		temp, err := strconv.ParseFloat(msg.Content, 10)
+		if err != nil {
+			log.Println("err", err)
+			badRequest(err)
+			break
+		}
+		log.WithField("temp", temp).Info("获取到初始温度参数")
+		req.payload = float32(temp)
+		h.enqueue(h.changeInitialTemp, req)
+	case "change_narrow_surface":
+		var narrowSurface model.NarrowSurface
+		err := json.Unmarshal([]byte(msg.Content), &narrowSurface)
+		if err != nil {
+			log.Println("err", err)
+			badRequest(err)
+			break
+		}
+		log.WithField("narrowSurface", narrowSurface).Info("获取到窄面温度参数")
+		req.payload = narrowSurface
+		h.enqueue(h.changeNarrowSurface, req)
+	case "change_wide_surface":
+		var wideSurface model.WideSurface
+		err := json.Unmarshal([]byte(msg.Content), &wideSurface)
+		if err != nil {
+			log.Println("err", err)
+			badRequest(err)
+			break
+		}
+		log.WithField("wideSurface", wideSurface).Info("获取到宽面温度参数")
+		req.payload = wideSurface
+		h.enqueue(h.changeWideSurface, req)
+	case "change_v":
+		v, err := strconv.ParseFloat(msg.Content, 10)
+		if err == nil {
+			err = checkSpeed(v)
+		}
+		if err != nil {
+			log.Println("err", err)
+			badRequest(err)
+			break
+		}
+		log.WithField("v", v).Info("获取到拉速参数")
+		req.payload = float32(v)
+		h.enqueue(h.changeV, req)
+	case "start":
+		log.Info("开始计算三维温度场")
+		h.enqueue(h.started, req)
+	case "stop":
+		log.Info("停止计算三维温度场")
+		h.enqueue(h.stopped, req)
+	case "tail":
+		h.enqueue(h.tailStart, req)
+	case "start_push_slice_detail":
+		log.Info("开始计算切片详情")
+		index, err := strconv.ParseInt(msg.Content, 10, 64)
+		if err != nil {
+			log.WithField("err", err).Error("切片下标不是整数")
+			badRequest(err)
+			break
+		}
+		if index < 0 || int(index) >= c.GetFieldSize() {
+			log.Warn("切片下标越界")
+			badRequest(fmt.Errorf("切片下标 %d 越界", index))
+			break
+		}
+		log.WithField("index", index).Info("获取到切片下标参数")
+		req.payload = int(index)
+		h.enqueue(h.startPushSliceDetail, req)
+		log.Info("开始计算切片详情信号发送完毕")
+	case "stop_push_slice_detail":
+		log.Info("获取到停止推送切片数据的信号")
+		h.enqueue(h.stopPushSliceDetail, req)
+	case "generate":
+		log.Info("获取到生成数据的信号")
+		h.enqueue(h.generate, req)
+	case "generate_slice":
+		log.Info("获取到生成切片数据的信号")
+		index, err := strconv.ParseInt(msg.Content, 10, 64)
+		log.Info("获取到切片下标：", index)
+		if err != nil {
+			log.WithField("err", err).Error("切片下标不是整数")
+			badRequest(err)
+			break
+		}
+		if index < 0 || int(index) >= c.GetFieldSize() {
+			log.Warn("切片下标越界")
+			badRequest(fmt.Errorf("切片下标 %d 越界", index))
+			break
+		}
+		req.payload = int(index)
+		h.enqueue(h.generateSlice, req)
+	case "generate_vertical_slice1":
+		log.Info("获取到生成纵向切片1数据的信号")
+		h.enqueue(h.generateVerticalSlice1, req)
+	case "generate_vertical_slice2":
+		log.Info("获取到生成纵向切片2数据的信号")
+		reqData := model.VerticalReqData{}
+		err := json.Unmarshal([]byte(msg.Content), &reqData)
+		log.Info("获取到垂直切片云图请求数据：", reqData)
+		if err != nil {
+			log.Error("json 解析失败")
+			badRequest(err)
+			break
+		}
+		if reqData.Index < 0 || reqData.Index >= calculator.Length/calculator.XStep {
+			log.Warn("切片下标越界")
+			badRequest(fmt.Errorf("纵向切片下标 %d 越界", reqData.Index))
+			break
+		}
+		req.payload = reqData
+		h.enqueue(h.generateVerticalSlice2, req)
+	case "change_steel":
+		var changeSteel model.ChangeSteel
+		err := json.Unmarshal([]byte(msg.Content), &changeSteel)
+		if err != nil {
+			log.WithField("err", err).Error("json 解析失败")
+			badRequest(err)
+			break
+		}
+		log.WithField("changeSteel", changeSteel).Info("获取到更换钢种参数")
+		req.payload = changeSteel
+		h.enqueue(h.changeSteel, req)
+	case "list_steels":
+		log.Info("获取到钢种列表请求")
+		h.enqueue(h.listSteels, req)
+	case "steady_state":
+		log.Info("获取到稳态计算请求")
+		h.enqueue(h.steadyState, req)
+	case "change_solver":
+		log.WithField("solver", msg.Content).Info("获取到切换求解器请求")
+		req.payload = msg.Content
+		h.enqueue(h.changeSolver, req)
+	case "change_axial_conduction":
+		on, err := strconv.ParseBool(msg.Content)
+		if err != nil {
+			log.WithField("err", err).Warn("拉坯方向导热开关格式错误")
+			badRequest(err)
+			break
+		}
+		log.WithField("on", on).Info("获取到拉坯方向导热开关请求")
+		req.payload = on
+		h.enqueue(h.changeAxial, req)
+	case "set_water_tables":
+		var tables []model.ZoneWaterTable
+		if err := json.Unmarshal([]byte(msg.Content), &tables); err != nil {
+			log.WithField("err", err).Warn("水表格式错误")
+			badRequest(err)
+			break
+		}
+		log.WithField("tables", tables).Info("获取到设置水表请求")
+		req.payload = tables
+		h.enqueue(h.setWaterTables, req)
+	case "set_dynamic_control":
+		var cfg model.DynamicControl
+		if err := json.Unmarshal([]byte(msg.Content), &cfg); err != nil {
+			log.WithField("err", err).Warn("二冷动态控制配置格式错误")
+			badRequest(err)
+			break
+		}
+		log.WithField("cfg", cfg).Info("获取到二冷动态控制请求")
+		req.payload = cfg
+		h.enqueue(h.setDynamicControl, req)
+	case "get_water_tables":
+		log.Info("获取到水表请求")
+		h.enqueue(h.getWaterTables, req)
+	case "get_solidification_end":
+		log.Info("获取到液芯末端和凝固末端请求")
+		h.enqueue(h.getSolidificationEnd, req)
+	case "get_shell_profile":
+		log.Info("获取到坯壳厚度分布请求")
+		h.enqueue(h.getShellProfile, req)
+	case "set_soft_reduction_window":
+		var window model.SoftReductionWindow
+		if err := json.Unmarshal([]byte(msg.Content), &window); err != nil {
+			log.WithField("err", err).Warn("轻压下固相率窗口格式错误")
+			badRequest(err)
+			break
+		}
+		log.WithField("window", window).Info("获取到设置轻压下固相率窗口请求")
+		req.payload = window
+		h.enqueue(h.setReductionWindow, req)
+	case "get_soft_reduction":
+		log.Info("获取到轻压下扇形段请求")
+		h.enqueue(h.getSoftReduction, req)
+	case "set_alarm_rules":
+		var rules model.AlarmRules
+		if err := json.Unmarshal([]byte(msg.Content), &rules); err != nil {
+			log.WithField("err", err).Warn("报警规则格式错误")
+			badRequest(err)
+			break
+		}
+		log.WithField("rules", rules).Info("获取到设置报警规则请求")
+		req.payload = rules
+		h.enqueue(h.setAlarmRules, req)
+	case "get_alarms":
+		log.Info("获取到报警记录请求")
+		h.enqueue(h.getAlarms, req)
+	case "attach_session":
+		// 会话操作只修改当前连接所在的会话，直接在这里处理，之后的请求作用于新的会话
+		s, err := h.attachSession(msg.Content)
+		if err != nil {
+			log.WithField("err", err).Warn("加入会话失败")
+			h.replyError(msg.RequestID, model.ErrRejected, err)
+			break
+		}
+		h.replyJSON(msg.RequestID, "session_attached", s.info(h), "会话状态")
+	case "detach_session":
+		if h.session.name == "" {
+			h.replyError(msg.RequestID, model.ErrRejected, errors.New("未加入共享会话"))
+			break
+		}
+		h.detachSession()
+		h.reply(msg.RequestID, "session_detached", "session_detached")
+	case "request_control":
+		if err := h.session.requestControl(h); err != nil {
+			h.replyError(msg.RequestID, model.ErrRejected, err)
+			break
+		}
+		h.replyJSON(msg.RequestID, "control_granted", h.session.info(h), "会话状态")
+		h.session.notify("session_info")
+	case "release_control":
+		if err := h.session.releaseControl(h); err != nil {
+			h.replyError(msg.RequestID, model.ErrRejected, err)
+			break
+		}
+		h.replyJSON(msg.RequestID, "control_released", h.session.info(h), "会话状态")
+		h.session.notify("session_info")
+	case "resume":
+		s, err := h.resumeSession(msg.Content)
+		if err != nil {
+			log.WithField("err", err).Warn("恢复会话失败")
+			h.replyError(msg.RequestID, model.ErrRejected, err)
+			break
+		}
+		h.replyJSON(msg.RequestID, "resumed", s.resumeState(h), "会话状态")
+	case "set_push_format":
+		var encoding calculator.FrameEncoding
+		if msg.Content != "json" {
+			var err error
+			if encoding, err = calculator.ParseFrameEncoding(msg.Content); err != nil {
+				badRequest(err)
+				break
 			}
-		default:
-			time.Sleep(10 * time.Millisecond)
 		}
+		h.mu.Lock()
+		h.pushEncoding = encoding
+		h.mu.Unlock()
+		log.WithField("format", msg.Content).Info("设置温度场推送格式")
+		h.reply(msg.RequestID, "push_format_set", msg.Content)
+	case "list_sessions":
+		if h.sessions == nil {
+			h.replyError(msg.RequestID, model.ErrRejected, errors.New("服务端不支持共享会话"))
+			break
+		}
+		h.replyJSON(msg.RequestID, "session_list", h.sessions.list(), "会话列表")
+	case "close_session":
+		if h.session.name == "" {
+			h.replyError(msg.RequestID, model.ErrRejected, errors.New("未加入共享会话"))
+			break
+		}
+		// 先离开再关闭，其他客户端收到 session_closed 后可以加入其他会话
+		s := h.session
+		h.detachSession()
+		h.sessions.close(s)
+		h.reply(msg.RequestID, "session_closed", s.name)
+	default:
+		log.Warn("no such type")
+		h.replyError(msg.RequestID, model.ErrUnknownType, fmt.Errorf("不支持的请求类型 %q", msg.Type))
+	}
+}
+
+// 发送一条消息，带上协议版本号
+func (h *Hub) write(msg model.Msg) error {
+	msg.Version = model.ProtocolVersion
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conn.WriteJSON(&msg)
+}
+
+// 当前连接的温度场推送编码，为 0 时推送 json
+func (h *Hub) getPushEncoding() calculator.FrameEncoding {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.pushEncoding
+}
+
+// 发送一个二进制帧
+func (h *Hub) writeBinary(frame []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conn.WriteMessage(websocket.BinaryMessage, frame)
+}
+
+// 回复请求 id，周期性推送时 id 为空
+func (h *Hub) reply(id string, msgType string, content string) {
+	err := h.write(model.Msg{RequestID: id, Type: msgType, Content: content})
+	if err != nil {
+		log.WithField("err", err).Error("回复消息失败")
+	}
+}
+
+// 回复请求并带上所在会话的恢复令牌，连接断开后可以用令牌恢复
+func (h *Hub) replyResumable(req request, msgType string, content string) {
+	reply := model.Msg{RequestID: req.id, Type: msgType, Content: content}
+	if h.sessions != nil {
+		token, err := h.sessions.issueToken(req.session)
+		if err != nil {
+			log.WithField("err", err).Error("生成恢复令牌失败")
+		}
+		reply.ResumeToken = token
+	}
+	if err := h.write(reply); err != nil {
+		log.WithField("err", err).Error("回复消息失败")
 	}
 }
 
-func (h *Hub) pushData() {
+// 以错误回复请求 id，为兼容旧客户端 content 中同样是错误信息
+func (h *Hub) replyError(id string, errType string, err error) {
+	log.WithFields(log.Fields{"request_id": id, "type": errType, "err": err}).Warn("请求失败")
 	reply := model.Msg{
-		Type: "data_push",
+		RequestID: id,
+		Type:      "error",
+		Content:   err.Error(),
+		Error:     &model.MsgError{Type: errType, Message: err.Error()},
 	}
-LOOP:
-	for {
-		select {
-		case <-h.c.GetCalcHub().Stop:
-			break LOOP
-		case <-h.c.GetCalcHub().PeriodCalcResult:
-			temperatureData := h.c.BuildData()
-			data, err := json.Marshal(temperatureData)
-			if err != nil {
-				log.WithField("err", err).Error("温度场推送数据json解析失败")
-				return
-			}
-			//start := time.Now()
-			reply.Content = string(data)
-			h.mu.Lock()
-			err = h.conn.WriteJSON(&reply)
-			h.mu.Unlock()
-			if err != nil {
-				log.WithField("err", err).Error("发送温度场推送消息失败")
-			}
-			//fmt.Println(time.Since(start).Milliseconds())
+	if err = h.write(reply); err != nil {
+		log.WithField("err", err).Error("回复消息失败")
+	}
+}
+
+// 把 v 序列化为 json 后以 msgType 类型的消息回复请求 id，序列化失败时回复错误，name 用于日志
+func (h *Hub) replyJSON(id string, msgType string, v interface{}, name string) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.WithField("err", err).Error(name + "json解析失败")
+		if id != "" {
+			h.replyError(id, model.ErrInternal, err)
 		}
+		return
+	}
+	err = h.write(model.Msg{RequestID: id, Type: msgType, Content: string(data)})
+	if err != nil {
+		log.WithField("err", err).Error("发送" + name + "失败")
 	}
 }
 
-func (h *Hub) pushSliceDetail(index int) {
+// 正在推送的切片详情，推送协程退出时关闭 done
+type sliceDetailPush struct {
+	c    calculator.Calculator
+	done chan struct{}
+}
+
+// 在计算器 c 上开始推送第 index 个切片的详情，计算器上已有推送时先停止
+func (h *Hub) startSliceDetail(c calculator.Calculator, index int) {
+	h.sliceMu.Lock()
+	defer h.sliceMu.Unlock()
+	if c.GetCalcHub().PushSliceDetailRunning {
+		c.GetCalcHub().StopPushSliceDetail()
+	}
+	p := &sliceDetailPush{c: c, done: make(chan struct{})}
+	h.sliceDetail = p
+	c.GetCalcHub().PushSliceDetailRunning = true
+	go c.GetCalcHub().SliceDetailRun()
+	go h.pushSliceDetail(p, index)
+}
+
+// 停止本连接开启的切片详情推送，推送已被其他连接停止或计算器已关闭时不做处理
+func (h *Hub) stopSliceDetail() {
+	h.sliceMu.Lock()
+	defer h.sliceMu.Unlock()
+	p := h.sliceDetail
+	if p == nil {
+		return
+	}
+	h.sliceDetail = nil
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	p.c.GetCalcHub().StopPushSliceDetail()
+	p.c.GetCalcHub().PushSliceDetailRunning = false
+}
+
+func (h *Hub) pushSliceDetail(p *sliceDetailPush, index int) {
+	c := p.c
 	reply := model.Msg{
 		Type: "slice_detail",
 	}
-LOOP:
 	for {
 		select {
-		case <-h.c.GetCalcHub().StopPushSliceDataSignalForPush:
+		case <-c.GetCalcHub().StopPushSliceDataSignalForPush:
 			log.Info("停止推送切片详情")
-			h.c.GetCalcHub().StopSuccessForPush <- struct{}{}
-			break LOOP
-		case <-h.c.GetCalcHub().PeriodPushSliceData:
-			h.pushSliceData(reply, index)
+			// 先标记推送已结束，停止方返回后本连接不会再停止其他连接开启的推送
+			close(p.done)
+			c.GetCalcHub().StopSuccessForPush <- struct{}{}
+			return
+		case <-c.GetCalcHub().Done():
+			close(p.done)
+			return
+		case <-c.GetCalcHub().PeriodPushSliceData:
+			h.pushSliceData(c, reply, index)
 		}
 	}
 }
 
-func (h *Hub) pushSliceData(reply model.Msg, index int) {
-	sliceData := h.c.BuildSliceData(index)
+func (h *Hub) pushSliceData(c calculator.Calculator, reply model.Msg, index int) {
+	sliceData := c.BuildSliceData(index)
 	data, err := json.Marshal(sliceData)
 	if err != nil {
 		log.WithField("err", err).Error("温度场横切面推送数据json解析失败")
 		return
 	}
 	reply.Content = string(data)
-	h.mu.Lock()
-	err = h.conn.WriteJSON(&reply)
-	h.mu.Unlock()
+	err = h.write(reply)
 	if err != nil {
 		log.WithField("err", err).Error("发送温度场横切面推送消息失败")
 	}
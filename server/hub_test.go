@@ -14,8 +14,9 @@ func TestCalculatorPushTime(t *testing.T) {
 	reply := model.Msg{
 		Type: "data_push",
 	}
-	h.c = calculator.NewCalculatorForGenerate()
-	temperatureData := h.c.GenerateResult()
+	c := calculator.NewCalculatorForGenerate()
+	h.session.setCalculator(c)
+	temperatureData := c.GenerateResult()
 	data, _ := json.Marshal(temperatureData)
 	total := time.Second * 0
 	max := time.Second * 0
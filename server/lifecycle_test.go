@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"lz/calculator"
+	"lz/config"
+	"lz/model"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// 等待协程数量回到 n 以下，超时返回当前的协程数量
+func waitGoroutines(n int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for runtime.NumGoroutine() > n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return runtime.NumGoroutine()
+}
+
+// 加载默认铸机的计算环境，返回 env 请求的内容
+func loadTestEnv(t *testing.T) string {
+	if err := config.Init("../conf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := calculator.LoadSteelLibrary(config.PhaseTemperatureFile(), config.PhysicalParameterFile()); err != nil {
+		t.Fatal(err)
+	}
+	env, err := config.LoadEnv(config.CasterFile(config.DefaultCaster), "../conf/env.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := json.Marshal(env)
+	return string(content)
+}
+
+func TestHubShutdown(t *testing.T) {
+	content := loadTestEnv(t)
+	// 断开后的会话只保留很短时间等待恢复
+	defer func(timeout time.Duration) { ResumeTimeout = timeout }(ResumeTimeout)
+	ResumeTimeout = 100 * time.Millisecond
+	ts := newTestServer(t)
+	baseline := runtime.NumGoroutine()
+	conn := dialTestServer(t, ts)
+	for _, c := range []struct {
+		msg   model.Msg
+		reply string
+	}{
+		{model.Msg{RequestID: "1", Type: "env", Content: content}, "env_set"},
+		{model.Msg{RequestID: "2", Type: "start"}, "started"},
+	} {
+		if err := conn.WriteJSON(&c.msg); err != nil {
+			t.Fatal(err)
+		}
+		if reply := readReply(t, conn); reply.Type != c.reply || reply.RequestID != c.msg.RequestID {
+			t.Fatal("回复不正确", reply)
+		}
+	}
+	if n := runtime.NumGoroutine(); n <= baseline {
+		t.Fatal("开始计算后应启动计算、推送和 executor 协程", n, baseline)
+	}
+
+	// 计算进行中断开连接，hub、计算器和 executor 的协程全部退出
+	time.Sleep(500 * time.Millisecond)
+	_ = conn.Close()
+	if n := waitGoroutines(baseline, 10*time.Second); n > baseline {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("断开连接后协程数量 %d 未回到 %d\n%s", n, baseline, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestSliceDetailStopsOnLeave(t *testing.T) {
+	content := loadTestEnv(t)
+	ts := newTestServer(t)
+	conn := dialTestServer(t, ts)
+	roundTrip(t, conn, model.Msg{RequestID: "1", Type: "attach_session", Content: "strand-slice"})
+	if reply := roundTrip(t, conn, model.Msg{RequestID: "2", Type: "env", Content: content}); reply.Type != "env_set" {
+		t.Fatal("设置计算环境失败", reply)
+	}
+	if reply := roundTrip(t, conn, model.Msg{RequestID: "3", Type: "start"}); reply.Type != "started" {
+		t.Fatal("开始计算失败", reply)
+	}
+	time.Sleep(500 * time.Millisecond)
+	baseline := runtime.NumGoroutine()
+	if reply := roundTrip(t, conn, model.Msg{RequestID: "4", Type: "start_push_slice_detail", Content: "0"}); reply.Type != "start_push_slice_detail_success" {
+		t.Fatal("开始推送切片详情失败", reply)
+	}
+	waitPush(t, conn, "slice_detail", 5*time.Second)
+
+	// 命名会话的计算器在离开后继续存在，本连接开启的切片详情推送应随之停止
+	roundTrip(t, conn, model.Msg{RequestID: "5", Type: "detach_session"})
+	if n := waitGoroutines(baseline, 5*time.Second); n > baseline {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("离开会话后协程数量 %d 未回到 %d\n%s", n, baseline, buf[:runtime.Stack(buf, true)])
+	}
+	roundTrip(t, conn, model.Msg{RequestID: "6", Type: "attach_session", Content: "strand-slice"})
+	roundTrip(t, conn, model.Msg{RequestID: "7", Type: "close_session"})
+}
+
+func TestEnqueueAfterClose(t *testing.T) {
+	h := NewHub()
+	h.cancel()
+	// handleResponse 已退出、请求通道已满时，handleRequest 不应阻塞
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i <= cap(h.started); i++ {
+			h.enqueue(h.started, request{})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("连接断开后发送请求阻塞")
+	}
+}
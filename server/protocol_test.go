@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"lz/calculator"
+	"lz/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 启动一个只有 websocket 接口的测试服务
+func newTestServer(t *testing.T) *httptest.Server {
+	s := NewServer("", websocket.Upgrader{})
+	ts := httptest.NewServer(http.HandlerFunc(s.serveWs))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// 与测试服务建立 websocket 连接
+func dialTestServer(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func readReply(t *testing.T, conn *websocket.Conn) model.Msg {
+	var msg model.Msg
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestProtocolErrors(t *testing.T) {
+	conn := dialTestServer(t, newTestServer(t))
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{not json")); err != nil {
+		t.Fatal(err)
+	}
+	reply := readReply(t, conn)
+	if reply.Type != "error" || reply.Error == nil || reply.Error.Type != model.ErrBadRequest || reply.Version != model.ProtocolVersion {
+		t.Fatal("格式错误的消息应回复 bad_request", reply)
+	}
+
+	// 格式错误的消息之后连接仍然可用，每个请求都有一个带相同 request_id 的回复
+	for _, c := range []struct {
+		msg     model.Msg
+		errType string
+	}{
+		{model.Msg{RequestID: "1", Type: "no_such_type"}, model.ErrUnknownType},
+		{model.Msg{RequestID: "2", Type: "start"}, model.ErrEnvNotSet},
+		{model.Msg{RequestID: "3", Type: "env", Content: "{bad"}, model.ErrBadRequest},
+		{model.Msg{RequestID: "4", Type: "select_caster", Content: "../caster"}, model.ErrBadRequest},
+		{model.Msg{RequestID: "5", Type: "list_steels", Version: model.ProtocolVersion + 1}, model.ErrUnsupportedVersion},
+	} {
+		if err := conn.WriteJSON(&c.msg); err != nil {
+			t.Fatal(err)
+		}
+		reply = readReply(t, conn)
+		if reply.RequestID != c.msg.RequestID || reply.Type != "error" || reply.Error == nil || reply.Error.Type != c.errType {
+			t.Fatal("错误回复不正确", c.msg, reply)
+		}
+	}
+
+	if err := conn.WriteJSON(&model.Msg{RequestID: "6", Type: "list_steels"}); err != nil {
+		t.Fatal(err)
+	}
+	reply = readReply(t, conn)
+	if reply.RequestID != "6" || reply.Type != "steel_list" || reply.Error != nil {
+		t.Fatal("正常请求的回复不正确", reply)
+	}
+}
+
+func TestBinaryPush(t *testing.T) {
+	content := loadTestEnv(t)
+	conn := dialTestServer(t, newTestServer(t))
+	if reply := roundTrip(t, conn, model.Msg{RequestID: "1", Type: "set_push_format", Content: "float64"}); reply.Error == nil || reply.Error.Type != model.ErrBadRequest {
+		t.Fatal("不支持的推送格式应回复 bad_request", reply)
+	}
+	for _, msg := range []model.Msg{
+		{RequestID: "2", Type: "set_push_format", Content: "uint16"},
+		{RequestID: "3", Type: "env", Content: content},
+		{RequestID: "4", Type: "start"},
+	} {
+		if reply := roundTrip(t, conn, msg); reply.Error != nil {
+			t.Fatal("请求失败", reply)
+		}
+	}
+
+	// 温度场以二进制帧推送，其他推送仍然是 json
+	_ = conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if messageType == websocket.TextMessage {
+			var msg model.Msg
+			if err = json.Unmarshal(data, &msg); err != nil || msg.Type == "data_push" {
+				t.Fatal("温度场不应再以 json 推送", msg.Type, err)
+			}
+			continue
+		}
+		field, err := calculator.DecodeFieldFrame(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if field.Sides == nil || len(field.Sides.Front) == 0 {
+			t.Fatal("温度场帧没有数据", field)
+		}
+		return
+	}
+}
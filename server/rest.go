@@ -0,0 +1,278 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"lz/calculator"
+	"lz/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTP 接口
+//
+// 与 websocket 请求调用相同的计算器方法，作用于命名会话，请求和回复都是 json：
+//
+//	GET    /sessions                                       会话列表
+//	GET    /sessions/{id}                                  会话状态
+//	DELETE /sessions/{id}                                  关闭会话
+//	POST   /sessions/{id}/env                              设置计算环境，body 为 model.Env，会话不存在时创建
+//	POST   /sessions/{id}/start                            开始计算
+//	POST   /sessions/{id}/stop                             停止计算
+//	POST   /sessions/{id}/speed                            设置拉速，body 为 {"speed": 1.2}，单位 m/min
+//	GET    /sessions/{id}/field?format=                    当前温度场，format 为 float32、uint16 或 huffman 时返回二进制帧
+//	GET    /sessions/{id}/slices/{index}                   横切面
+//	GET    /sessions/{id}/vertical-slices/{index}?z_scale= 纵切面，z_scale 默认为 1
+//	GET    /sessions/{id}/metallurgical-length             液芯末端和凝固末端
+//	GET    /sessions/{id}/shell-profile                    坯壳厚度分布
+//	GET    /sessions/{id}/soft-reduction                   轻压下扇形段
+//	GET    /sessions/{id}/alarms                           当前报警和报警历史
+//
+// 失败时回复 model.MsgError，HTTP 状态码由错误类型决定。websocket 客户端持有会话控制权时，修改会话的请求被拒绝。
+
+// 错误类型对应的 HTTP 状态码
+var errorStatus = map[string]int{
+	model.ErrBadRequest: http.StatusBadRequest,
+	model.ErrNotFound:   http.StatusNotFound,
+	model.ErrForbidden:  http.StatusForbidden,
+	model.ErrEnvNotSet:  http.StatusConflict,
+	model.ErrRejected:   http.StatusUnprocessableEntity,
+	model.ErrInternal:   http.StatusInternalServerError,
+}
+
+// 设置拉速的请求
+type speedRequest struct {
+	Speed float32 `json:"speed"` // m/min
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithField("err", err).Error("HTTP 回复失败")
+	}
+}
+
+func writeError(w http.ResponseWriter, errType string, err error) {
+	log.WithFields(log.Fields{"type": errType, "err": err}).Warn("HTTP 请求失败")
+	status, ok := errorStatus[errType]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, &model.MsgError{Type: errType, Message: err.Error()})
+}
+
+// 解析 json 请求体，失败时回复 bad_request
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, model.ErrBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.WithField("panic", e).Error("处理 HTTP 请求失败")
+			writeError(w, model.ErrInternal, fmt.Errorf("处理请求失败: %v", e))
+		}
+	}()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "sessions" {
+		writeError(w, model.ErrNotFound, fmt.Errorf("接口 %s 不存在", r.URL.Path))
+		return
+	}
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.sessions.list())
+		return
+	}
+	name, route := parts[1], parts[2:]
+
+	// 设置计算环境时创建会话，其他请求只作用于已有的会话
+	var session *Session
+	var created bool
+	var err error
+	if len(route) == 1 && route[0] == "env" && r.Method == http.MethodPost {
+		session, created, err = s.sessions.getOrCreate(name)
+		if err != nil {
+			writeError(w, model.ErrBadRequest, err)
+			return
+		}
+	} else if session, err = s.sessions.find(name); err != nil {
+		writeError(w, model.ErrNotFound, err)
+		return
+	}
+
+	if r.Method != http.MethodGet && session.info(nil).Controlled {
+		writeError(w, model.ErrForbidden, errors.New("会话控制权由 websocket 客户端持有"))
+		return
+	}
+	if len(route) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, session.info(nil))
+		case http.MethodDelete:
+			s.sessions.close(session)
+			writeJSON(w, http.StatusOK, session.info(nil))
+		default:
+			methodNotAllowed(w, r)
+		}
+		return
+	}
+	if route[0] == "env" {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		// 本次请求创建的会话设置失败时移除，不留下没有计算环境的会话
+		discard := func() {
+			if created && len(session.clientList()) == 0 {
+				s.sessions.close(session)
+			}
+		}
+		var env model.Env
+		if !readJSON(w, r, &env) {
+			discard()
+			return
+		}
+		log.WithFields(log.Fields{"session": name, "env": env}).Info("获取到计算环境参数")
+		if errType, err := session.setEnv(env); err != nil {
+			discard()
+			writeError(w, errType, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, session.info(nil))
+		return
+	}
+
+	c := session.calculator()
+	if c == nil {
+		writeError(w, model.ErrEnvNotSet, errors.New("计算环境未设置"))
+		return
+	}
+	if r.Method == http.MethodPost {
+		s.serveAction(w, r, session, route)
+	} else if r.Method == http.MethodGet {
+		s.serveQuery(w, r, c, route)
+	} else {
+		methodNotAllowed(w, r)
+	}
+}
+
+// 修改会话的请求
+func (s *Server) serveAction(w http.ResponseWriter, r *http.Request, session *Session, route []string) {
+	if len(route) != 1 {
+		notFound(w, r)
+		return
+	}
+	switch route[0] {
+	case "start":
+		if err := session.start(); err != nil {
+			writeError(w, model.ErrRejected, err)
+			return
+		}
+	case "stop":
+		if err := session.stop(); err != nil {
+			writeError(w, model.ErrRejected, err)
+			return
+		}
+	case "speed":
+		var req speedRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if err := checkSpeed(float64(req.Speed)); err != nil {
+			writeError(w, model.ErrBadRequest, err)
+			return
+		}
+		log.WithField("v", req.Speed).Info("获取到拉速参数")
+		if err := session.setSpeed(req.Speed); err != nil {
+			writeError(w, model.ErrEnvNotSet, err)
+			return
+		}
+	default:
+		notFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, session.info(nil))
+}
+
+// 查询计算结果的请求
+func (s *Server) serveQuery(w http.ResponseWriter, r *http.Request, c calculator.Calculator, route []string) {
+	switch {
+	case len(route) == 1 && route[0] == "field":
+		format := r.URL.Query().Get("format")
+		if format == "" || format == "json" {
+			writeJSON(w, http.StatusOK, c.BuildData())
+			return
+		}
+		encoding, err := calculator.ParseFrameEncoding(format)
+		if err != nil {
+			writeError(w, model.ErrBadRequest, err)
+			return
+		}
+		frame, err := calculator.EncodeFieldFrame(c.BuildData(), encoding)
+		if err != nil {
+			writeError(w, model.ErrInternal, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(frame)
+	case len(route) == 2 && route[0] == "slices":
+		index, err := strconv.Atoi(route[1])
+		if err != nil {
+			writeError(w, model.ErrBadRequest, err)
+			return
+		}
+		if index < 0 || index >= c.GetFieldSize() {
+			writeError(w, model.ErrBadRequest, fmt.Errorf("切片下标 %d 越界", index))
+			return
+		}
+		writeJSON(w, http.StatusOK, c.GenerateSLiceInfo(index))
+	case len(route) == 2 && route[0] == "vertical-slices":
+		reqData := model.VerticalReqData{ZScale: 1}
+		var err error
+		if reqData.Index, err = strconv.Atoi(route[1]); err != nil {
+			writeError(w, model.ErrBadRequest, err)
+			return
+		}
+		if reqData.Index < 0 || reqData.Index >= calculator.Length/calculator.XStep {
+			writeError(w, model.ErrBadRequest, fmt.Errorf("纵向切片下标 %d 越界", reqData.Index))
+			return
+		}
+		if scale := r.URL.Query().Get("z_scale"); scale != "" {
+			if reqData.ZScale, err = strconv.Atoi(scale); err != nil || reqData.ZScale < 1 {
+				writeError(w, model.ErrBadRequest, fmt.Errorf("z_scale %q 必须是正整数", scale))
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, c.GenerateVerticalSlice2Data(reqData))
+	case len(route) == 1 && route[0] == "metallurgical-length":
+		writeJSON(w, http.StatusOK, c.SolidificationEnd())
+	case len(route) == 1 && route[0] == "shell-profile":
+		writeJSON(w, http.StatusOK, c.ShellProfile())
+	case len(route) == 1 && route[0] == "soft-reduction":
+		writeJSON(w, http.StatusOK, c.SoftReduction())
+	case len(route) == 1 && route[0] == "alarms":
+		writeJSON(w, http.StatusOK, c.Alarms())
+	default:
+		notFound(w, r)
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, model.ErrNotFound, fmt.Errorf("接口 %s %s 不存在", r.Method, r.URL.Path))
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", "GET, POST, DELETE")
+	writeJSON(w, http.StatusMethodNotAllowed, &model.MsgError{Type: model.ErrBadRequest, Message: "不支持的请求方法 " + r.Method})
+}
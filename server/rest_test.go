@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"io"
+	"io/ioutil"
+	"lz/calculator"
+	"lz/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 发送 HTTP 请求，检查状态码并解析回复
+func doREST(t *testing.T, method, url, body string, status int, v interface{}) {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		t.Fatal(method, url, "状态码", resp.StatusCode, "应为", status)
+	}
+	if v != nil {
+		if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(method, url, err)
+		}
+	}
+}
+
+func TestREST(t *testing.T) {
+	content := loadTestEnv(t)
+	s := NewServer("", websocket.Upgrader{})
+	ts := httptest.NewServer(http.HandlerFunc(s.serveREST))
+	defer ts.Close()
+	url := ts.URL + "/sessions/strand-2"
+
+	var e model.MsgError
+	doREST(t, http.MethodGet, url+"/metallurgical-length", "", http.StatusNotFound, &e)
+	if e.Type != model.ErrNotFound {
+		t.Fatal("会话不存在时应回复 not_found", e)
+	}
+	doREST(t, http.MethodPost, url+"/env", "{bad", http.StatusBadRequest, &e)
+	doREST(t, http.MethodPost, url+"/env", "{}", http.StatusUnprocessableEntity, &e)
+	if list := s.sessions.list(); len(list) != 0 {
+		t.Fatal("设置计算环境失败时不应留下会话", list)
+	}
+
+	var info SessionInfo
+	doREST(t, http.MethodPost, url+"/env", content, http.StatusOK, &info)
+	if info.Name != "strand-2" || !info.EnvSet {
+		t.Fatal("设置计算环境后会话状态不正确", info)
+	}
+	doREST(t, http.MethodPost, url+"/speed", `{"speed": -1}`, http.StatusBadRequest, &e)
+	// 拉速为 0 表示停止拉坯
+	doREST(t, http.MethodPost, url+"/speed", `{"speed": 0}`, http.StatusOK, &info)
+	doREST(t, http.MethodPost, url+"/speed", `{"speed": 1.2}`, http.StatusOK, &info)
+	if s.sessions.list()[0].Name != "strand-2" {
+		t.Fatal("会话列表不正确")
+	}
+	session, _ := s.sessions.find("strand-2")
+	if v := session.calculator().GetCastingMachine().Speed(); v != 1.2 {
+		t.Fatal("拉速未设置", v)
+	}
+
+	var end calculator.SolidificationEndData
+	doREST(t, http.MethodGet, url+"/metallurgical-length", "", http.StatusOK, &end)
+	doREST(t, http.MethodGet, url+"/slices/0", "", http.StatusBadRequest, &e)
+	doREST(t, http.MethodGet, url+"/no-such-route", "", http.StatusNotFound, &e)
+
+	// 开始计算，铸坯进入铸机后可以查询切片
+	doREST(t, http.MethodPost, url+"/start", "", http.StatusOK, &info)
+	doREST(t, http.MethodPost, url+"/start", "", http.StatusUnprocessableEntity, &e)
+	deadline := time.Now().Add(10 * time.Second)
+	for session.calculator().GetFieldSize() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var slice calculator.SliceInfo
+	doREST(t, http.MethodGet, url+"/slices/0", "", http.StatusOK, &slice)
+	doREST(t, http.MethodGet, url+"/slices/-1", "", http.StatusBadRequest, &e)
+	resp, err := http.Get(url + "/field?format=float32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if field, err := calculator.DecodeFieldFrame(frame); err != nil || field.Sides == nil {
+		t.Fatal("温度场二进制帧不正确", err)
+	}
+	resp, err = http.Get(url + "/field?format=huffman")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if field, err := calculator.DecodeFieldFrame(compressed); err != nil || field.Sides == nil || len(compressed) >= len(frame) {
+		t.Fatal("Huffman 压缩的温度场帧不正确", err, len(compressed), len(frame))
+	}
+	var vertical calculator.VerticalSliceData2
+	doREST(t, http.MethodGet, url+"/vertical-slices/0", "", http.StatusOK, &vertical)
+	doREST(t, http.MethodGet, url+"/vertical-slices/0?z_scale=0", "", http.StatusBadRequest, &e)
+	doREST(t, http.MethodPost, url+"/stop", "", http.StatusOK, &info)
+	doREST(t, http.MethodPost, url+"/stop", "", http.StatusUnprocessableEntity, &e)
+	if e.Type != model.ErrRejected {
+		t.Fatal("没有在计算时停止应被拒绝", e)
+	}
+
+	doREST(t, http.MethodDelete, url, "", http.StatusOK, &info)
+	if !info.Closed {
+		t.Fatal("会话应已关闭", info)
+	}
+	doREST(t, http.MethodGet, url, "", http.StatusNotFound, &e)
+}
+
+func TestRESTConcurrentEnv(t *testing.T) {
+	content := loadTestEnv(t)
+	s := NewServer("", websocket.Upgrader{})
+	ts := httptest.NewServer(http.HandlerFunc(s.serveREST))
+	defer ts.Close()
+	url := ts.URL + "/sessions/strand-3"
+
+	// 同一会话的计算环境、拉速、开始和停止请求同时到达时依次执行
+	post := func(route, body string) int {
+		resp, err := http.Post(url+route, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return 0
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status := post("/env", content); status != http.StatusOK {
+				t.Error("设置计算环境失败", status)
+			}
+			if status := post("/speed", `{"speed": 1.2}`); status != http.StatusOK {
+				t.Error("设置拉速失败", status)
+			}
+			post("/start", "")
+			post("/stop", "")
+		}()
+	}
+	wg.Wait()
+	session, err := s.sessions.find("strand-3")
+	if err != nil || session.calculator() == nil {
+		t.Fatal("计算环境未设置", err)
+	}
+	var info SessionInfo
+	doREST(t, http.MethodDelete, url, "", http.StatusOK, &info)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"encoding/json"
 	"flag"
 	"github.com/gorilla/websocket"
 	"log"
@@ -11,32 +12,43 @@ import (
 type Server struct {
 	addr     string
 	upgrader websocket.Upgrader
+	sessions *SessionManager // 多个连接共享的命名会话
 }
 
 func NewServer(addr string, upgrader websocket.Upgrader) *Server {
 	return &Server{
 		addr:     addr,
 		upgrader: upgrader,
+		sessions: NewSessionManager(),
 	}
 }
 
 // serveWs handles websocket requests from the peer.
 func (s *Server) serveWs(w http.ResponseWriter, r *http.Request) {
-	hub := NewHub()
+	// 升级失败时还没有创建 Hub 和私有会话，不需要清理
 	conn, err := s.upgrader.Upgrade(w, r, nil)
-	hub.conn = conn
 	if err != nil {
 		log.Println(err)
 		return
 	}
 	defer conn.Close()
-	var msg model.Msg
-	go hub.handleRequest()
-	go hub.handleResponse()
+	hub := NewHub()
+	hub.sessions = s.sessions
+	hub.conn = conn
+	hub.start()
+	defer hub.close()
 	for {
-		err = conn.ReadJSON(&msg)
+		_, data, err := conn.ReadMessage()
 		if err != nil {
+			// 读取失败后连接不再可用
+			log.Println("err: ", err)
+			return
+		}
+		// 格式错误的消息只回复错误，不影响后续消息
+		var msg model.Msg
+		if err = json.Unmarshal(data, &msg); err != nil {
 			log.Println("err: ", err)
+			hub.replyError("", model.ErrBadRequest, err)
 			continue
 		}
 		hub.msg <- msg
@@ -48,6 +60,8 @@ func (s *Server) Serve() {
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		s.serveWs(w, r)
 	})
+	http.HandleFunc("/sessions", s.serveREST)
+	http.HandleFunc("/sessions/", s.serveREST)
 	err := http.ListenAndServe(s.addr, nil)
 	if err != nil {
 		log.Fatal("ListenAndServe: ", err)
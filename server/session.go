@@ -0,0 +1,668 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"lz/calculator"
+	"lz/config"
+	"lz/model"
+	"math"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 模拟会话
+//
+// 会话拥有一个计算器，多个客户端可以加入同一个命名会话（一般以铸流编号命名），一起收到温度场等周期性推送。
+// 同一时间只有一个客户端持有控制权，可以设置计算环境、开始/停止计算、修改工艺参数，其他客户端只能查看。
+// 客户端连接后先处于一个私有会话中，与加入共享会话之前的行为相同；私有会话在连接断开时关闭，
+// 命名会话在所有客户端断开后继续计算，刷新页面后重新加入即可。
+//
+// 设置计算环境和开始计算时回复恢复令牌，连接断开后新的连接用恢复令牌重新进入会话，得到当前温度场、
+// 工艺参数和是否在计算，并继续收到推送，计算不会重新开始。私有会话断开后保留 ResumeTimeout，超时后关闭。
+
+// 私有会话断开后等待恢复的时间
+var ResumeTimeout = 5 * time.Minute
+
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,64}$`)
+
+// 计算断面和铸坯尺寸 mm
+type sectionGrid struct {
+	mode          string
+	length, width int
+	zLength       int
+}
+
+func (g sectionGrid) String() string {
+	return fmt.Sprintf("%s 断面 %dx%d、长度 %d", g.mode, g.length, g.width, g.zLength)
+}
+
+// 计算断面和计算区域的尺寸是 calculator 包的全局变量，所有会话的计算器共用，正在计算的计算器每个时间步长都会读取。
+// 在改为每个计算器各自保存之前，已有会话的计算器时只能创建断面和尺寸相同的计算器，并且不再写入这些全局变量，所有这些计算器关闭后才能改变
+var (
+	gridMu    sync.Mutex
+	gridUsers = make(map[*Session]sectionGrid) // 按 env 创建了计算器的会话
+)
+
+// 会话状态，每个客户端收到的 control 不同
+type SessionInfo struct {
+	Name       string `json:"name"`
+	Clients    int    `json:"clients"`    // 已加入的客户端数量
+	Control    bool   `json:"control"`    // 当前客户端是否持有控制权
+	Controlled bool   `json:"controlled"` // 是否有客户端持有控制权
+	EnvSet     bool   `json:"env_set"`    // 计算环境是否已设置
+	Closed     bool   `json:"closed"`     // 会话是否已关闭
+}
+
+// 恢复连接时的工艺参数
+type ResumeParameters struct {
+	Speed            float32 `json:"speed"`             // 拉速 m/min
+	StartTemperature float32 `json:"start_temperature"` // 浇铸温度
+	NarrowSurfaceIn  float32 `json:"narrow_surface_in"`
+	NarrowSurfaceOut float32 `json:"narrow_surface_out"`
+	WideSurfaceIn    float32 `json:"wide_surface_in"`
+	WideSurfaceOut   float32 `json:"wide_surface_out"`
+}
+
+// 恢复连接时返回的会话状态
+type ResumeState struct {
+	Session    SessionInfo                      `json:"session"`
+	Running    bool                             `json:"running"` // 是否正在计算，正在计算时之后会继续收到推送
+	Parameters *ResumeParameters                `json:"parameters,omitempty"`
+	Field      *calculator.TemperatureFieldData `json:"field,omitempty"`
+}
+
+type Session struct {
+	name string // 为空时为连接私有的会话
+
+	// websocket 和 HTTP 请求可能同时修改会话，设置计算环境、开始和停止计算、设置拉速和关闭会话时持有 ctl，依次执行。
+	// 持有 ctl 时可以再获取 mu，反之不行
+	ctl        sync.Mutex
+	mu         sync.Mutex
+	c          calculator.Calculator
+	clients    []*Hub // 按加入的先后顺序
+	controller *Hub
+	closed     bool
+	running    bool        // 是否已开始计算
+	token      string      // 恢复令牌，第一次设置计算环境或开始计算时生成
+	expire     *time.Timer // 私有会话断开后等待恢复的计时器
+	// 推送协程最近一次推送的温度场，恢复连接时直接使用，计算器更换时清空
+	lastField *calculator.TemperatureFieldData
+}
+
+func newSession(name string) *Session {
+	return &Session{name: name}
+}
+
+func (s *Session) calculator() calculator.Calculator {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.c
+}
+
+// 替换会话的计算器，原来的计算器被关闭
+func (s *Session) setCalculator(c calculator.Calculator) {
+	s.mu.Lock()
+	old := s.c
+	s.c = c
+	if old != c {
+		s.running = false
+		s.lastField = nil
+	}
+	s.mu.Unlock()
+	if old != nil && old != c {
+		old.Close()
+		s.releaseGrid()
+	}
+}
+
+// 为私有会话换上生成测试数据的计算器。共享会话的计算器可能正被其他客户端查看，不能替换
+func (s *Session) generate() (calculator.Calculator, error) {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+	if s.name != "" {
+		return nil, fmt.Errorf("共享会话 %s 不能生成测试数据", s.name)
+	}
+	c := calculator.NewCalculatorForGenerate()
+	s.setCalculator(c)
+	return c, nil
+}
+
+// 会话的计算器关闭后不再占用计算断面和尺寸
+func (s *Session) releaseGrid() {
+	gridMu.Lock()
+	delete(gridUsers, s)
+	gridMu.Unlock()
+}
+
+// 按 env 的断面和尺寸设置 calculator 包的全局变量并创建计算器，与其他会话的计算器的断面或尺寸不同时返回错误
+func (s *Session) newCalculator(env model.Env) (calculator.Calculator, error) {
+	mode, _, _, err := calculator.ResolveSection(env.SectionMode, env.Coordinate.Length, env.Coordinate.Width)
+	if err != nil {
+		return nil, err
+	}
+	grid := sectionGrid{mode: mode, length: env.Coordinate.Length, width: env.Coordinate.Width, zLength: env.Coordinate.ZLength}
+	gridMu.Lock()
+	defer gridMu.Unlock()
+	shared := false
+	for other, g := range gridUsers {
+		if other == s {
+			continue
+		}
+		if g != grid {
+			return nil, fmt.Errorf("%s 与其他会话正在使用的 %s 不同，所有会话的计算断面和铸坯尺寸必须相同", grid, g)
+		}
+		shared = true
+	}
+	// 其他会话正在使用相同的断面时全局变量已经是这些值，不再写入，避免与正在计算的计算器同时读写
+	if !shared {
+		// 初始化计算断面和铸坯尺寸
+		if err = calculator.SetSection(env.SectionMode, env.Coordinate.Length, env.Coordinate.Width); err != nil {
+			return nil, err
+		}
+		calculator.ZLength = env.Coordinate.ZLength
+		log.Info("ZLength:", calculator.ZLength, " ,Length:", calculator.Length, " ,Width:", calculator.Width, " ,Section:", calculator.SectionMode)
+	}
+	c := calculator.NewCalculatorWithArrDeque(nil)
+	gridUsers[s] = grid
+	return c, nil
+}
+
+// 客户端加入会话，会话没有控制者时获得控制权
+func (s *Session) join(h *Hub) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("会话已关闭")
+	}
+	for _, client := range s.clients {
+		if client == h {
+			return nil
+		}
+	}
+	s.clients = append(s.clients, h)
+	if s.controller == nil {
+		s.controller = h
+	}
+	if s.expire != nil {
+		s.expire.Stop()
+		s.expire = nil
+	}
+	return nil
+}
+
+// 客户端离开会话，控制者离开时控制权交给最早加入的客户端，返回剩余的客户端数量
+func (s *Session) leave(h *Hub) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, client := range s.clients {
+		if client == h {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			break
+		}
+	}
+	if s.controller == h {
+		s.controller = nil
+		if len(s.clients) > 0 {
+			s.controller = s.clients[0]
+		}
+	}
+	return len(s.clients)
+}
+
+func (s *Session) isController(h *Hub) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.controller == h
+}
+
+// 请求控制权，已有其他控制者时返回错误
+func (s *Session) requestControl(h *Hub) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("会话已关闭")
+	}
+	if s.controller != nil && s.controller != h {
+		return errors.New("控制权已被其他客户端持有")
+	}
+	s.controller = h
+	return nil
+}
+
+// 释放控制权，交给下一个加入的客户端
+func (s *Session) releaseControl(h *Hub) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.controller != h {
+		return errors.New("未持有控制权")
+	}
+	s.controller = nil
+	for _, client := range s.clients {
+		if client != h {
+			s.controller = client
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Session) info(h *Hub) SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SessionInfo{
+		Name:       s.name,
+		Clients:    len(s.clients),
+		Control:    h != nil && s.controller == h,
+		Controlled: s.controller != nil,
+		EnvSet:     s.c != nil,
+		Closed:     s.closed,
+	}
+}
+
+// 设置会话的计算环境，会话还没有计算器时按 env 的断面创建计算器，失败时返回错误类型和错误
+func (s *Session) setEnv(env model.Env) (string, error) {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+	s.mu.Lock()
+	c, closed := s.c, s.closed
+	s.mu.Unlock()
+	if closed {
+		return model.ErrRejected, errors.New("会话已关闭")
+	}
+	if err := calculator.CheckEnv(env); err != nil {
+		log.WithField("err", err).Warn("计算环境配置错误")
+		return model.ErrRejected, err
+	}
+	if c == nil {
+		var err error
+		if c, err = s.newCalculator(env); err != nil {
+			log.WithField("err", err).Warn("设置计算断面失败")
+			return model.ErrRejected, err
+		}
+		s.setCalculator(c)
+	}
+	c.GetCastingMachine().SetFromJson(env.Coordinate) // 初始化铸机尺寸
+	data, err := ioutil.ReadFile(config.NozzleFile())
+	if err != nil {
+		log.Println("err", err)
+		return model.ErrInternal, err
+	}
+	c.GetCastingMachine().SetCoolerConfig(env, data) // 设置冷却参数
+	c.GetCastingMachine().SetV(env.DragSpeed)        // 设置拉速
+	// 设置钢种物性参数
+	if err = c.InitSteel(env.SteelValue, c.GetCastingMachine()); err != nil {
+		log.WithField("err", err).Warn("初始化钢种失败")
+		return model.ErrRejected, err
+	}
+	c.InitPushData(env.Coordinate)
+	return "", nil
+}
+
+// 开始计算，计算结果推送给会话中的所有客户端
+func (s *Session) start() error {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return errors.New("已经在计算")
+	}
+	s.c.GetCalcHub().StartSignal()
+	go s.c.Run()                                    // 不断计算
+	go s.pushData(s.c, s.c.GetCalcHub().StopChan()) // 获取推送的计算结果到会话中的所有客户端
+	s.running = true
+	return nil
+}
+
+// 停止计算
+func (s *Session) stop() error {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return errors.New("没有在计算")
+	}
+	s.c.GetCalcHub().StopSignal()
+	s.running = false
+	return nil
+}
+
+// 检查拉速 m/min，websocket 和 REST 接口共用。拉速为 0 表示停止拉坯
+func checkSpeed(v float64) error {
+	if math.IsNaN(v) || math.IsInf(v, 0) || v < 0 {
+		return fmt.Errorf("拉速 %v 不能小于 0", v)
+	}
+	return nil
+}
+
+// 设置拉速 m/min
+func (s *Session) setSpeed(v float32) error {
+	s.ctl.Lock()
+	defer s.ctl.Unlock()
+	c := s.calculator()
+	if c == nil {
+		return errors.New("计算环境未设置")
+	}
+	c.GetCastingMachine().SetV(v)
+	return nil
+}
+
+// 是否可以用恢复令牌重新进入：已生成令牌并且计算环境已设置
+func (s *Session) resumable() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token != "" && s.c != nil && !s.closed
+}
+
+// 恢复连接的客户端 h 看到的会话状态
+func (s *Session) resumeState(h *Hub) *ResumeState {
+	state := &ResumeState{Session: s.info(h)}
+	s.mu.Lock()
+	c := s.c
+	state.Running = s.running
+	field := s.lastField
+	s.mu.Unlock()
+	if c != nil {
+		cfg := c.GetCastingMachine().CoolerConfig
+		state.Parameters = &ResumeParameters{
+			Speed:            c.GetCastingMachine().Speed(),
+			StartTemperature: cfg.StartTemperature,
+			NarrowSurfaceIn:  cfg.NarrowSurfaceIn,
+			NarrowSurfaceOut: cfg.NarrowSurfaceOut,
+			WideSurfaceIn:    cfg.WideSurfaceIn,
+			WideSurfaceOut:   cfg.WideSurfaceOut,
+		}
+		// 正在计算时使用推送协程构建的温度场，与其他客户端最近收到的相同；还没有推送过时再构建
+		if !state.Running || field == nil {
+			field = c.BuildData()
+		}
+		state.Field = field
+	}
+	return state
+}
+
+func (s *Session) clientList() []*Hub {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clients := make([]*Hub, len(s.clients))
+	copy(clients, s.clients)
+	return clients
+}
+
+// 没有客户端时关闭会话和计算器，返回是否关闭
+func (s *Session) closeIfIdle() bool {
+	s.mu.Lock()
+	if s.closed || len(s.clients) > 0 {
+		s.mu.Unlock()
+		return false
+	}
+	c := s.c
+	s.c = nil
+	s.closed = true
+	s.mu.Unlock()
+	if c != nil {
+		c.Close()
+		s.releaseGrid()
+	}
+	return true
+}
+
+// 关闭会话和计算器，通知仍在会话中的客户端
+func (s *Session) close() {
+	s.ctl.Lock()
+	s.mu.Lock()
+	c := s.c
+	s.c = nil
+	s.closed = true
+	s.controller = nil
+	s.mu.Unlock()
+	if c != nil {
+		c.Close()
+		s.releaseGrid()
+	}
+	s.ctl.Unlock()
+	s.notify("session_closed")
+}
+
+// 向会话中的每个客户端推送会话状态
+func (s *Session) notify(msgType string) {
+	for _, h := range s.clientList() {
+		h.replyJSON("", msgType, s.info(h), "会话状态")
+	}
+}
+
+// 向会话中的所有客户端推送消息，name 用于日志
+func (s *Session) broadcast(msg model.Msg, name string) {
+	for _, h := range s.clientList() {
+		if err := h.write(msg); err != nil {
+			log.WithFields(log.Fields{"session": s.name, "err": err}).Error("发送" + name + "失败")
+		}
+	}
+}
+
+// 把 v 序列化为 json 后推送给会话中的所有客户端
+func (s *Session) broadcastJSON(msgType string, v interface{}, name string) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.WithField("err", err).Error(name + "json解析失败")
+		return
+	}
+	s.broadcast(model.Msg{Type: msgType, Content: string(data)}, name)
+}
+
+// 周期性推送计算结果，计算停止或计算器关闭时退出
+func (s *Session) pushData(c calculator.Calculator, stop <-chan struct{}) {
+LOOP:
+	for {
+		select {
+		case <-stop:
+			break LOOP
+		case <-c.GetCalcHub().Done():
+			break LOOP
+		case <-c.GetCalcHub().PeriodCalcResult:
+			//start := time.Now()
+			data := c.BuildData()
+			s.mu.Lock()
+			if s.c == c {
+				s.lastField = data
+			}
+			s.mu.Unlock()
+			s.pushField(data)
+			//fmt.Println(time.Since(start).Milliseconds())
+			// 液芯末端、凝固末端、坯壳厚度和轻压下建议随温度场一起推送，拉速和冷却条件变化后随温度场更新
+			s.broadcastJSON("solidification_end", c.SolidificationEnd(), "液芯末端和凝固末端")
+			s.pushShellProfile(c)
+			s.pushSoftReduction(c)
+		case actions := <-c.GetCalcHub().ControlActions:
+			s.broadcastJSON("control_action", actions, "控制动作")
+		case alarms := <-c.GetCalcHub().Alarms:
+			s.broadcastJSON("alarm", alarms, "报警事件")
+		}
+	}
+}
+
+// 按每个客户端协商的格式推送温度场，每种格式只编码一次
+func (s *Session) pushField(data *calculator.TemperatureFieldData) {
+	var msg *model.Msg
+	frames := make(map[calculator.FrameEncoding][]byte)
+	for _, h := range s.clientList() {
+		encoding := h.getPushEncoding()
+		if encoding == 0 {
+			if msg == nil {
+				content, err := json.Marshal(data)
+				if err != nil {
+					log.WithField("err", err).Error("温度场推送数据json解析失败")
+					return
+				}
+				msg = &model.Msg{Type: "data_push", Content: string(content)}
+			}
+			if err := h.write(*msg); err != nil {
+				log.WithFields(log.Fields{"session": s.name, "err": err}).Error("发送温度场推送消息失败")
+			}
+			continue
+		}
+		frame, ok := frames[encoding]
+		if !ok {
+			var err error
+			if frame, err = calculator.EncodeFieldFrame(data, encoding); err != nil {
+				log.WithFields(log.Fields{"encoding": encoding, "err": err}).Error("温度场二进制编码失败")
+				continue
+			}
+			frames[encoding] = frame
+		}
+		if err := h.writeBinary(frame); err != nil {
+			log.WithFields(log.Fields{"session": s.name, "err": err}).Error("发送温度场二进制帧失败")
+		}
+	}
+}
+
+// 推送当前温度场沿拉坯方向的坯壳厚度，漏钢裕量不足时报警
+func (s *Session) pushShellProfile(c calculator.Calculator) {
+	profile := c.ShellProfile()
+	if profile.BreakoutRisk() {
+		log.WithFields(log.Fields{"session": s.name, "mold_exit": profile.MoldExit, "margin": profile.BreakoutMargin}).Warn("结晶器出口坯壳厚度低于安全下限")
+	}
+	s.broadcastJSON("shell_profile", profile, "坯壳厚度分布")
+}
+
+// 推送应投入轻压下的扇形段
+func (s *Session) pushSoftReduction(c calculator.Calculator) {
+	s.broadcastJSON("soft_reduction", c.SoftReduction(), "轻压下扇形段")
+}
+
+// 管理所有命名会话
+type SessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	tokens   map[string]*Session // 恢复令牌对应的会话，包括私有会话
+}
+
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		sessions: make(map[string]*Session),
+		tokens:   make(map[string]*Session),
+	}
+}
+
+// 获取会话的恢复令牌，没有时生成一个
+func (m *SessionManager) issueToken(s *Session) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" {
+		return s.token, nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	s.token = hex.EncodeToString(buf)
+	m.mu.Lock()
+	m.tokens[s.token] = s
+	m.mu.Unlock()
+	return s.token, nil
+}
+
+// 根据恢复令牌查找会话
+func (m *SessionManager) lookup(token string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.tokens[token]
+	if !ok {
+		return nil, errors.New("恢复令牌无效或会话已过期")
+	}
+	return s, nil
+}
+
+// 保留没有客户端的私有会话，ResumeTimeout 内没有恢复时关闭
+func (m *SessionManager) park(s *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expire != nil {
+		s.expire.Stop()
+	}
+	s.expire = time.AfterFunc(ResumeTimeout, func() {
+		if s.closeIfIdle() {
+			m.remove(s)
+			log.WithField("token", s.token).Info("会话等待恢复超时，已关闭")
+		}
+	})
+}
+
+// 移除会话的名称和恢复令牌
+func (m *SessionManager) remove(s *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.name != "" && m.sessions[s.name] == s {
+		delete(m.sessions, s.name)
+	}
+	if s.token != "" && m.tokens[s.token] == s {
+		delete(m.tokens, s.token)
+	}
+}
+
+// 获取名为 name 的会话，不存在时创建
+func (m *SessionManager) get(name string) (*Session, error) {
+	s, _, err := m.getOrCreate(name)
+	return s, err
+}
+
+// 获取名为 name 的会话，不存在时创建，created 表示会话是否由本次调用创建
+func (m *SessionManager) getOrCreate(name string) (s *Session, created bool, err error) {
+	if !sessionNamePattern.MatchString(name) {
+		return nil, false, fmt.Errorf("非法的会话名称 %q，只能包含字母、数字和 _ . -，长度不超过 64", name)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[name]
+	if !ok {
+		s = newSession(name)
+		m.sessions[name] = s
+		log.WithField("session", name).Info("创建会话")
+	}
+	return s, !ok, nil
+}
+
+// 移除并关闭会话
+func (m *SessionManager) close(s *Session) {
+	m.remove(s)
+	s.close()
+	log.WithField("session", s.name).Info("关闭会话")
+}
+
+// 按名称查找命名会话，不存在时返回错误
+func (m *SessionManager) find(name string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("会话 %q 不存在", name)
+	}
+	return s, nil
+}
+
+// 所有命名会话的状态，按名称排序
+func (m *SessionManager) list() []SessionInfo {
+	m.mu.Lock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.mu.Unlock()
+	list := make([]SessionInfo, 0, len(sessions))
+	for _, s := range sessions {
+		list = append(list, s.info(nil))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"lz/calculator"
+	"lz/model"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// 发送请求并等待带相同 request_id 的回复，跳过期间收到的推送
+func roundTrip(t *testing.T, conn *websocket.Conn, msg model.Msg) model.Msg {
+	if err := conn.WriteJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if reply := readReply(t, conn); reply.RequestID == msg.RequestID {
+			return reply
+		}
+	}
+}
+
+// 等待 msgType 类型的推送
+func waitPush(t *testing.T, conn *websocket.Conn, msgType string, timeout time.Duration) model.Msg {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if msg := readReply(t, conn); msg.RequestID == "" && msg.Type == msgType {
+			return msg
+		}
+	}
+	t.Fatal("未收到推送", msgType)
+	return model.Msg{}
+}
+
+func sessionInfo(t *testing.T, msg model.Msg) SessionInfo {
+	var info SessionInfo
+	if err := json.Unmarshal([]byte(msg.Content), &info); err != nil {
+		t.Fatal(msg, err)
+	}
+	return info
+}
+
+func TestSharedSession(t *testing.T) {
+	content := loadTestEnv(t)
+	ts := newTestServer(t)
+	controller, viewer := dialTestServer(t, ts), dialTestServer(t, ts)
+
+	reply := roundTrip(t, controller, model.Msg{RequestID: "1", Type: "attach_session", Content: "strand-1"})
+	if reply.Type != "session_attached" || !sessionInfo(t, reply).Control {
+		t.Fatal("第一个加入会话的客户端应获得控制权", reply)
+	}
+	if reply = roundTrip(t, controller, model.Msg{RequestID: "2", Type: "env", Content: content}); reply.Type != "env_set" {
+		t.Fatal("设置计算环境失败", reply)
+	}
+	if reply = roundTrip(t, controller, model.Msg{RequestID: "2-1", Type: "generate"}); reply.Error == nil || reply.Error.Type != model.ErrRejected {
+		t.Fatal("共享会话不能替换为生成测试数据的计算器", reply)
+	}
+
+	reply = roundTrip(t, viewer, model.Msg{RequestID: "1", Type: "attach_session", Content: "strand-1"})
+	if info := sessionInfo(t, reply); reply.Type != "session_attached" || info.Control || !info.EnvSet || info.Clients != 2 {
+		t.Fatal("后加入的客户端应只读并共享计算环境", reply)
+	}
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "2", Type: "change_v", Content: "1.2"}); reply.Error == nil || reply.Error.Type != model.ErrForbidden {
+		t.Fatal("只读客户端不能修改拉速", reply)
+	}
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "3", Type: "get_solidification_end"}); reply.Type != "solidification_end" {
+		t.Fatal("只读客户端可以查询计算结果", reply)
+	}
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "4", Type: "request_control"}); reply.Error == nil || reply.Error.Type != model.ErrRejected {
+		t.Fatal("控制权已被持有时请求应被拒绝", reply)
+	}
+
+	// 两个客户端收到同一个计算器的温度场推送
+	if reply = roundTrip(t, controller, model.Msg{RequestID: "3", Type: "start"}); reply.Type != "started" {
+		t.Fatal("开始计算失败", reply)
+	}
+	waitPush(t, controller, "data_push", 20*time.Second)
+	waitPush(t, viewer, "data_push", 20*time.Second)
+
+	// 控制者离开后控制权交给剩下的客户端，会话继续存在
+	if reply = roundTrip(t, controller, model.Msg{RequestID: "4", Type: "detach_session"}); reply.Type != "session_detached" {
+		t.Fatal("离开会话失败", reply)
+	}
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "5", Type: "change_v", Content: "1.2"}); reply.Type != "v_set" {
+		t.Fatal("控制权应交给剩下的客户端", reply)
+	}
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "5-1", Type: "change_v", Content: "-1"}); reply.Error == nil || reply.Error.Type != model.ErrBadRequest {
+		t.Fatal("拉速小于 0 时应被拒绝", reply)
+	}
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "5-2", Type: "change_v", Content: "0"}); reply.Type != "v_set" {
+		t.Fatal("拉速为 0 表示停止拉坯", reply)
+	}
+	reply = roundTrip(t, controller, model.Msg{RequestID: "5", Type: "list_sessions"})
+	var list []SessionInfo
+	if err := json.Unmarshal([]byte(reply.Content), &list); err != nil || len(list) != 1 || list[0].Name != "strand-1" || list[0].Clients != 1 {
+		t.Fatal("会话列表不正确", reply)
+	}
+
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "6", Type: "close_session"}); reply.Type != "session_closed" {
+		t.Fatal("关闭会话失败", reply)
+	}
+	if reply = roundTrip(t, viewer, model.Msg{RequestID: "7", Type: "attach_session", Content: "../x"}); reply.Error == nil || reply.Error.Type != model.ErrRejected {
+		t.Fatal("非法的会话名称应被拒绝", reply)
+	}
+}
+
+func TestResume(t *testing.T) {
+	content := loadTestEnv(t)
+	defer func(timeout time.Duration) { ResumeTimeout = timeout }(ResumeTimeout)
+	ResumeTimeout = 2 * time.Second
+	ts := newTestServer(t)
+	baseline := runtime.NumGoroutine()
+
+	conn := dialTestServer(t, ts)
+	if reply := roundTrip(t, conn, model.Msg{RequestID: "1", Type: "env", Content: content}); reply.Type != "env_set" || reply.ResumeToken == "" {
+		t.Fatal("设置计算环境应回复恢复令牌", reply)
+	}
+	reply := roundTrip(t, conn, model.Msg{RequestID: "2", Type: "start"})
+	if reply.Type != "started" || reply.ResumeToken == "" {
+		t.Fatal("开始计算应回复恢复令牌", reply)
+	}
+	token := reply.ResumeToken
+	if reply = roundTrip(t, conn, model.Msg{RequestID: "3", Type: "change_v", Content: "1.2"}); reply.Type != "v_set" {
+		t.Fatal("设置拉速失败", reply)
+	}
+	_ = conn.Close()
+
+	// 新的连接用令牌恢复，得到当前状态，计算没有重新开始并继续推送
+	conn = dialTestServer(t, ts)
+	if reply = roundTrip(t, conn, model.Msg{RequestID: "1", Type: "resume", Content: "no-such-token"}); reply.Error == nil || reply.Error.Type != model.ErrRejected {
+		t.Fatal("无效的恢复令牌应被拒绝", reply)
+	}
+	reply = roundTrip(t, conn, model.Msg{RequestID: "2", Type: "resume", Content: token})
+	var state ResumeState
+	if err := json.Unmarshal([]byte(reply.Content), &state); err != nil || reply.Type != "resumed" {
+		t.Fatal("恢复会话失败", reply, err)
+	}
+	if !state.Running || !state.Session.Control || state.Field == nil || state.Parameters == nil || state.Parameters.Speed != 1.2 {
+		t.Fatal("恢复后的状态不正确", state.Running, state.Session, state.Parameters)
+	}
+	waitPush(t, conn, "data_push", 20*time.Second)
+	if reply = roundTrip(t, conn, model.Msg{RequestID: "3", Type: "stop"}); reply.Type != "stopped" {
+		t.Fatal("恢复后应持有控制权", reply)
+	}
+
+	// 再次断开后超时未恢复，会话和计算器关闭
+	_ = conn.Close()
+	if n := waitGoroutines(baseline, 10*time.Second); n > baseline {
+		t.Fatal("等待恢复超时后协程应全部退出", n, baseline)
+	}
+	conn = dialTestServer(t, ts)
+	if reply = roundTrip(t, conn, model.Msg{RequestID: "1", Type: "resume", Content: token}); reply.Error == nil {
+		t.Fatal("超时后恢复令牌应失效", reply)
+	}
+}
+
+func TestSessionSectionConflict(t *testing.T) {
+	content := loadTestEnv(t)
+	var env model.Env
+	if err := json.Unmarshal([]byte(content), &env); err != nil {
+		t.Fatal(err)
+	}
+	env.Coordinate.Width += 2 * calculator.YStep
+	thicker, _ := json.Marshal(env)
+	ts := newTestServer(t)
+	first, second := dialTestServer(t, ts), dialTestServer(t, ts)
+
+	roundTrip(t, first, model.Msg{RequestID: "1", Type: "attach_session", Content: "strand-1"})
+	if reply := roundTrip(t, first, model.Msg{RequestID: "2", Type: "env", Content: content}); reply.Type != "env_set" {
+		t.Fatal("设置计算环境失败", reply)
+	}
+	// 计算断面和铸坯尺寸是所有计算器共用的全局变量，不能与正在使用的会话不同
+	roundTrip(t, second, model.Msg{RequestID: "1", Type: "attach_session", Content: "strand-2"})
+	width := calculator.Width
+	if reply := roundTrip(t, second, model.Msg{RequestID: "2", Type: "env", Content: string(thicker)}); reply.Error == nil || reply.Error.Type != model.ErrRejected {
+		t.Fatal("铸坯尺寸与其他会话不同时应被拒绝", reply)
+	}
+	if calculator.Width != width {
+		t.Fatal("被拒绝的计算环境不应修改铸坯尺寸", calculator.Width)
+	}
+	if reply := roundTrip(t, second, model.Msg{RequestID: "3", Type: "env", Content: content}); reply.Type != "env_set" {
+		t.Fatal("铸坯尺寸相同的会话应可以设置计算环境", reply)
+	}
+
+	// 会话关闭后不再占用断面
+	roundTrip(t, first, model.Msg{RequestID: "3", Type: "close_session"})
+	roundTrip(t, second, model.Msg{RequestID: "4", Type: "close_session"})
+	gridMu.Lock()
+	defer gridMu.Unlock()
+	for s := range gridUsers {
+		if s.name == "strand-1" || s.name == "strand-2" {
+			t.Fatal("会话关闭后应释放计算断面", s.name)
+		}
+	}
+}